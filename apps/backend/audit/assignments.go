@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// expiredGrant is the audited state of a role assignment removed on expiry,
+// in the shape used for granted and revoked roles
+type expiredGrant struct {
+	Role      string     `json:"role"`
+	StartsAt  *time.Time `json:"starts_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Reason    string     `json:"reason"`
+}
+
+// RecordExpiredAssignments records the removal of each expired assignment
+// within tx. The events have no actor and belong to the assignment's
+// organization.
+func RecordExpiredAssignments(tx *gorm.DB, expired []models.ExpiredRoleAssignment) error {
+	if len(expired) == 0 {
+		return nil
+	}
+
+	roleIDs := make([]uuid.UUID, 0, len(expired))
+	for _, assignment := range expired {
+		roleIDs = append(roleIDs, assignment.RoleID)
+	}
+	var roles []models.Role
+	if err := tx.Unscoped().Select("id", "name").Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+		return err
+	}
+	names := make(map[uuid.UUID]string, len(roles))
+	for _, role := range roles {
+		names[role.ID] = role.Name
+	}
+
+	// One append locks the shards of every organization in a fixed order
+	events := make([]models.Chained, 0, len(expired))
+	for _, assignment := range expired {
+		orgID := assignment.OrganizationID
+		event, err := newEvent(Source{OrganizationID: &orgID}, Change{
+			Action:     UserRoleExpired,
+			TargetType: TargetUser,
+			TargetID:   assignment.UserID,
+			Before: expiredGrant{
+				Role:      names[assignment.RoleID],
+				StartsAt:  assignment.StartsAt,
+				ExpiresAt: assignment.ExpiresAt,
+				Reason:    assignment.Reason,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	return Append(tx, events...)
+}
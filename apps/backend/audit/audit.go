@@ -0,0 +1,158 @@
+// Package audit records who changed what in an append-only log. Each event
+// is appended to a hash chain so that later edits and deletions show up when
+// the chain is verified.
+package audit
+
+import (
+	"backend/models"
+	"encoding/json"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log
+const (
+	UserCreated     = "user.created"
+	UserUpdated     = "user.updated"
+	UserRemoved     = "user.removed" // removed from an organization, the account remains
+	UserDeleted     = "user.deleted"
+	UserRolesSet    = "user.roles_set"
+	UserRoleGranted = "user.role_granted"
+	UserRoleRevoked = "user.role_revoked"
+	UserRoleExpired = "user.role_expired" // removed by the assignment sweeper
+
+	RoleCreated = "role.created"
+	RoleUpdated = "role.updated"
+	RoleDeleted = "role.deleted"
+
+	PermissionCreated = "permission.created"
+	PermissionUpdated = "permission.updated"
+	PermissionDeleted = "permission.deleted"
+
+	OrganizationCreated = "organization.created"
+	InvitationAccepted  = "invitation.accepted"
+
+	ElevationApproved = "elevation.approved"
+	ElevationRejected = "elevation.rejected"
+
+	AuthRegistered               = "auth.registered"
+	AuthLogin                    = "auth.login"
+	AuthLogout                   = "auth.logout"
+	AuthLogoutAll                = "auth.logout_all"
+	AuthEmailVerified            = "auth.email_verified"
+	AuthPasswordReset            = "auth.password_reset"
+	AuthMFAEnabled               = "auth.mfa_enabled"
+	AuthMFADisabled              = "auth.mfa_disabled"
+	AuthRecoveryCodesRegenerated = "auth.recovery_codes_regenerated"
+)
+
+// Target types
+const (
+	TargetUser         = "user"
+	TargetRole         = "role"
+	TargetPermission   = "permission"
+	TargetOrganization = "organization"
+	TargetInvitation   = "invitation"
+	TargetElevation    = "elevation_request"
+)
+
+// ignoredFields change on every save and are left out of diffs
+var ignoredFields = map[string]bool{"updated_at": true}
+
+// Source describes who made a change and the request it came from
+type Source struct {
+	ActorID        *uuid.UUID
+	OrganizationID *uuid.UUID
+	IP             string
+	UserAgent      string
+	RequestID      string
+}
+
+// Change is one change to a target. Before and After are snapshots of the
+// target encoded as JSON objects; nil means the target did not exist.
+type Change struct {
+	Action     string
+	TargetType string
+	TargetID   uuid.UUID
+	Before     interface{}
+	After      interface{}
+}
+
+// Record appends an audit event for the change to the audit chain. Pass the
+// transaction that makes the change so the event is only kept if the change
+// is.
+func Record(tx *gorm.DB, source Source, change Change) error {
+	event, err := newEvent(source, change)
+	if err != nil {
+		return err
+	}
+	return Append(tx, event)
+}
+
+// newEvent builds the audit event for a change
+func newEvent(source Source, change Change) (*models.AuditEvent, error) {
+	before, after, err := Diff(change.Before, change.After)
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.AuditEvent{
+		OrganizationID: source.OrganizationID,
+		ActorID:        source.ActorID,
+		Action:         change.Action,
+		TargetType:     change.TargetType,
+		Before:         before,
+		After:          after,
+		IP:             source.IP,
+		UserAgent:      source.UserAgent,
+		RequestID:      source.RequestID,
+	}
+	if change.TargetID != uuid.Nil {
+		event.TargetID = &change.TargetID
+	}
+	return &event, nil
+}
+
+// Diff encodes both snapshots and keeps only the fields whose values differ.
+// A field missing on one side is left out of that side.
+func Diff(before, after interface{}) (models.JSONMap, models.JSONMap, error) {
+	old, err := snapshot(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := snapshot(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for field := range ignoredFields {
+		delete(old, field)
+		delete(updated, field)
+	}
+	for field, value := range old {
+		if newValue, ok := updated[field]; ok && reflect.DeepEqual(value, newValue) {
+			delete(old, field)
+			delete(updated, field)
+		}
+	}
+	return old, updated, nil
+}
+
+// snapshot encodes a value as a JSON object, so that json tags decide which
+// fields are audited and secrets tagged json:"-" never are
+func snapshot(value interface{}) (models.JSONMap, error) {
+	result := models.JSONMap{}
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return result, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"backend/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createBatchSize keeps batch inserts well below the Postgres limit of 65535
+// parameters per statement
+const createBatchSize = 1000
+
+// dayLayout formats the UTC day a chain segment covers
+const dayLayout = "2006-01-02"
+
+// ChainShards is how many shards new records of a chain are spread over.
+// Records keep the shard they were written to.
+const ChainShards = 16
+
+// segment is one day of a chain shard
+type segment struct {
+	chain string
+	shard int16
+	day   time.Time
+}
+
+// Chains are the hash chained tables, in the order they are verified
+var Chains = []models.Chained{&models.AuditEvent{}, &models.FailedLogin{}, &models.RequestLog{}}
+
+// Append links each record to the end of its chain shard and creates it
+// within tx. Records are chained by their shard key and the UTC day of their
+// creation time, which defaults to now. The head of each segment stays
+// locked until tx ends, so appends to the same shard wait for the
+// transactions before them while other shards carry on.
+func Append(tx *gorm.DB, records ...models.Chained) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		segments := map[segment]bool{}
+		for _, record := range records {
+			id, createdAt, link := record.ChainFields()
+			if *id == uuid.Nil {
+				*id = uuid.New()
+			}
+			if createdAt.IsZero() {
+				*createdAt = now
+			}
+			// Stored timestamps keep microseconds, so hash what will be read back
+			*createdAt = createdAt.UTC().Truncate(time.Microsecond)
+			link.ChainShard = shardOf(record)
+			segments[segment{record.ChainName(), link.ChainShard, chainDay(*createdAt)}] = true
+		}
+
+		// Lock heads in a fixed order so concurrent appends cannot deadlock
+		order := make([]segment, 0, len(segments))
+		for seg := range segments {
+			order = append(order, seg)
+		}
+		sort.Slice(order, func(i, j int) bool {
+			if !order[i].day.Equal(order[j].day) {
+				return order[i].day.Before(order[j].day)
+			}
+			if order[i].chain != order[j].chain {
+				return order[i].chain < order[j].chain
+			}
+			return order[i].shard < order[j].shard
+		})
+		heads := make(map[segment]*models.ChainHead, len(order))
+		for _, seg := range order {
+			head, err := lockHead(tx, seg)
+			if err != nil {
+				return err
+			}
+			heads[seg] = head
+		}
+
+		for _, record := range records {
+			_, createdAt, link := record.ChainFields()
+			chain := record.ChainName()
+			head := heads[segment{chain, link.ChainShard, chainDay(*createdAt)}]
+
+			seq := head.Seq + 1
+			hash, err := Hash(chainKey(chain, link.ChainShard), seq, head.Hash, record.ChainPayload())
+			if err != nil {
+				return err
+			}
+			link.ChainSeq = &seq
+			link.PrevHash = head.Hash
+			link.Hash = hash
+			head.Seq, head.Hash = seq, hash
+		}
+		if err := createRecords(tx, records); err != nil {
+			return err
+		}
+
+		for _, head := range heads {
+			if err := tx.Model(&models.ChainHead{}).
+				Where("chain = ? AND shard = ? AND day = ?", head.Chain, head.Shard, head.Day).
+				Updates(map[string]interface{}{"seq": head.Seq, "hash": head.Hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createRecords inserts the records of each table in batches
+func createRecords(tx *gorm.DB, records []models.Chained) error {
+	if len(records) == 1 {
+		return tx.Create(records[0]).Error
+	}
+
+	var order []reflect.Type
+	tables := map[reflect.Type]reflect.Value{}
+	for _, record := range records {
+		value := reflect.ValueOf(record)
+		rows, ok := tables[value.Type()]
+		if !ok {
+			rows = reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, len(records))
+			order = append(order, value.Type())
+		}
+		tables[value.Type()] = reflect.Append(rows, value)
+	}
+	for _, recordType := range order {
+		if err := tx.CreateInBatches(tables[recordType].Interface(), createBatchSize).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hash is the SHA-256 of a record's place in its chain and its payload
+// encoded as JSON. chain is the shard's chainKey.
+func Hash(chain string, seq int64, prevHash string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s\n", chain, seq, prevHash)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// genesisHash is the PrevHash of the first record of a day
+func genesisHash(chain string, day time.Time) string {
+	sum := sha256.Sum256([]byte(chain + "\n" + day.Format(dayLayout)))
+	return hex.EncodeToString(sum[:])
+}
+
+// lockHead locks the head of a segment, starting it if needed
+func lockHead(tx *gorm.DB, seg segment) (*models.ChainHead, error) {
+	start := models.ChainHead{Chain: seg.chain, Shard: seg.shard, Day: seg.day, Hash: genesisHash(chainKey(seg.chain, seg.shard), seg.day)}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&start).Error; err != nil {
+		return nil, err
+	}
+
+	var head models.ChainHead
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("chain = ? AND shard = ? AND day = ?", seg.chain, seg.shard, seg.day).
+		Take(&head).Error; err != nil {
+		return nil, err
+	}
+	head.Day = seg.day
+	return &head, nil
+}
+
+// shardOf picks the shard of a record from its shard key
+func shardOf(record models.Chained) int16 {
+	key := record.ChainShardKey()
+	h := fnv.New32a()
+	h.Write(key[:])
+	return int16(h.Sum32() % ChainShards)
+}
+
+// chainKey names a chain shard in its hashes and checkpoint signatures.
+// Shard 0 keeps the chain's name, so records linked before chains were
+// sharded still verify.
+func chainKey(chain string, shard int16) string {
+	if shard == 0 {
+		return chain
+	}
+	return fmt.Sprintf("%s#%d", chain, shard)
+}
+
+// chainDay is the UTC day a creation time falls on
+func chainDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
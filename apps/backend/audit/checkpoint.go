@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateCheckpoints seals every finished day that has no checkpoint yet. A
+// day is finished once grace has passed since its end. With sign, each
+// checkpoint is signed with the active JWT key. Instances running this at
+// the same time take turns.
+func CreateCheckpoints(db *gorm.DB, now time.Time, grace time.Duration, sign bool) (int, error) {
+	created := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('chain_checkpoints'))").Error; err != nil {
+			return err
+		}
+
+		var heads []models.ChainHead
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("seq > 0 AND day < ?", chainDay(now.Add(-grace))).
+			Where("NOT EXISTS (SELECT 1 FROM chain_checkpoints WHERE chain_checkpoints.chain = chain_heads.chain AND chain_checkpoints.shard = chain_heads.shard AND chain_checkpoints.day = chain_heads.day)").
+			Order("chain, shard, day").
+			Find(&heads).Error; err != nil {
+			return err
+		}
+
+		for _, head := range heads {
+			checkpoint := models.ChainCheckpoint{Chain: head.Chain, Shard: head.Shard, Day: chainDay(head.Day), Seq: head.Seq, Hash: head.Hash}
+
+			var previous models.ChainCheckpoint
+			err := tx.Where("chain = ? AND shard = ? AND day < ?", head.Chain, head.Shard, checkpoint.Day).Order("day DESC").Take(&previous).Error
+			if err == nil {
+				checkpoint.PrevHash = previous.Hash
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if sign {
+				if checkpoint.KeyID, checkpoint.Signature, err = utils.SignCheckpoint(checkpointMessage(checkpoint)); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&checkpoint).Error; err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	return created, err
+}
+
+// StartCheckpointer creates checkpoints every interval until ctx is done
+func StartCheckpointer(ctx context.Context, settings config.AuditChainConfig) {
+	go func() {
+		ticker := time.NewTicker(settings.CheckpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			created, err := CreateCheckpoints(config.DB.WithContext(ctx), time.Now(), settings.CheckpointGrace, settings.SignCheckpoints)
+			switch {
+			case err != nil && ctx.Err() != nil:
+				return // cancelled by shutdown
+			case err != nil:
+				log.Printf("Failed to create audit chain checkpoints: %v", err)
+			case created > 0:
+				log.Printf("Created %d audit chain checkpoints", created)
+			}
+		}
+	}()
+}
+
+// checkpointMessage is what a checkpoint signature covers
+func checkpointMessage(checkpoint models.ChainCheckpoint) []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%s\n%s", chainKey(checkpoint.Chain, checkpoint.Shard), checkpoint.Day.Format(dayLayout), checkpoint.Seq, checkpoint.Hash, checkpoint.PrevHash))
+}
@@ -0,0 +1,343 @@
+package audit
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// verifyBatchSize is how many records Verify loads at a time
+const verifyBatchSize = 1000
+
+// VerifyOptions selects what Verify checks
+type VerifyOptions struct {
+	// Chains names the chains to verify; empty means all of them
+	Chains []string
+	// From and To bound the days verified, To excluded; zero means unbounded
+	From time.Time
+	To   time.Time
+	// RequireSignatures treats unsigned checkpoints as broken
+	RequireSignatures bool
+}
+
+// Report is the outcome of verifying one chain
+type Report struct {
+	Chain       string
+	Days        int
+	Records     int64
+	Checkpoints int
+	// Broken is the first broken link, or nil when the chain is intact
+	Broken *BrokenLink
+}
+
+// BrokenLink locates where a chain stops verifying
+type BrokenLink struct {
+	Shard    int16
+	Day      time.Time
+	Seq      int64      // 0 when the break is not at a record
+	RecordID *uuid.UUID // nil when the break is not at a record
+	Reason   string
+}
+
+func (bl BrokenLink) String() string {
+	location := fmt.Sprintf("shard %d %s", bl.Shard, bl.Day.Format(dayLayout))
+	if bl.Seq > 0 {
+		location += fmt.Sprintf(" seq %d", bl.Seq)
+	}
+	if bl.RecordID != nil {
+		location += " (" + bl.RecordID.String() + ")"
+	}
+	return location + ": " + bl.Reason
+}
+
+// Verify walks each shard of each chain day by day and reports the chain's
+// first broken link:
+// a missing or reordered record, a record whose content no longer matches
+// its hash, a head or checkpoint that does not match the records, a missing
+// checkpoint or a bad signature.
+func Verify(db *gorm.DB, options VerifyOptions) ([]Report, error) {
+	for _, name := range options.Chains {
+		if !isChain(name) {
+			return nil, fmt.Errorf("unknown chain %q", name)
+		}
+	}
+
+	var reports []Report
+	for _, model := range Chains {
+		if len(options.Chains) > 0 && !containsString(options.Chains, model.ChainName()) {
+			continue
+		}
+		report, err := verifyChain(db, model, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", model.ChainName(), err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func verifyChain(db *gorm.DB, model models.Chained, options VerifyOptions) (Report, error) {
+	report := Report{Chain: model.ChainName()}
+
+	shards, err := chainShards(db, model)
+	if err != nil {
+		return report, err
+	}
+	days := map[string]bool{}
+	for _, shard := range shards {
+		broken, err := verifyShard(db, model, shard, options, &report, days)
+		if err != nil {
+			return report, err
+		}
+		if broken != nil {
+			report.Broken = broken
+			break
+		}
+	}
+	report.Days = len(days)
+	return report, nil
+}
+
+// verifyShard walks one shard of a chain day by day, adding the days it
+// covers to days
+func verifyShard(db *gorm.DB, model models.Chained, shard int16, options VerifyOptions, report *Report, days map[string]bool) (*BrokenLink, error) {
+	chain := model.ChainName()
+	shardDays, err := chainDays(db, model, shard, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var heads []models.ChainHead
+	if err := boundDays(db.Where("chain = ? AND shard = ?", chain, shard), options).Find(&heads).Error; err != nil {
+		return nil, err
+	}
+	headsByDay := make(map[string]*models.ChainHead, len(heads))
+	for i := range heads {
+		headsByDay[heads[i].Day.Format(dayLayout)] = &heads[i]
+	}
+
+	// Checkpoints before From are loaded too, to check the first one in range
+	// links to its predecessor
+	var checkpoints []models.ChainCheckpoint
+	query := db.Where("chain = ? AND shard = ?", chain, shard).Order("day")
+	if !options.To.IsZero() {
+		query = query.Where("day < ?", options.To)
+	}
+	if err := query.Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	checkpointsByDay := make(map[string]*models.ChainCheckpoint, len(checkpoints))
+	previousCheckpoint := make(map[string]string, len(checkpoints))
+	for i := range checkpoints {
+		day := checkpoints[i].Day.Format(dayLayout)
+		checkpointsByDay[day] = &checkpoints[i]
+		if i > 0 {
+			previousCheckpoint[day] = checkpoints[i-1].Hash
+		}
+	}
+
+	for _, day := range shardDays {
+		key := day.Format(dayLayout)
+		days[key] = true
+		broken, err := verifyDay(db, model, shard, day, headsByDay[key], checkpointsByDay[key], previousCheckpoint[key], options, report)
+		if err != nil || broken != nil {
+			return broken, err
+		}
+	}
+	return nil, nil
+}
+
+// verifyDay walks one day of a chain shard, then checks the day's head and
+// checkpoint against its last record
+func verifyDay(db *gorm.DB, model models.Chained, shard int16, day time.Time, head *models.ChainHead, checkpoint *models.ChainCheckpoint, previousCheckpoint string, options VerifyOptions, report *Report) (*BrokenLink, error) {
+	chain := chainKey(model.ChainName(), shard)
+	query := db.Model(model).
+		Where("chain_seq IS NOT NULL AND chain_shard = ? AND created_at >= ? AND created_at < ?", shard, day, day.AddDate(0, 0, 1)).
+		Order("chain_seq, id")
+
+	var seq int64
+	prev := genesisHash(chain, day)
+	var firstCreatedAt time.Time
+	var lastID uuid.UUID
+	for {
+		page := query.Session(&gorm.Session{}).Limit(verifyBatchSize)
+		if seq > 0 {
+			page = page.Where("(chain_seq, id) > (?, ?)", seq, lastID)
+		}
+		records, err := loadChained(page, model)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			id, createdAt, link := record.ChainFields()
+			broken := &BrokenLink{Shard: shard, Day: day, Seq: *link.ChainSeq, RecordID: id}
+			switch {
+			case *link.ChainSeq > seq+1:
+				broken.Reason = fmt.Sprintf("records %d to %d are missing", seq+1, *link.ChainSeq-1)
+				return broken, nil
+			case *link.ChainSeq <= seq:
+				broken.Reason = "sequence number is repeated"
+				return broken, nil
+			case link.PrevHash != prev:
+				broken.Reason = "previous hash does not match the record before it"
+				return broken, nil
+			}
+			hash, err := Hash(chain, *link.ChainSeq, link.PrevHash, record.ChainPayload())
+			if err != nil {
+				return nil, err
+			}
+			if hash != link.Hash {
+				broken.Reason = "content does not match the record's hash"
+				return broken, nil
+			}
+
+			if firstCreatedAt.IsZero() || createdAt.Before(firstCreatedAt) {
+				firstCreatedAt = *createdAt
+			}
+			seq, prev, lastID = *link.ChainSeq, link.Hash, *id
+			report.Records++
+		}
+		if len(records) < verifyBatchSize {
+			break
+		}
+	}
+
+	switch {
+	case head == nil && seq > 0:
+		return &BrokenLink{Shard: shard, Day: day, Reason: "chain head is missing"}, nil
+	case head != nil && head.Seq > seq:
+		return &BrokenLink{Shard: shard, Day: day, Seq: seq + 1, Reason: fmt.Sprintf("records %d to %d are missing from the end of the day", seq+1, head.Seq)}, nil
+	case head != nil && (head.Seq != seq || head.Hash != prev):
+		return &BrokenLink{Shard: shard, Day: day, Reason: "chain head does not match the last record"}, nil
+	}
+
+	// Rows from before the chain existed stay unlinked, but none can follow
+	// the first linked record of the day
+	if seq > 0 {
+		var unlinked int64
+		if err := db.Model(model).
+			Where("chain_seq IS NULL AND created_at >= ? AND created_at < ?", firstCreatedAt, day.AddDate(0, 0, 1)).
+			Count(&unlinked).Error; err != nil {
+			return nil, err
+		}
+		if unlinked > 0 {
+			return &BrokenLink{Shard: shard, Day: day, Reason: fmt.Sprintf("%d records were added outside the chain", unlinked)}, nil
+		}
+	}
+
+	if checkpoint == nil {
+		return nil, nil
+	}
+	report.Checkpoints++
+	switch {
+	case checkpoint.Seq != seq || checkpoint.Hash != prev:
+		return &BrokenLink{Shard: shard, Day: day, Reason: "checkpoint does not match the last record"}, nil
+	case checkpoint.PrevHash != previousCheckpoint:
+		return &BrokenLink{Shard: shard, Day: day, Reason: "checkpoint does not link to the previous checkpoint"}, nil
+	case checkpoint.Signature == "" && options.RequireSignatures:
+		return &BrokenLink{Shard: shard, Day: day, Reason: "checkpoint is not signed"}, nil
+	case checkpoint.Signature != "":
+		if err := utils.VerifyCheckpoint(checkpoint.KeyID, checkpointMessage(*checkpoint), checkpoint.Signature); err != nil {
+			return &BrokenLink{Shard: shard, Day: day, Reason: "checkpoint signature is invalid: " + err.Error()}, nil
+		}
+	}
+	return nil, nil
+}
+
+// chainShards lists the shards of a chain that have a head, a checkpoint or
+// linked records
+func chainShards(db *gorm.DB, model models.Chained) ([]int16, error) {
+	chain := model.ChainName()
+
+	// The table name comes from Chains, never from input
+	sql := `SELECT shard FROM chain_heads WHERE chain = ?
+		UNION SELECT shard FROM chain_checkpoints WHERE chain = ?
+		UNION SELECT DISTINCT chain_shard FROM ` + chain + ` WHERE chain_seq IS NOT NULL
+		ORDER BY shard`
+
+	var shards []int16
+	err := db.Raw(sql, chain, chain).Scan(&shards).Error
+	return shards, err
+}
+
+// chainDays lists the days of a shard that have a head, a checkpoint or
+// linked records. Days are taken from all three so that removing any of them
+// is noticed.
+func chainDays(db *gorm.DB, model models.Chained, shard int16, options VerifyOptions) ([]time.Time, error) {
+	chain := model.ChainName()
+	bounds, args := []string{"TRUE"}, []interface{}{}
+	if !options.From.IsZero() {
+		bounds = append(bounds, "day >= ?")
+		args = append(args, options.From)
+	}
+	if !options.To.IsZero() {
+		bounds = append(bounds, "day < ?")
+		args = append(args, options.To)
+	}
+
+	// The table name comes from Chains, never from input
+	sql := `SELECT day FROM (
+		SELECT day FROM chain_heads WHERE chain = ? AND shard = ?
+		UNION SELECT day FROM chain_checkpoints WHERE chain = ? AND shard = ?
+		UNION SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date AS day FROM ` + chain + ` WHERE chain_seq IS NOT NULL AND chain_shard = ?
+	) AS days WHERE ` + strings.Join(bounds, " AND ") + ` ORDER BY day`
+
+	var days []time.Time
+	err := db.Raw(sql, append([]interface{}{chain, shard, chain, shard, shard}, args...)...).Scan(&days).Error
+	return days, err
+}
+
+// boundDays limits a query on a day column to the verified days
+func boundDays(query *gorm.DB, options VerifyOptions) *gorm.DB {
+	if !options.From.IsZero() {
+		query = query.Where("day >= ?", options.From)
+	}
+	if !options.To.IsZero() {
+		query = query.Where("day < ?", options.To)
+	}
+	return query
+}
+
+// loadChained runs query into a slice of model's type
+func loadChained(query *gorm.DB, model models.Chained) ([]models.Chained, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model).Elem()))
+	if err := query.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]models.Chained, rows.Elem().Len())
+	for i := range records {
+		record, ok := rows.Elem().Index(i).Addr().Interface().(models.Chained)
+		if !ok {
+			return nil, errors.New("chained records must implement models.Chained by pointer")
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+func isChain(name string) bool {
+	for _, model := range Chains {
+		if model.ChainName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"backend/audit"
+	"backend/config"
+	"backend/utils"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	chains := flag.String("chain", "", "comma separated chains to verify (default: all)")
+	from := flag.String("from", "", "first day to verify, YYYY-MM-DD (default: the first chained day)")
+	to := flag.String("to", "", "last day to verify, YYYY-MM-DD (default: today)")
+	requireSignatures := flag.Bool("require-signatures", false, "treat unsigned checkpoints as broken")
+	flag.Parse()
+
+	options := audit.VerifyOptions{RequireSignatures: *requireSignatures}
+	if *chains != "" {
+		options.Chains = strings.Split(*chains, ",")
+	}
+	if *from != "" {
+		day, err := time.Parse(dateLayout, *from)
+		if err != nil {
+			log.Fatalf("Invalid -from %q: use YYYY-MM-DD", *from)
+		}
+		options.From = day
+	}
+	if *to != "" {
+		day, err := time.Parse(dateLayout, *to)
+		if err != nil {
+			log.Fatalf("Invalid -to %q: use YYYY-MM-DD", *to)
+		}
+		options.To = day.AddDate(0, 0, 1)
+	}
+
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using system environment variables")
+	}
+
+	// Checkpoint signatures are verified with the JWT keys, including retired
+	// public keys
+	if err := utils.InitKeys(); err != nil {
+		log.Fatal("Failed to load keys:", err)
+	}
+	config.OpenDB()
+
+	reports, err := audit.Verify(config.DB, options)
+	if err != nil {
+		log.Fatal("Verification failed: ", err)
+	}
+	broken := false
+	for _, report := range reports {
+		status := "ok"
+		if report.Broken != nil {
+			status = "BROKEN at " + report.Broken.String()
+			broken = true
+		}
+		fmt.Printf("%-14s %5d days %9d records %5d checkpoints  %s\n", report.Chain, report.Days, report.Records, report.Checkpoints, status)
+	}
+	if broken {
+		os.Exit(1)
+	}
+}
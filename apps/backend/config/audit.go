@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+// AuditChainConfig controls the checkpoints sealing the audit hash chains
+type AuditChainConfig struct {
+	// CheckpointInterval is how often finished days are checkpointed
+	CheckpointInterval time.Duration
+	// CheckpointGrace is how long after midnight UTC a day stays open for
+	// records still being written
+	CheckpointGrace time.Duration
+	// SignCheckpoints signs checkpoints with the active JWT key
+	SignCheckpoints bool
+}
+
+// AuditChain returns the checkpoint settings from the AUDIT_CHECKPOINT_*
+// variables. Checkpoints are signed by default outside development, since
+// anyone with write access to the database can recompute unkeyed hashes.
+func AuditChain() AuditChainConfig {
+	sign := "true"
+	if IsDevelopment() {
+		sign = "false"
+	}
+	return AuditChainConfig{
+		CheckpointInterval: getEnvDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour),
+		CheckpointGrace:    getEnvDuration("AUDIT_CHECKPOINT_GRACE", time.Hour),
+		SignCheckpoints:    getEnv("AUDIT_CHECKPOINT_SIGN", sign) == "true",
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// ElevationConfig controls just-in-time role elevation requests
+type ElevationConfig struct {
+	// ApproverPermission is the permission, as resource.action, needed to
+	// approve or reject requests
+	ApproverPermission string
+	// MaxDuration is the longest time an elevated role can be held
+	MaxDuration time.Duration
+}
+
+// Elevation returns the elevation settings from the ELEVATION_* variables
+func Elevation() ElevationConfig {
+	return ElevationConfig{
+		ApproverPermission: getEnv("ELEVATION_APPROVER_PERMISSION", "elevations.approve"),
+		MaxDuration:        getEnvDuration("ELEVATION_MAX_DURATION", 8*time.Hour),
+	}
+}
+
+// Approver splits ApproverPermission into its resource and action
+func (ec ElevationConfig) Approver() (resource, action string) {
+	resource, action, _ = strings.Cut(ec.ApproverPermission, ".")
+	return resource, action
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment returns the deployment environment from APP_ENV. When APP_ENV
+// is not set, release builds (GIN_MODE=release) count as production and
+// everything else as development.
+func Environment() string {
+	if env := strings.TrimSpace(os.Getenv("APP_ENV")); env != "" {
+		return strings.ToLower(env)
+	}
+	if os.Getenv("GIN_MODE") == "release" {
+		return "production"
+	}
+	return "development"
+}
+
+// FrontendURL returns the base URL of the web app, used for links in emails
+func FrontendURL() string {
+	return strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/")
+}
+
+// Email verification policies for accounts whose address is not verified yet
+const (
+	// EmailVerificationOff does not restrict unverified accounts
+	EmailVerificationOff = "off"
+	// EmailVerificationRestrict lets unverified accounts log in with only the default role
+	EmailVerificationRestrict = "restrict"
+	// EmailVerificationBlock refuses logins from unverified accounts
+	EmailVerificationBlock = "block"
+)
+
+// EmailVerificationPolicy returns the policy from EMAIL_VERIFICATION_POLICY
+// (default: restrict)
+func EmailVerificationPolicy() string {
+	switch policy := strings.ToLower(os.Getenv("EMAIL_VERIFICATION_POLICY")); policy {
+	case EmailVerificationOff, EmailVerificationBlock:
+		return policy
+	default:
+		return EmailVerificationRestrict
+	}
+}
+
+// RoleSweepInterval returns how often expired role assignments are removed,
+// from ROLE_SWEEP_INTERVAL (default: 1m)
+func RoleSweepInterval() time.Duration {
+	return getEnvDuration("ROLE_SWEEP_INTERVAL", time.Minute)
+}
+
+// IsDevelopment reports whether the server runs in a development environment
+func IsDevelopment() bool {
+	return Environment() == "development"
+}
+
+// ShutdownTimeout returns how long the server waits for in-flight requests
+// and buffered logs on shutdown, from SHUTDOWN_TIMEOUT (default: 15s)
+func ShutdownTimeout() time.Duration {
+	return getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second)
+}
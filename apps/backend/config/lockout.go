@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// LockoutConfig controls how failed logins lock accounts and client IPs
+type LockoutConfig struct {
+	// AccountThreshold is the number of failures after which an account is locked
+	AccountThreshold int
+	// IPThreshold is the number of failures after which a client IP is locked
+	IPThreshold int
+	// BaseDuration is the first lock duration; it doubles with every further failure
+	BaseDuration time.Duration
+	// MaxDuration caps the lock duration
+	MaxDuration time.Duration
+	// Window is how long after the last failure the counter starts over
+	Window time.Duration
+}
+
+// LoginLockout returns the lockout settings from the LOGIN_LOCKOUT_* variables
+func LoginLockout() LockoutConfig {
+	return LockoutConfig{
+		AccountThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		IPThreshold:      getEnvInt("LOGIN_LOCKOUT_IP_THRESHOLD", 20),
+		BaseDuration:     getEnvDuration("LOGIN_LOCKOUT_BASE", 30*time.Second),
+		MaxDuration:      getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+		Window:           getEnvDuration("LOGIN_LOCKOUT_WINDOW", 15*time.Minute),
+	}
+}
+
+// LockDuration returns how long to lock after the given number of failures,
+// or zero when the threshold has not been reached
+func (lc LockoutConfig) LockDuration(failures, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	duration := lc.BaseDuration
+	for i := threshold; i < failures && duration < lc.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > lc.MaxDuration {
+		duration = lc.MaxDuration
+	}
+	return duration
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(getEnv(key, "")); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// Request log overflow policies, applied when the buffer is full
+const (
+	// RequestLogDrop discards the entry and counts it
+	RequestLogDrop = "drop"
+	// RequestLogBlock holds the request until there is room, up to BlockTimeout
+	RequestLogBlock = "block"
+)
+
+// RequestLogConfig controls the buffered request log writer
+type RequestLogConfig struct {
+	// BufferSize is how many entries can wait to be written
+	BufferSize int
+	// BatchSize is how many entries are written at once
+	BatchSize int
+	// FlushInterval is the longest an entry waits for its batch to fill
+	FlushInterval time.Duration
+	// Overflow is RequestLogDrop or RequestLogBlock
+	Overflow string
+	// BlockTimeout is how long RequestLogBlock waits before dropping
+	BlockTimeout time.Duration
+	// RetryAttempts is how many times a failed batch is written again
+	// before its entries count as failed
+	RetryAttempts int
+	// RetryBackoff is the wait before the first retry, doubled for each
+	// following one
+	RetryBackoff time.Duration
+}
+
+// RequestLog returns the request log writer settings from the REQUEST_LOG_*
+// variables
+func RequestLog() RequestLogConfig {
+	overflow := strings.ToLower(getEnv("REQUEST_LOG_OVERFLOW", RequestLogDrop))
+	if overflow != RequestLogBlock {
+		overflow = RequestLogDrop
+	}
+	return RequestLogConfig{
+		BufferSize:    getEnvInt("REQUEST_LOG_BUFFER", 10000),
+		BatchSize:     getEnvInt("REQUEST_LOG_BATCH_SIZE", 500),
+		FlushInterval: getEnvDuration("REQUEST_LOG_FLUSH_INTERVAL", time.Second),
+		Overflow:      overflow,
+		BlockTimeout:  getEnvDuration("REQUEST_LOG_BLOCK_TIMEOUT", 100*time.Millisecond),
+		RetryAttempts: getEnvInt("REQUEST_LOG_RETRIES", 3),
+		RetryBackoff:  getEnvDuration("REQUEST_LOG_RETRY_BACKOFF", 100*time.Millisecond),
+	}
+}
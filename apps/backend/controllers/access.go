@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/policy"
+	"backend/rbac"
+	"backend/tenant"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CanRequest struct {
+	Checks []PermissionCheck `json:"checks" binding:"required,min=1,max=100,dive"`
+	// Explain adds the deciding role and permission, or policy, to each
+	// result; only admins may ask for it
+	Explain bool `json:"explain"`
+}
+
+// PermissionCheck asks whether an action is allowed on a resource, or on
+// one row of it when ResourceID is set
+type PermissionCheck struct {
+	Resource   string     `json:"resource" binding:"required"`
+	Action     string     `json:"action" binding:"required"`
+	ResourceID *uuid.UUID `json:"resource_id"`
+}
+
+type PermissionCheckResult struct {
+	PermissionCheck
+	Allowed bool `json:"allowed"`
+	// Scope is "any", "own" or "" for checks without a resource ID
+	Scope       string         `json:"scope,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Explanation *rbac.Decision `json:"explanation,omitempty"`
+}
+
+// checkTargets load the rows that checks with a resource ID refer to, within
+// the current organization
+var checkTargets = map[string]func(c *gin.Context, id uuid.UUID) (models.Ownable, error){
+	"users": func(c *gin.Context, id uuid.UUID) (models.Ownable, error) {
+		orgID := middleware.CurrentOrganization(c)
+		var user models.User
+		if err := tenant.Members(orgID).Where("users.id = ?", id).First(&user).Error; err != nil {
+			return nil, err
+		}
+		if err := tenant.LoadRoles(&user, orgID); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	},
+}
+
+// Can answers a batch of permission checks for the current user, so the
+// frontend can show only the actions that will succeed
+func (ac *AuthController) Can(c *gin.Context) {
+	var req CanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, err := middleware.CurrentPermissions(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+	if req.Explain && !permissions.ActsAs("admin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Explaining checks requires the admin role"})
+		return
+	}
+
+	user := c.MustGet("user").(models.User)
+	results := make([]PermissionCheckResult, 0, len(req.Checks))
+	for _, check := range req.Checks {
+		result := PermissionCheckResult{PermissionCheck: check}
+
+		var decision rbac.Decision
+		if check.ResourceID == nil {
+			decision = permissions.Decide(check.Resource, check.Action)
+			result.Scope = permissions.Scope(check.Resource, check.Action)
+		} else if load, ok := checkTargets[check.Resource]; !ok {
+			result.Error = "Checks by resource_id are not supported for this resource"
+		} else if target, err := load(c, *check.ResourceID); errors.Is(err, gorm.ErrRecordNotFound) {
+			result.Error = "Resource not found"
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load resource"})
+			return
+		} else {
+			decision = rbac.DecideTarget(&user, permissions, check.Resource, check.Action, target)
+		}
+
+		// Routes guarded by RequirePolicy also need the policies to agree
+		if decision.Allowed && check.ResourceID != nil && middleware.PolicyGated(check.Resource, check.Action) {
+			evaluation, err := middleware.EvaluatePolicy(c, check.Resource, check.Action, check.ResourceID.String())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate policy"})
+				return
+			}
+			if evaluation.Decision != policy.DecisionAllow {
+				decision = rbac.Decision{Reason: "denied by policy"}
+				if evaluation.Policy != "" {
+					decision.Reason += " " + evaluation.Policy
+				}
+			}
+		}
+
+		result.Allowed = decision.Allowed
+		if req.Explain && result.Error == "" {
+			result.Explanation = &decision
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
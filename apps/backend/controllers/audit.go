@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"backend/audit"
+	"backend/middleware"
+	"backend/models"
+	"backend/tenant"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// roleAudit is the audited state of a role, naming its grants and parents
+type roleAudit struct {
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	RequireMFA        bool       `json:"require_mfa"`
+	OrganizationID    *uuid.UUID `json:"organization_id"`
+	Permissions       []string   `json:"permissions"`
+	DeniedPermissions []string   `json:"denied_permissions"`
+	Parents           []string   `json:"parents"`
+}
+
+// roleGrantAudit is the audited state of one role held by a user
+type roleGrantAudit struct {
+	Role      string     `json:"role"`
+	StartsAt  *time.Time `json:"starts_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Reason    string     `json:"reason"`
+}
+
+// elevationAudit is the audited state of an elevation request
+type elevationAudit struct {
+	Role         string     `json:"role"`
+	Status       string     `json:"status"`
+	DecisionNote string     `json:"decision_note"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+// auditSource describes the current request for the audit log. The actor is
+// the authenticated user, if any.
+func auditSource(c *gin.Context) audit.Source {
+	source := audit.Source{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: middleware.CurrentRequestID(c),
+	}
+	if user, exists := c.Get("user"); exists {
+		id := user.(models.User).ID
+		source.ActorID = &id
+	}
+	if orgID, exists := c.Get("organization_id"); exists {
+		id := orgID.(uuid.UUID)
+		source.OrganizationID = &id
+	}
+	return source
+}
+
+// auditSourceAs is auditSource for requests made before the user is
+// authenticated, such as logins and password resets
+func auditSourceAs(c *gin.Context, user *models.User) audit.Source {
+	source := auditSource(c)
+	source.ActorID = &user.ID
+	if source.OrganizationID == nil {
+		source.OrganizationID = user.ActiveOrganizationID
+	}
+	return source
+}
+
+// auditedUser leaves out the roles, which are audited as separate events
+func auditedUser(user models.User) models.User {
+	user.Roles = nil
+	return user
+}
+
+// loadRoleAudit reads the role's audited state within tx
+func loadRoleAudit(tx *gorm.DB, roleID uuid.UUID) (*roleAudit, error) {
+	var role models.Role
+	if err := tx.Where("id = ?", roleID).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	state := &roleAudit{
+		Name:           role.Name,
+		Description:    role.Description,
+		RequireMFA:     role.RequireMFA,
+		OrganizationID: role.OrganizationID,
+	}
+	grants := func(effect string, names *[]string) error {
+		return tx.Table("role_permissions").
+			Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+			Where("role_permissions.role_id = ? AND role_permissions.effect = ?", roleID, effect).
+			Order("permissions.name").
+			Pluck("permissions.name", names).Error
+	}
+	if err := grants(models.EffectAllow, &state.Permissions); err != nil {
+		return nil, err
+	}
+	if err := grants(models.EffectDeny, &state.DeniedPermissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Table("role_parents").
+		Joins("JOIN roles ON roles.id = role_parents.parent_id AND roles.deleted_at IS NULL").
+		Where("role_parents.role_id = ?", roleID).
+		Order("roles.name").
+		Pluck("roles.name", &state.Parents).Error; err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// heldRoleNames returns the names of the roles the user holds in the
+// organization within tx, including assignments not in effect yet
+func heldRoleNames(tx *gorm.DB, orgID, userID uuid.UUID) ([]string, error) {
+	names := []string{}
+	err := tx.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.organization_id = ? AND user_roles.user_id = ?", orgID, userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// findRoleGrant returns the user's assignment of the role within tx, or nil
+// when the user does not hold it
+func findRoleGrant(tx *gorm.DB, orgID, userID uuid.UUID, role models.Role) (*roleGrantAudit, error) {
+	var assignment models.UserRole
+	err := tx.Where("organization_id = ? AND user_id = ? AND role_id = ?", orgID, userID, role.ID).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &roleGrantAudit{
+		Role:      role.Name,
+		StartsAt:  assignment.StartsAt,
+		ExpiresAt: assignment.ExpiresAt,
+		Reason:    assignment.Reason,
+	}, nil
+}
+
+// setUserRoles replaces the user's roles in the organization within tx and
+// records the change
+func setUserRoles(c *gin.Context, tx *gorm.DB, orgID, userID uuid.UUID, roles []models.Role, assignment tenant.Assignment) error {
+	before, err := heldRoleNames(tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := tenant.AssignRoles(tx, orgID, userID, roles, assignment); err != nil {
+		return err
+	}
+	after, err := heldRoleNames(tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	return audit.Record(tx, auditSource(c), audit.Change{
+		Action:     audit.UserRolesSet,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Before:     gin.H{"roles": before},
+		After: gin.H{
+			"roles":      after,
+			"starts_at":  assignment.StartsAt,
+			"expires_at": assignment.ExpiresAt,
+			"reason":     assignment.Reason,
+		},
+	})
+}
+
+// recordRoleGrant records that the user was given the role in the
+// organization within tx
+func recordRoleGrant(tx *gorm.DB, source audit.Source, orgID, userID uuid.UUID, role models.Role) error {
+	after, err := findRoleGrant(tx, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	source.OrganizationID = &orgID
+	return audit.Record(tx, source, audit.Change{
+		Action:     audit.UserRoleGranted,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		After:      after,
+	})
+}
+
+// recordElevationDecision records the decision on an elevation request
+// within tx, and the role it granted when approved
+func recordElevationDecision(c *gin.Context, tx *gorm.DB, role models.Role, request *models.ElevationRequest) error {
+	source := auditSource(c)
+	source.OrganizationID = &request.OrganizationID
+
+	action := audit.ElevationRejected
+	if request.Status == models.ElevationApproved {
+		action = audit.ElevationApproved
+	}
+	err := audit.Record(tx, source, audit.Change{
+		Action:     action,
+		TargetType: audit.TargetElevation,
+		TargetID:   request.ID,
+		Before:     elevationAudit{Role: role.Name, Status: models.ElevationPending},
+		After: elevationAudit{
+			Role:         role.Name,
+			Status:       request.Status,
+			DecisionNote: request.DecisionNote,
+			ExpiresAt:    request.ExpiresAt,
+		},
+	})
+	if err != nil || action != audit.ElevationApproved {
+		return err
+	}
+	return recordRoleGrant(tx, source, request.OrganizationID, request.UserID, role)
+}
@@ -1,21 +1,39 @@
 package controllers
 
 import (
+	"backend/audit"
 	"backend/config"
+	"backend/mailer"
 	"backend/middleware"
 	"backend/models"
+	"backend/rbac"
+	"backend/tenant"
 	"backend/utils"
+	"errors"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthController struct{}
 
+// dummyPasswordHash is compared against for unknown users so that a login
+// takes as long whether or not the account exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// OrganizationID picks the organization to sign in to; by default the
+	// one the user worked in last
+	OrganizationID *uuid.UUID `json:"organization_id"`
 }
 
 type RegisterRequest struct {
@@ -35,6 +53,39 @@ type AuthResponse struct {
 	RefreshToken string      `json:"refresh_token"`
 	ExpiresAt    int64       `json:"expires_at"`
 	User         models.User `json:"user"`
+	// MFAEnrollmentRequired is set when the user's roles require MFA; they
+	// stay inactive until enrollment is confirmed
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+// MFAChallengeResponse is returned by Login instead of AuthResponse when a
+// second factor is required
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
 }
 
 // Register creates a new user account
@@ -69,33 +120,56 @@ func (ac *AuthController) Register(c *gin.Context) {
 		IsActive:  true,
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	// Join the default organization with the default user role
+	user.ActiveOrganizationID = &models.DefaultOrganizationID
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tenant.AddMember(tx, models.DefaultOrganizationID, user.ID, nil); err != nil {
+			return err
+		}
+		var userRole models.Role
+		if err := tx.Where("name = ? AND organization_id IS NULL", models.DefaultRoleName).First(&userRole).Error; err == nil {
+			if err := tenant.AddRoles(tx, models.DefaultOrganizationID, user.ID, []models.Role{userRole}, tenant.Assignment{AssignedBy: user.ID}); err != nil {
+				return err
+			}
+		}
+		return audit.Record(tx, auditSourceAs(c, &user), audit.Change{
+			Action:     audit.AuthRegistered,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			After:      auditedUser(user),
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// Assign default user role
-	var userRole models.Role
-	if err := config.DB.Where("name = ?", "user").First(&userRole).Error; err == nil {
-		config.DB.Model(&user).Association("Roles").Append(&userRole)
+	// Load user with roles for response
+	if err := enterOrganization(&user, models.DefaultOrganizationID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
 	}
 
-	// Load user with roles for response
-	config.DB.Preload("Roles.Permissions").Where("id = ?", user.ID).First(&user)
+	// Ask the user to confirm the address they typed
+	policy := config.EmailVerificationPolicy()
+	if policy != config.EmailVerificationOff {
+		if err := utils.SendVerificationEmail(&user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+	}
 
-	// Generate token pair
-	tokenPair, err := utils.GenerateTokenPair(&user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+	if policy == config.EmailVerificationBlock {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Account created. Please verify your email address before logging in.",
+			"user":    user,
+		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    tokenPair.ExpiresAt,
-		User:         user,
-	})
+	respondWithTokens(c, http.StatusCreated, &user)
 }
 
 // Login authenticates a user and returns JWT tokens
@@ -108,45 +182,258 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	// Find user
 	var user models.User
-	if err := config.DB.Preload("Roles.Permissions").Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
-		// Log failed login attempt
-		middleware.LogFailedLogin(c.ClientIP(), req.Username, c.Request.UserAgent())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	found := config.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error == nil
+
+	var accountKey string
+	if found {
+		accountKey = middleware.AccountLockoutKey(req.Username, &user)
+	} else {
+		accountKey = middleware.AccountLockoutKey(req.Username, nil)
+	}
+
+	// Refuse attempts while the account or client IP is locked
+	if wait := middleware.LoginLockoutRemaining(c.ClientIP(), accountKey); wait > 0 {
+		respondLoginLocked(c, wait)
 		return
 	}
 
-	// Check if user is active
-	if !user.IsActive {
-		middleware.LogFailedLogin(c.ClientIP(), req.Username, c.Request.UserAgent())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+	if !found {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		middleware.RecordFailedLogin(c.ClientIP(), accountKey, req.Username, c.Request.UserAgent(), middleware.FailureUnknownUser, nil)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		middleware.LogFailedLogin(c.ClientIP(), req.Username, c.Request.UserAgent())
+		middleware.RecordFailedLogin(c.ClientIP(), accountKey, req.Username, c.Request.UserAgent(), middleware.FailureInvalidPassword, &user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Disabled accounts get the same response as a wrong password
+	if !user.IsActive {
+		middleware.RecordFailedLogin(c.ClientIP(), accountKey, req.Username, c.Request.UserAgent(), middleware.FailureAccountDisabled, &user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate token pair
-	tokenPair, err := utils.GenerateTokenPair(&user)
+	// Unverified addresses cannot log in under the block policy
+	if utils.EmailVerificationBlocks(&user) {
+		respondEmailNotVerified(c)
+		return
+	}
+
+	// Sign in to the requested organization, or the last one used. The
+	// choice is remembered for the MFA step and the next login.
+	var requested uuid.UUID
+	if req.OrganizationID != nil {
+		if !tenant.IsMember(*req.OrganizationID, user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+			return
+		}
+		requested = *req.OrganizationID
+	}
+	if err := enterOrganization(&user, requested); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	// Require a second factor before issuing tokens; failed codes keep
+	// counting against the account until the login completes
+	if user.MFAEnabled {
+		respondWithMFAChallenge(c, &user, utils.MFAPurposeVerify)
+		return
+	}
+
+	middleware.ResetLoginFailures(accountKey)
+
+	respondWithTokens(c, http.StatusOK, &user)
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code
+func (ac *AuthController) VerifyMFA(c *gin.Context) {
+	var req VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.ValidateMFAChallengeToken(req.MFAToken, utils.MFAPurposeVerify)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("id = ?", claims.UserID).First(&user).Error; err != nil || !user.IsActive || !user.MFAEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if utils.EmailVerificationBlocks(&user) {
+		respondEmailNotVerified(c)
+		return
+	}
+	if err := enterOrganization(&user, uuid.Nil); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	accountKey := middleware.AccountLockoutKey(user.Username, &user)
+	if wait := middleware.LoginLockoutRemaining(c.ClientIP(), accountKey); wait > 0 {
+		respondLoginLocked(c, wait)
+		return
+	}
+
+	if !verifyMFACode(&user, req.Code) {
+		middleware.RecordFailedLogin(c.ClientIP(), accountKey, user.Username, c.Request.UserAgent(), middleware.FailureInvalidMFACode, &user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	middleware.ResetLoginFailures(accountKey)
+
+	respondWithTokens(c, http.StatusOK, &user)
+}
+
+// VerifyEmail marks the user's email address as verified
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := utils.ConsumeEmailVerificationToken(tx, req.Token)
+		if err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSourceAs(c, &models.User{ID: token.UserID}), audit.Change{
+			Action:     audit.AuthEmailVerified,
+			TargetType: audit.TargetUser,
+			TargetID:   token.UserID,
+		})
+	})
+	if errors.Is(err, utils.ErrInvalidVerificationToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends another verification email. The response is the
+// same whether or not the address belongs to an unverified account, and
+// requests over the throttle limit are silently ignored.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("email = ? AND email_verified_at IS NULL AND is_active = ?", req.Email, true).First(&user).Error; err == nil {
+		if utils.VerificationResendWait(&user) == 0 {
+			if err := utils.SendVerificationEmail(&user); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If this address needs verification, a new email has been sent"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address belongs to an account, and so is the work done
+// before it: the token is issued in the background.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    tokenPair.ExpiresAt,
-		User:         user,
+	var user models.User
+	if err := config.DB.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err == nil {
+		go sendPasswordReset(user, c.ClientIP())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, a reset link has been sent"})
+}
+
+// sendPasswordReset issues a reset token and emails the link to the user
+func sendPasswordReset(user models.User, ip string) {
+	token, err := utils.CreatePasswordResetToken(user.ID, ip)
+	if err != nil {
+		log.Printf("Failed to create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	link := config.FrontendURL() + "/reset-password?token=" + url.QueryEscape(token)
+	mailer.SendAsync(mailer.PasswordResetMessage(user.Email, displayName(&user), link))
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var resetToken *models.PasswordResetToken
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		resetToken, err = utils.ConsumePasswordResetToken(tx, req.Token)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", resetToken.UserID).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		// Sessions opened with the old password must not survive the reset
+		if err := utils.RevokeAllUserRefreshTokens(tx, resetToken.UserID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditSourceAs(c, &models.User{ID: resetToken.UserID}), audit.Change{
+			Action:     audit.AuthPasswordReset,
+			TargetType: audit.TargetUser,
+			TargetID:   resetToken.UserID,
+		})
 	})
+	if errors.Is(err, utils.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
 }
 
 // Me returns current user information
 func (ac *AuthController) Me(c *gin.Context) {
-	user, _ := c.Get("user")
+	user := c.MustGet("user").(models.User)
+	rbac.SeparateDenied(user.Roles)
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
@@ -159,8 +446,15 @@ func (ac *AuthController) GetMenuAccess(c *gin.Context) {
 	}
 
 	user := userInterface.(models.User)
-	menuAccess := utils.GetUserMenuAccess(&user)
-	featureAccess := utils.GetUserFeatureAccess(&user)
+	featureAccess, ok := currentFeatures(c)
+	if !ok {
+		return
+	}
+	menuAccess, err := utils.GetUserMenuAccess(&user, featureAccess)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load menus"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"menus":    menuAccess,
@@ -178,8 +472,18 @@ func (ac *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
-	// Revoke the refresh token
-	utils.RevokeRefreshToken(req.RefreshToken)
+	// Revoke the refresh token; an unknown token needs no revoking
+	user := c.MustGet("user").(models.User)
+	config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := utils.RevokeRefreshToken(tx, req.RefreshToken); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.AuthLogout,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+		})
+	})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -192,8 +496,16 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Generate new token pair
-	tokenPair, err := utils.RefreshAccessToken(req.RefreshToken)
+	// Rotate refresh token and generate new token pair
+	tokenPair, err := utils.RefreshAccessToken(req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, utils.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, please log in again"})
+		return
+	}
+	if errors.Is(err, utils.ErrEmailNotVerified) {
+		respondEmailNotVerified(c)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
 		return
@@ -217,10 +529,120 @@ func (ac *AuthController) LogoutAll(c *gin.Context) {
 	user := userInterface.(models.User)
 
 	// Revoke all refresh tokens for this user
-	if err := utils.RevokeAllUserRefreshTokens(user.ID); err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := utils.RevokeAllUserRefreshTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.AuthLogoutAll,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout from all devices"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices successfully"})
 }
+
+// respondWithTokens starts a session for the user and writes an AuthResponse
+func respondWithTokens(c *gin.Context, status int, user *models.User) {
+	tokenPair, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+	enrollmentRequired := middleware.RestrictSession(user)
+	rbac.SeparateDenied(user.Roles)
+
+	c.JSON(status, AuthResponse{
+		AccessToken:           tokenPair.AccessToken,
+		RefreshToken:          tokenPair.RefreshToken,
+		ExpiresAt:             tokenPair.ExpiresAt,
+		User:                  *user,
+		MFAEnrollmentRequired: enrollmentRequired,
+	})
+}
+
+// startSession issues a token pair for the user and records the login
+func startSession(c *gin.Context, user *models.User) (*utils.TokenPair, error) {
+	var tokenPair *utils.TokenPair
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if tokenPair, err = utils.GenerateTokenPair(tx, user); err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSourceAs(c, user), audit.Change{
+			Action:     audit.AuthLogin,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+		})
+	})
+	return tokenPair, err
+}
+
+// respondLoginLocked refuses a login attempt while the account or client IP is
+// locked. The message is the same for existing and unknown accounts.
+func respondLoginLocked(c *gin.Context, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Please try again later."})
+}
+
+// respondEmailNotVerified refuses a session to an account the block policy
+// keeps out until its address is verified
+func respondEmailNotVerified(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":                       "Email address not verified",
+		"email_verification_required": true,
+	})
+}
+
+// respondWithMFAChallenge writes a challenge token for the second login step
+func respondWithMFAChallenge(c *gin.Context, user *models.User, purpose string) {
+	mfaToken, expiresAt, err := utils.GenerateMFAChallengeToken(user, purpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate MFA challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresAt:   expiresAt.Unix(),
+	})
+}
+
+// verifyMFACode accepts either a current TOTP code or an unused recovery code
+func verifyMFACode(user *models.User, code string) bool {
+	secret, err := utils.DecryptMFASecret(user.MFASecret)
+	if err != nil {
+		return false
+	}
+
+	if step, ok := utils.ValidateTOTPCode(secret, code, user.MFALastStep, time.Now()); ok {
+		// Only one request may consume a given time step
+		result := config.DB.Model(&models.User{}).
+			Where("id = ? AND mfa_last_step < ?", user.ID, step).
+			Update("mfa_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return utils.UseRecoveryCode(user.ID, code)
+}
+
+// JWKS publishes the public keys used to verify access tokens
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
+
+// displayName returns the name used to greet a user in emails
+func displayName(user *models.User) string {
+	if user.FirstName != "" {
+		return user.FirstName
+	}
+	return user.Username
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"backend/testdb"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var resetLinkToken = regexp.MustCompile(`token=(\S+)`)
+
+func TestPasswordResetFlow(t *testing.T) {
+	config.DB = testdb.Open(t)
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("TOKEN_HASH_KEY", "test-token-hash-key")
+	if err := utils.InitKeys(); err != nil {
+		t.Fatal(err)
+	}
+	mail := &mailer.MemoryMailer{}
+	mailer.Default = mail
+	t.Cleanup(func() { mailer.Default = nil })
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: "reset", Email: "reset@example.com", Password: string(hashed), IsActive: true}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ac := &AuthController{}
+	r.POST("/forgot-password", ac.ForgotPassword)
+	r.POST("/reset-password", ac.ResetPassword)
+
+	// Unknown and known addresses get the same answer, but only one email
+	for _, email := range []string{"nobody@example.com", user.Email} {
+		if w := postJSON(r, "/forgot-password", gin.H{"email": email}); w.Code != http.StatusOK {
+			t.Fatalf("forgot-password for %s = %d, want 200", email, w.Code)
+		}
+	}
+	msg := waitForMessage(t, mail)
+	if len(msg.To) != 1 || msg.To[0] != user.Email {
+		t.Fatalf("reset email sent to %v, want %s", msg.To, user.Email)
+	}
+	if got := len(mail.Messages()); got != 1 {
+		t.Fatalf("%d emails sent, want 1", got)
+	}
+
+	match := resetLinkToken.FindStringSubmatch(msg.Text)
+	if match == nil {
+		t.Fatalf("no reset link in email:\n%s", msg.Text)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postJSON(r, "/reset-password", gin.H{"token": token, "password": "new-password"}); w.Code != http.StatusOK {
+		t.Fatalf("reset-password = %d, want 200: %s", w.Code, w.Body)
+	}
+	var updated models.User
+	if err := config.DB.First(&updated, "id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(updated.Password), []byte("new-password")) != nil {
+		t.Fatal("password was not changed")
+	}
+
+	// Tokens are single use
+	if w := postJSON(r, "/reset-password", gin.H{"token": token, "password": "other-password"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("second reset-password = %d, want 400", w.Code)
+	}
+}
+
+func postJSON(r http.Handler, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// waitForMessage waits for the first email, which is sent in the background
+func waitForMessage(t *testing.T, mail *mailer.MemoryMailer) mailer.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := mail.Messages(); len(messages) > 0 {
+			return messages[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no email was sent")
+	return mailer.Message{}
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/tenant"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ElevationController struct{}
+
+type CreateElevationRequest struct {
+	RoleID        uuid.UUID `json:"role_id" binding:"required"`
+	Duration      string    `json:"duration" binding:"required"` // e.g. "2h"
+	Justification string    `json:"justification" binding:"required"`
+}
+
+type DecideElevationRequest struct {
+	Note string `json:"note"`
+}
+
+// GetElevations returns elevation requests in the current organization.
+// Approvers see everyone's requests, other users only their own.
+func (ec *ElevationController) GetElevations(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	var requests []models.ElevationRequest
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.ElevationRequest{}).Where("organization_id = ?", middleware.CurrentOrganization(c))
+	if !isElevationApprover(c) {
+		query = query.Where("user_id = ?", user.ID)
+	}
+
+	// Filter by status
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Preload("User").Preload("Role").Order("created_at DESC").Offset(offset).Limit(limit).Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch elevation requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetElevation returns an elevation request with its history
+func (ec *ElevationController) GetElevation(c *gin.Context) {
+	request, ok := findElevation(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(models.User)
+	if request.UserID != user.ID && !isElevationApprover(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Elevation request not found"})
+		return
+	}
+
+	var events []models.ElevationEvent
+	config.DB.Where("request_id = ?", request.ID).Order("created_at").Find(&events)
+
+	c.JSON(http.StatusOK, gin.H{"request": request, "events": events})
+}
+
+// CreateElevation requests a role in the current organization for a limited time
+func (ec *ElevationController) CreateElevation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	orgID := middleware.CurrentOrganization(c)
+
+	var req CreateElevationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxDuration := config.Elevation().MaxDuration
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration < time.Minute || duration > maxDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Duration must be between 1m and " + maxDuration.String()})
+		return
+	}
+	justification := strings.TrimSpace(req.Justification)
+	if justification == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Justification is required"})
+		return
+	}
+
+	var role models.Role
+	if err := tenant.Roles(orgID).Where("id = ?", req.RoleID).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var held int64
+	config.DB.Model(&models.UserRole{}).
+		Where("user_id = ? AND role_id = ? AND organization_id = ? AND expires_at IS NULL", user.ID, role.ID, orgID).
+		Count(&held)
+	if held > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already hold this role"})
+		return
+	}
+
+	var pending int64
+	config.DB.Model(&models.ElevationRequest{}).
+		Where("user_id = ? AND role_id = ? AND organization_id = ? AND status = ?", user.ID, role.ID, orgID, models.ElevationPending).
+		Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request for this role is already pending"})
+		return
+	}
+
+	request, err := utils.RequestElevation(&user, orgID, &role, duration, justification)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create elevation request"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"request": request})
+}
+
+// ApproveElevation grants the requested role for the requested duration
+func (ec *ElevationController) ApproveElevation(c *gin.Context) {
+	decideElevation(c, true)
+}
+
+// RejectElevation turns a request down
+func (ec *ElevationController) RejectElevation(c *gin.Context) {
+	decideElevation(c, false)
+}
+
+// CancelElevation withdraws one of the current user's pending requests
+func (ec *ElevationController) CancelElevation(c *gin.Context) {
+	request, ok := findElevation(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(models.User)
+	if request.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can cancel a request"})
+		return
+	}
+
+	if err := utils.CancelElevation(request.ID, &user); err != nil {
+		respondElevationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Elevation request cancelled"})
+}
+
+func decideElevation(c *gin.Context, approve bool) {
+	request, ok := findElevation(c)
+	if !ok {
+		return
+	}
+
+	var req DecideElevationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Approvers can only hand out roles they hold, and never to themselves
+	approver := c.MustGet("user").(models.User)
+	if request.UserID == approver.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot decide your own request"})
+		return
+	}
+	if approve {
+		if !authorizeRoleAssignment(c, []models.Role{*request.Role}) {
+			return
+		}
+		if !tenant.IsMember(request.OrganizationID, request.UserID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Requester is no longer a member of the organization"})
+			return
+		}
+	}
+
+	decided, err := utils.DecideElevation(request.ID, &approver, approve, strings.TrimSpace(req.Note), func(tx *gorm.DB, decided *models.ElevationRequest) error {
+		return recordElevationDecision(c, tx, *request.Role, decided)
+	})
+	if err != nil {
+		respondElevationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"request": decided})
+}
+
+// findElevation loads the request named by :id in the current organization
+func findElevation(c *gin.Context) (models.ElevationRequest, bool) {
+	var request models.ElevationRequest
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid elevation request ID"})
+		return request, false
+	}
+	if err := config.DB.Preload("User").Preload("Role").
+		Where("id = ? AND organization_id = ?", id, middleware.CurrentOrganization(c)).
+		First(&request).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Elevation request not found"})
+		return request, false
+	}
+	return request, true
+}
+
+// isElevationApprover reports whether the current user may decide elevation requests
+func isElevationApprover(c *gin.Context) bool {
+	permissions, err := middleware.CurrentPermissions(c)
+	if err != nil {
+		return false
+	}
+	return permissions.Allows(config.Elevation().Approver())
+}
+
+func respondElevationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrElevationNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "Elevation request is no longer pending"})
+	case errors.Is(err, utils.ErrRoleAlreadyHeld):
+		c.JSON(http.StatusConflict, gin.H{"error": "Requester already has an assignment of this role"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update elevation request"})
+	}
+}
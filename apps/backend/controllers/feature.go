@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/features"
+	"backend/middleware"
+	"backend/models"
+	"backend/rbac"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type FeatureController struct{}
+
+type FeatureFlagRequest struct {
+	Name            string          `json:"name" binding:"required"`
+	Description     string          `json:"description"`
+	DefaultOn       bool            `json:"default_on"`
+	Environments    map[string]bool `json:"environments"`
+	Roles           []string        `json:"roles"`
+	UserIDs         []uuid.UUID     `json:"user_ids"`
+	OrganizationIDs []uuid.UUID     `json:"organization_ids"`
+	Percentage      int             `json:"percentage" binding:"min=0,max=100"`
+}
+
+// GetFeatures returns the feature flags that are on or off for the current user
+func (ac *AuthController) GetFeatures(c *gin.Context) {
+	enabled, ok := currentFeatures(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"features": enabled})
+}
+
+// GetFeatureFlags returns every feature flag
+func (fc *FeatureController) GetFeatureFlags(c *gin.Context) {
+	var flags []models.FeatureFlag
+	if err := config.DB.Order("name").Find(&flags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feature flags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
+
+// GetFeatureFlag returns a feature flag. Pass user_id to see how it is
+// evaluated for a member of the current organization.
+func (fc *FeatureController) GetFeatureFlag(c *gin.Context) {
+	flag, ok := findFeatureFlag(c)
+	if !ok {
+		return
+	}
+
+	response := gin.H{"flag": flag}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		user, ok := findMember(c, id)
+		if !ok {
+			return
+		}
+		permissions, err := rbac.ForUser(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			return
+		}
+		subject := middleware.FeatureSubject(&user, middleware.CurrentOrganization(c), permissions)
+		response["evaluation"] = features.Evaluate(flag, subject, config.Environment())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateFeatureFlag adds a feature flag
+func (fc *FeatureController) CreateFeatureFlag(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	var req FeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var flag models.FeatureFlag
+	if !applyFeatureFlagRequest(c, &flag, &req) {
+		return
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.FeatureFlag{}).Where("name = ?", flag.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Feature flag name already exists"})
+		return
+	}
+
+	if err := config.DB.Create(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feature flag"})
+		return
+	}
+	features.Invalidate()
+
+	c.JSON(http.StatusCreated, gin.H{"flag": flag})
+}
+
+// UpdateFeatureFlag replaces a feature flag
+func (fc *FeatureController) UpdateFeatureFlag(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	flag, ok := findFeatureFlag(c)
+	if !ok {
+		return
+	}
+
+	var req FeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != flag.Name {
+		var count int64
+		config.DB.Unscoped().Model(&models.FeatureFlag{}).Where("name = ?", req.Name).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Feature flag name already exists"})
+			return
+		}
+	}
+	if !applyFeatureFlagRequest(c, &flag, &req) {
+		return
+	}
+
+	if err := config.DB.Save(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feature flag"})
+		return
+	}
+	features.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"flag": flag})
+}
+
+// DeleteFeatureFlag deletes a feature flag, turning it off for everyone
+func (fc *FeatureController) DeleteFeatureFlag(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	flag, ok := findFeatureFlag(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feature flag"})
+		return
+	}
+	features.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feature flag deleted successfully"})
+}
+
+func findFeatureFlag(c *gin.Context) (models.FeatureFlag, bool) {
+	var flag models.FeatureFlag
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feature flag ID"})
+		return flag, false
+	}
+	if err := config.DB.Where("id = ?", id).First(&flag).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag not found"})
+		return flag, false
+	}
+	return flag, true
+}
+
+// applyFeatureFlagRequest validates the request and copies it onto the flag
+func applyFeatureFlagRequest(c *gin.Context, flag *models.FeatureFlag, req *FeatureFlagRequest) bool {
+	if !slugPattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Feature flag name may only contain lowercase letters, digits and dashes"})
+		return false
+	}
+
+	flag.Name = req.Name
+	flag.Description = req.Description
+	flag.DefaultOn = req.DefaultOn
+	flag.Environments = models.JSONMap{}
+	for environment, on := range req.Environments {
+		flag.Environments[environment] = on
+	}
+	flag.Roles = models.JSONList(req.Roles)
+	if flag.Roles == nil {
+		flag.Roles = models.JSONList{}
+	}
+	flag.UserIDs = uuidList(req.UserIDs)
+	flag.OrganizationIDs = uuidList(req.OrganizationIDs)
+	flag.Percentage = req.Percentage
+	return true
+}
+
+func uuidList(ids []uuid.UUID) models.JSONList {
+	list := make(models.JSONList, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, id.String())
+	}
+	return list
+}
+
+// currentFeatures evaluates every feature flag for the current user,
+// responding with 500 on failure
+func currentFeatures(c *gin.Context) (map[string]bool, bool) {
+	subject, err := middleware.CurrentFeatureSubject(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return nil, false
+	}
+	enabled, err := features.EvaluateAll(subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate feature flags"})
+		return nil, false
+	}
+	return enabled, true
+}
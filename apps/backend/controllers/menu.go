@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type MenuController struct{}
+
+type MenuRequest struct {
+	ParentID   *uuid.UUID `json:"parent_id"`
+	Name       string     `json:"name" binding:"required"`
+	Label      string     `json:"label" binding:"required"`
+	Icon       string     `json:"icon"`
+	Path       string     `json:"path"`
+	Permission string     `json:"permission" binding:"required"`
+	Feature    string     `json:"feature"`
+	SortOrder  int        `json:"sort_order"`
+}
+
+// GetMenus returns every menu, in order, with parents before their children
+func (mc *MenuController) GetMenus(c *gin.Context) {
+	var menus []models.Menu
+	if err := config.DB.Order("parent_id NULLS FIRST, sort_order, name").Find(&menus).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch menus"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"menus": menus})
+}
+
+// GetMenu returns a menu
+func (mc *MenuController) GetMenu(c *gin.Context) {
+	menu, ok := findMenu(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"menu": menu})
+}
+
+// CreateMenu adds a menu
+func (mc *MenuController) CreateMenu(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	var req MenuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var menu models.Menu
+	if !applyMenuRequest(c, &menu, &req) {
+		return
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.Menu{}).Where("name = ?", menu.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Menu name already exists"})
+		return
+	}
+
+	if err := config.DB.Create(&menu).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create menu"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"menu": menu})
+}
+
+// UpdateMenu replaces a menu
+func (mc *MenuController) UpdateMenu(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	menu, ok := findMenu(c)
+	if !ok {
+		return
+	}
+
+	var req MenuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != menu.Name {
+		var count int64
+		config.DB.Unscoped().Model(&models.Menu{}).Where("name = ?", req.Name).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Menu name already exists"})
+			return
+		}
+	}
+	if !applyMenuRequest(c, &menu, &req) {
+		return
+	}
+
+	if err := config.DB.Save(&menu).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update menu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"menu": menu})
+}
+
+// DeleteMenu deletes a menu without children
+func (mc *MenuController) DeleteMenu(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	menu, ok := findMenu(c)
+	if !ok {
+		return
+	}
+
+	var children int64
+	config.DB.Model(&models.Menu{}).Where("parent_id = ?", menu.ID).Count(&children)
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete a menu that has child menus"})
+		return
+	}
+
+	if err := config.DB.Delete(&menu).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete menu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Menu deleted successfully"})
+}
+
+func findMenu(c *gin.Context) (models.Menu, bool) {
+	var menu models.Menu
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid menu ID"})
+		return menu, false
+	}
+	if err := config.DB.Where("id = ?", id).First(&menu).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu not found"})
+		return menu, false
+	}
+	return menu, true
+}
+
+// applyMenuRequest validates the request and copies it onto the menu. The
+// permission must exist, and the parent must not be the menu or nested under it.
+func applyMenuRequest(c *gin.Context, menu *models.Menu, req *MenuRequest) bool {
+	if !slugPattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Menu name may only contain lowercase letters, digits and dashes"})
+		return false
+	}
+
+	var count int64
+	config.DB.Model(&models.Permission{}).Where("name = ?", req.Permission).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission not found"})
+		return false
+	}
+
+	for parentID := req.ParentID; parentID != nil; {
+		if menu.ID != uuid.Nil && *parentID == menu.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A menu cannot be nested under itself"})
+			return false
+		}
+		var parent models.Menu
+		if err := config.DB.Where("id = ?", *parentID).First(&parent).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent menu not found"})
+			return false
+		}
+		parentID = parent.ParentID
+	}
+
+	menu.ParentID = req.ParentID
+	menu.Name = req.Name
+	menu.Label = req.Label
+	menu.Icon = req.Icon
+	menu.Path = req.Path
+	menu.Permission = req.Permission
+	menu.Feature = req.Feature
+	menu.SortOrder = req.SortOrder
+	return true
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+	"backend/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type MFAController struct{}
+
+type ConfirmMFARequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// Enroll generates a new TOTP secret awaiting confirmation
+func (mc *MFAController) Enroll(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate MFA secret"})
+		return
+	}
+
+	encrypted, err := utils.EncryptMFASecret(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store MFA secret"})
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("mfa_pending", encrypted).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store MFA secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(utils.MFAIssuer(), user.Email, secret),
+	})
+}
+
+// Confirm activates the pending TOTP secret once the user proves they can generate codes
+func (mc *MFAController) Confirm(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req ConfirmMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	if user.MFAPending == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No MFA enrollment in progress"})
+		return
+	}
+
+	secret, err := utils.DecryptMFASecret(user.MFAPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read MFA secret"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTPCode(secret, req.Code, 0, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	var recoveryCodes []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_enabled":   true,
+			"mfa_secret":    user.MFAPending,
+			"mfa_pending":   "",
+			"mfa_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		if recoveryCodes, err = utils.GenerateRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+		return recordMFAChange(c, tx, &user, audit.AuthMFAEnabled)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable MFA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// Disable turns MFA off after re-checking the password and a current code
+func (mc *MFAController) Disable(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	if utils.UserRequiresMFA(&user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "MFA is required for one of your roles"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if !verifyMFACode(&user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_enabled":   false,
+			"mfa_secret":    "",
+			"mfa_pending":   "",
+			"mfa_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return recordMFAChange(c, tx, &user, audit.AuthMFADisabled)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable MFA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled successfully"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req ConfirmMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	if !verifyMFACode(&user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	var recoveryCodes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if recoveryCodes, err = utils.GenerateRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+		return recordMFAChange(c, tx, &user, audit.AuthRecoveryCodesRegenerated)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// recordMFAChange records a change to the user's second factor within tx.
+// Enrollment during login happens before the user has a session.
+func recordMFAChange(c *gin.Context, tx *gorm.DB, user *models.User, action string) error {
+	return audit.Record(tx, auditSourceAs(c, user), audit.Change{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+	})
+}
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"backend/audit"
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/rbac"
+	"backend/tenant"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type OrganizationController struct{}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"` // derived from the name when empty
+}
+
+type InviteMemberRequest struct {
+	Email  string    `json:"email" binding:"required,email"`
+	RoleID uuid.UUID `json:"role_id" binding:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// GetOrganizations returns the organizations the current user belongs to
+func (oc *OrganizationController) GetOrganizations(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	orgs, err := tenant.Organizations(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs, "current": middleware.CurrentOrganization(c)})
+}
+
+// GetCurrentOrganization returns the organization the request acts in and
+// the current user's roles there
+func (oc *OrganizationController) GetCurrentOrganization(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var org models.Organization
+	if err := config.DB.Where("id = ?", middleware.CurrentOrganization(c)).First(&org).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	var members int64
+	tenant.Members(org.ID).Count(&members)
+	rbac.SeparateDenied(user.Roles)
+
+	c.JSON(http.StatusOK, gin.H{"organization": org, "roles": user.Roles, "members": members})
+}
+
+// CreateOrganization creates an organization owned by the current user
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slug := req.Slug
+	if slug == "" {
+		slug = strings.Trim(slugSeparator.ReplaceAllString(strings.ToLower(req.Name), "-"), "-")
+	}
+	if !slugPattern.MatchString(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug may only contain lowercase letters, digits and dashes"})
+		return
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.Organization{}).Where("slug = ?", slug).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization slug already exists"})
+		return
+	}
+
+	var owner models.Role
+	if err := config.DB.Where("name = ? AND organization_id IS NULL", models.OwnerRoleName).First(&owner).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Owner role is not defined"})
+		return
+	}
+
+	org := models.Organization{Name: req.Name, Slug: slug, CreatedBy: &user.ID}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		if err := tenant.AddMember(tx, org.ID, user.ID, nil); err != nil {
+			return err
+		}
+		if err := tenant.AddRoles(tx, org.ID, user.ID, []models.Role{owner}, tenant.Assignment{AssignedBy: user.ID}); err != nil {
+			return err
+		}
+
+		source := auditSource(c)
+		source.OrganizationID = &org.ID
+		err := audit.Record(tx, source, audit.Change{
+			Action:     audit.OrganizationCreated,
+			TargetType: audit.TargetOrganization,
+			TargetID:   org.ID,
+			After:      org,
+		})
+		if err != nil {
+			return err
+		}
+		return recordRoleGrant(tx, source, org.ID, user.ID, owner)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"organization": org})
+}
+
+// SwitchOrganization issues a token pair acting in another organization
+// the current user belongs to
+func (oc *OrganizationController) SwitchOrganization(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+	if !tenant.IsMember(orgID, user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+		return
+	}
+
+	// The roles held there may require a second factor
+	target := user
+	if err := tenant.LoadRoles(&target, orgID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
+	}
+	if !target.MFAEnabled && utils.UserRequiresMFA(&target) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This organization requires MFA; enable it before switching"})
+		return
+	}
+
+	if err := enterOrganization(&user, orgID); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	respondWithTokens(c, http.StatusOK, &user)
+}
+
+// GetInvitations returns the pending invitations to the current organization
+func (oc *OrganizationController) GetInvitations(c *gin.Context) {
+	var invitations []models.OrganizationInvitation
+	if err := config.DB.Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", middleware.CurrentOrganization(c), time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// InviteMember emails an invitation to join the current organization with a role
+func (oc *OrganizationController) InviteMember(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	orgID := middleware.CurrentOrganization(c)
+
+	var req InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if err := tenant.Roles(orgID).Where("id = ?", req.RoleID).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+	if !authorizeRoleAssignment(c, []models.Role{role}) {
+		return
+	}
+
+	var existing int64
+	tenant.Members(orgID).Where("LOWER(users.email) = LOWER(?)", req.Email).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+
+	var org models.Organization
+	if err := config.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	invitation, err := utils.SendOrganizationInvitation(&org, req.Email, &role, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invitation": invitation})
+}
+
+// RevokeInvitation withdraws a pending invitation to the current organization
+func (oc *OrganizationController) RevokeInvitation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	result := config.DB.Where("id = ? AND organization_id = ? AND accepted_at IS NULL", id, middleware.CurrentOrganization(c)).
+		Delete(&models.OrganizationInvitation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// AcceptInvitation adds the current user to the organization of an
+// invitation sent to their email address. The user switches to it separately.
+func (oc *OrganizationController) AcceptInvitation(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitation *models.OrganizationInvitation
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invitation, err = utils.ConsumeOrganizationInvitation(tx, req.Token, user.Email)
+		if err != nil {
+			return err
+		}
+
+		var role models.Role
+		if err := tx.Where("id = ?", invitation.RoleID).First(&role).Error; err != nil {
+			return utils.ErrInvalidInvitation
+		}
+		if err := tenant.AddMember(tx, invitation.OrganizationID, user.ID, &invitation.InvitedBy); err != nil {
+			return err
+		}
+		if err := tenant.AddRoles(tx, invitation.OrganizationID, user.ID, []models.Role{role}, tenant.Assignment{AssignedBy: invitation.InvitedBy}); err != nil {
+			return err
+		}
+
+		source := auditSource(c)
+		source.OrganizationID = &invitation.OrganizationID
+		err = audit.Record(tx, source, audit.Change{
+			Action:     audit.InvitationAccepted,
+			TargetType: audit.TargetInvitation,
+			TargetID:   invitation.ID,
+			Before:     gin.H{"accepted_at": nil},
+			After:      gin.H{"email": invitation.Email, "role": role.Name, "accepted_at": invitation.AcceptedAt},
+		})
+		if err != nil {
+			return err
+		}
+		return recordRoleGrant(tx, source, invitation.OrganizationID, user.ID, role)
+	})
+	if errors.Is(err, utils.ErrInvalidInvitation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	var org models.Organization
+	config.DB.Where("id = ?", invitation.OrganizationID).First(&org)
+
+	c.JSON(http.StatusOK, gin.H{"organization": org})
+}
+
+// enterOrganization makes the organization, or the user's last one when
+// orgID is nil, the user's active organization and loads the roles held
+// there. The user must be a member.
+func enterOrganization(user *models.User, orgID uuid.UUID) error {
+	active, err := tenant.ActiveOrganization(user, orgID)
+	if err != nil {
+		return err
+	}
+	if err := tenant.LoadRoles(user, active); err != nil {
+		return err
+	}
+
+	if user.ActiveOrganizationID == nil || *user.ActiveOrganizationID != active {
+		if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("active_organization_id", active).Error; err != nil {
+			return err
+		}
+	}
+	user.ActiveOrganizationID = &active
+	return nil
+}
+
+func respondOrganizationError(c *gin.Context, err error) {
+	if errors.Is(err, tenant.ErrNoOrganization) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account does not belong to any organization"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load organization"})
+}
+
+// requireDefaultOrganization refuses changes to definitions shared by every
+// organization, such as permissions, unless made from the default organization
+func requireDefaultOrganization(c *gin.Context) bool {
+	if middleware.CurrentOrganization(c) != models.DefaultOrganizationID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Shared definitions can only be changed from the default organization"})
+		return false
+	}
+	return true
+}
@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"backend/audit"
 	"backend/config"
 	"backend/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type PermissionController struct{}
@@ -16,6 +18,7 @@ type CreatePermissionRequest struct {
 	Description string `json:"description"`
 	Resource    string `json:"resource" binding:"required"`
 	Action      string `json:"action" binding:"required"`
+	Scope       string `json:"scope"` // "any" (default) or "own"
 }
 
 type UpdatePermissionRequest struct {
@@ -23,6 +26,7 @@ type UpdatePermissionRequest struct {
 	Description string `json:"description"`
 	Resource    string `json:"resource"`
 	Action      string `json:"action"`
+	Scope       string `json:"scope"`
 }
 
 // GetPermissions returns list of permissions
@@ -56,29 +60,52 @@ func (pc *PermissionController) GetPermission(c *gin.Context) {
 
 // CreatePermission creates a new permission
 func (pc *PermissionController) CreatePermission(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
 	var req CreatePermissionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if permission already exists
-	var existingPermission models.Permission
-	if err := config.DB.Where("name = ? OR (resource = ? AND action = ?)",
-		req.Name, req.Resource, req.Action).First(&existingPermission).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Permission already exists"})
-		return
+	if req.Scope == "" {
+		req.Scope = models.ScopeAny
 	}
-
-	// Create permission
 	permission := models.Permission{
 		Name:        req.Name,
 		Description: req.Description,
 		Resource:    req.Resource,
 		Action:      req.Action,
+		Scope:       req.Scope,
+	}
+	if err := permission.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if permission already exists
+	var existingPermission models.Permission
+	if err := config.DB.Where("name = ? OR (resource = ? AND action = ? AND scope = ?)",
+		req.Name, req.Resource, req.Action, req.Scope).First(&existingPermission).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Permission already exists"})
+		return
 	}
 
-	if err := config.DB.Create(&permission).Error; err != nil {
+	// Create permission
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&permission).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.PermissionCreated,
+			TargetType: audit.TargetPermission,
+			TargetID:   permission.ID,
+			After:      permission,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create permission"})
 		return
 	}
@@ -88,6 +115,10 @@ func (pc *PermissionController) CreatePermission(c *gin.Context) {
 
 // UpdatePermission updates a permission
 func (pc *PermissionController) UpdatePermission(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
@@ -108,6 +139,7 @@ func (pc *PermissionController) UpdatePermission(c *gin.Context) {
 	}
 
 	// Update fields if provided
+	before := permission
 	if req.Name != "" {
 		permission.Name = req.Name
 	}
@@ -120,8 +152,28 @@ func (pc *PermissionController) UpdatePermission(c *gin.Context) {
 	if req.Action != "" {
 		permission.Action = req.Action
 	}
+	if req.Scope != "" {
+		permission.Scope = req.Scope
+	}
+
+	if err := permission.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := config.DB.Save(&permission).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&permission).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.PermissionUpdated,
+			TargetType: audit.TargetPermission,
+			TargetID:   permission.ID,
+			Before:     before,
+			After:      permission,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permission"})
 		return
 	}
@@ -131,6 +183,10 @@ func (pc *PermissionController) UpdatePermission(c *gin.Context) {
 
 // DeletePermission deletes a permission
 func (pc *PermissionController) DeletePermission(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
@@ -156,7 +212,18 @@ func (pc *PermissionController) DeletePermission(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&permission).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&permission).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.PermissionDeleted,
+			TargetType: audit.TargetPermission,
+			TargetID:   permission.ID,
+			Before:     permission,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete permission"})
 		return
 	}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/policy"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PolicyController struct{}
+
+type PolicyRequest struct {
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	Resource    string             `json:"resource" binding:"required"`
+	Action      string             `json:"action" binding:"required"`
+	Effect      string             `json:"effect" binding:"required"`
+	Priority    int                `json:"priority"`
+	Conditions  []policy.Condition `json:"conditions"`
+	Enabled     *bool              `json:"enabled"`
+}
+
+type EvaluatePolicyRequest struct {
+	Resource string            `json:"resource" binding:"required"`
+	Action   string            `json:"action" binding:"required"`
+	Subject  policy.Attributes `json:"subject"`
+	Target   policy.Attributes `json:"target"`  // resource attributes
+	Request  policy.Attributes `json:"request"` // "time" is an RFC 3339 timestamp, now by default
+}
+
+// GetPolicies returns the policies in evaluation order, including those
+// loaded from files, and the disabled database policies
+func (pc *PolicyController) GetPolicies(c *gin.Context) {
+	engine, err := policy.Current()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load policies"})
+		return
+	}
+
+	var disabled []models.Policy
+	config.DB.Where("enabled = ?", false).Order("name").Find(&disabled)
+
+	c.JSON(http.StatusOK, gin.H{"policies": engine.Policies(), "disabled": disabled})
+}
+
+// GetPolicy returns a database policy
+func (pc *PolicyController) GetPolicy(c *gin.Context) {
+	row, ok := findPolicy(c)
+	if !ok {
+		return
+	}
+
+	p, err := policy.FromModel(row)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": row, "conditions": p.Conditions})
+}
+
+// CreatePolicy stores a new policy
+func (pc *PolicyController) CreatePolicy(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var row models.Policy
+	if !applyPolicyRequest(c, &row, &req) {
+		return
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.Policy{}).Where("name = ?", row.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Policy name already exists"})
+		return
+	}
+
+	if err := config.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create policy"})
+		return
+	}
+	policy.Invalidate()
+
+	c.JSON(http.StatusCreated, gin.H{"policy": row, "conditions": req.Conditions})
+}
+
+// UpdatePolicy replaces a database policy
+func (pc *PolicyController) UpdatePolicy(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	row, ok := findPolicy(c)
+	if !ok {
+		return
+	}
+
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != row.Name {
+		var count int64
+		config.DB.Unscoped().Model(&models.Policy{}).Where("name = ?", req.Name).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Policy name already exists"})
+			return
+		}
+	}
+	if !applyPolicyRequest(c, &row, &req) {
+		return
+	}
+
+	if err := config.DB.Save(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update policy"})
+		return
+	}
+	policy.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"policy": row, "conditions": req.Conditions})
+}
+
+// DeletePolicy deletes a database policy
+func (pc *PolicyController) DeletePolicy(c *gin.Context) {
+	if !requireDefaultOrganization(c) {
+		return
+	}
+
+	row, ok := findPolicy(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete policy"})
+		return
+	}
+	policy.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted successfully"})
+}
+
+// EvaluatePolicy runs the current policies against the given attributes
+// without touching any resource, to try out rules before relying on them
+func (pc *PolicyController) EvaluatePolicy(c *gin.Context) {
+	var req EvaluatePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Request == nil {
+		req.Request = policy.Attributes{}
+	}
+	now := time.Now()
+	if value, ok := req.Request["time"].(string); ok {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "request.time must be an RFC 3339 timestamp"})
+			return
+		}
+		now = parsed
+	}
+	req.Request["time"] = now
+
+	engine, err := policy.Current()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load policies"})
+		return
+	}
+
+	result := engine.Evaluate(req.Resource, req.Action, policy.Input{
+		Subject:  req.Subject,
+		Resource: req.Target,
+		Request:  req.Request,
+	})
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+func findPolicy(c *gin.Context) (models.Policy, bool) {
+	var row models.Policy
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return row, false
+	}
+	if err := config.DB.Where("id = ?", id).First(&row).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return row, false
+	}
+	return row, true
+}
+
+// applyPolicyRequest validates the request and copies it onto the row
+func applyPolicyRequest(c *gin.Context, row *models.Policy, req *PolicyRequest) bool {
+	if err := policy.Validate(policy.Policy{
+		Name:       req.Name,
+		Resource:   req.Resource,
+		Action:     req.Action,
+		Effect:     req.Effect,
+		Conditions: req.Conditions,
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	conditions, err := policy.EncodeConditions(req.Conditions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conditions"})
+		return false
+	}
+
+	row.Name = req.Name
+	row.Description = req.Description
+	row.Resource = req.Resource
+	row.Action = req.Action
+	row.Effect = req.Effect
+	row.Priority = req.Priority
+	row.Conditions = conditions
+	row.Enabled = req.Enabled == nil || *req.Enabled
+	return true
+}
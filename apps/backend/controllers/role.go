@@ -1,12 +1,19 @@
 package controllers
 
 import (
+	"backend/audit"
 	"backend/config"
+	"backend/middleware"
 	"backend/models"
+	"backend/rbac"
+	"backend/tenant"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RoleController struct{}
@@ -14,19 +21,31 @@ type RoleController struct{}
 type CreateRoleRequest struct {
 	Name          string      `json:"name" binding:"required"`
 	Description   string      `json:"description"`
+	RequireMFA    bool        `json:"require_mfa"`
 	PermissionIDs []uuid.UUID `json:"permission_ids"`
+	// DeniedPermissionIDs are denied even if a parent or wildcard grant allows them
+	DeniedPermissionIDs []uuid.UUID `json:"denied_permission_ids"`
+	ParentIDs           []uuid.UUID `json:"parent_ids"`
 }
 
 type UpdateRoleRequest struct {
 	Name          string      `json:"name"`
 	Description   string      `json:"description"`
+	RequireMFA    *bool       `json:"require_mfa"`
 	PermissionIDs []uuid.UUID `json:"permission_ids"`
+	// DeniedPermissionIDs replaces the denials when present; [] clears them
+	DeniedPermissionIDs []uuid.UUID `json:"denied_permission_ids"`
+	ParentIDs           []uuid.UUID `json:"parent_ids"` // replaces the parents when present; [] clears them
 }
 
-// GetRoles returns list of roles
+// GetRoles returns the shared roles and those of the current organization
 func (rc *RoleController) GetRoles(c *gin.Context) {
 	var roles []models.Role
-	if err := config.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+	if err := tenant.Roles(middleware.CurrentOrganization(c)).Preload("Permissions").Preload("Parents").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	if err := rbac.SeparateDenied(roles); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
 		return
 	}
@@ -43,16 +62,43 @@ func (rc *RoleController) GetRole(c *gin.Context) {
 		return
 	}
 
+	orgID := middleware.CurrentOrganization(c)
 	var role models.Role
-	if err := config.DB.Preload("Permissions").Preload("Users").Where("id = ?", id).First(&role).Error; err != nil {
+	if err := tenant.Roles(orgID).Preload("Permissions").Preload("Parents").Where("id = ?", id).First(&role).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"role": role})
+	// Only the holders in the current organization are listed
+	if err := tenant.Members(orgID).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id AND user_roles.organization_id = organization_members.organization_id").
+		Where("user_roles.role_id = ?", role.ID).
+		Find(&role.Users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	if err := separateDenied(&role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+
+	// Permissions granted directly plus those inherited from parent roles
+	effective, err := rbac.ForRoles([]uuid.UUID{role.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":                  role,
+		"direct_permissions":    role.Permissions,
+		"effective_permissions": effective.Grants,
+		"inherited_roles":       inheritedRoleNames(effective, role.Name),
+	})
 }
 
-// CreateRole creates a new role
+// CreateRole creates a role in the current organization. Roles created from
+// the default organization are shared by all organizations.
 func (rc *RoleController) CreateRole(c *gin.Context) {
 	var req CreateRoleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -60,9 +106,18 @@ func (rc *RoleController) CreateRole(c *gin.Context) {
 		return
 	}
 
+	if grantedAndDenied(req.PermissionIDs, req.DeniedPermissionIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A permission cannot be both granted and denied"})
+		return
+	}
+
 	// Check if role name already exists
-	var existingRole models.Role
-	if err := config.DB.Where("name = ?", req.Name).First(&existingRole).Error; err == nil {
+	taken, err := roleNameTaken(middleware.CurrentOrganization(c), req.Name, uuid.Nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role name"})
+		return
+	}
+	if taken {
 		c.JSON(http.StatusConflict, gin.H{"error": "Role name already exists"})
 		return
 	}
@@ -71,22 +126,62 @@ func (rc *RoleController) CreateRole(c *gin.Context) {
 	role := models.Role{
 		Name:        req.Name,
 		Description: req.Description,
+		RequireMFA:  req.RequireMFA,
+	}
+	if orgID := middleware.CurrentOrganization(c); orgID != models.DefaultOrganizationID {
+		role.OrganizationID = &orgID
 	}
 
-	if err := config.DB.Create(&role).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+	// Check parent roles if provided; a new role cannot be part of a cycle
+	var parents []models.Role
+	if len(req.ParentIDs) > 0 {
+		var status int
+		var err error
+		if parents, status, err = findRoleParents(c, uuid.Nil, req.ParentIDs); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if role.OrganizationID != nil && !authorizeRoleDefinition(c, req.PermissionIDs, parents) {
 		return
 	}
 
-	// Assign permissions if provided
-	if len(req.PermissionIDs) > 0 {
-		var permissions []models.Permission
-		config.DB.Where("id IN ?", req.PermissionIDs).Find(&permissions)
-		config.DB.Model(&role).Association("Permissions").Replace(permissions)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+
+		// Assign permissions and parent roles if provided
+		if len(req.PermissionIDs) > 0 {
+			if err := replaceGrants(tx, role.ID, req.PermissionIDs, models.EffectAllow); err != nil {
+				return err
+			}
+		}
+		if len(req.DeniedPermissionIDs) > 0 {
+			if err := replaceGrants(tx, role.ID, req.DeniedPermissionIDs, models.EffectDeny); err != nil {
+				return err
+			}
+		}
+		if len(parents) > 0 {
+			if err := tx.Model(&role).Association("Parents").Replace(parents); err != nil {
+				return err
+			}
+		}
+
+		return recordRoleChange(c, tx, audit.RoleCreated, role.ID, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
 	}
 
 	// Load role with permissions for response
-	config.DB.Preload("Permissions").First(&role, role.ID)
+	config.DB.Preload("Permissions").Preload("Parents").First(&role, role.ID)
+	if err := separateDenied(&role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"role": role})
 }
@@ -100,9 +195,8 @@ func (rc *RoleController) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	var role models.Role
-	if err := config.DB.Where("id = ?", id).First(&role).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	role, ok := findEditableRole(c, id)
+	if !ok {
 		return
 	}
 
@@ -112,28 +206,84 @@ func (rc *RoleController) UpdateRole(c *gin.Context) {
 		return
 	}
 
+	if grantedAndDenied(req.PermissionIDs, req.DeniedPermissionIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A permission cannot be both granted and denied"})
+		return
+	}
+
+	// Check parent roles if provided
+	var parents []models.Role
+	if req.ParentIDs != nil {
+		var status int
+		if parents, status, err = findRoleParents(c, role.ID, req.ParentIDs); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if role.OrganizationID != nil && !authorizeRoleDefinition(c, req.PermissionIDs, parents) {
+		return
+	}
+
 	// Update fields
-	if req.Name != "" {
+	if req.Name != "" && req.Name != role.Name {
+		taken, err := roleNameTaken(middleware.CurrentOrganization(c), req.Name, role.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role name"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role name already exists"})
+			return
+		}
 		role.Name = req.Name
 	}
 	if req.Description != "" {
 		role.Description = req.Description
 	}
+	if req.RequireMFA != nil {
+		role.RequireMFA = *req.RequireMFA
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := loadRoleAudit(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+
+		// Update permissions and parent roles if provided
+		if len(req.PermissionIDs) > 0 {
+			if err := replaceGrants(tx, role.ID, req.PermissionIDs, models.EffectAllow); err != nil {
+				return err
+			}
+		}
+		if req.DeniedPermissionIDs != nil {
+			if err := replaceGrants(tx, role.ID, req.DeniedPermissionIDs, models.EffectDeny); err != nil {
+				return err
+			}
+		}
+		if req.ParentIDs != nil {
+			if err := tx.Model(&role).Association("Parents").Replace(parents); err != nil {
+				return err
+			}
+		}
 
-	if err := config.DB.Save(&role).Error; err != nil {
+		return recordRoleChange(c, tx, audit.RoleUpdated, role.ID, before)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
 		return
 	}
 
-	// Update permissions if provided
-	if len(req.PermissionIDs) > 0 {
-		var permissions []models.Permission
-		config.DB.Where("id IN ?", req.PermissionIDs).Find(&permissions)
-		config.DB.Model(&role).Association("Permissions").Replace(permissions)
-	}
-
 	// Load role with permissions for response
-	config.DB.Preload("Permissions").First(&role, role.ID)
+	config.DB.Preload("Permissions").Preload("Parents").First(&role, role.ID)
+	if err := separateDenied(&role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"role": role})
 }
@@ -147,14 +297,13 @@ func (rc *RoleController) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	var role models.Role
-	if err := config.DB.Where("id = ?", id).First(&role).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	role, ok := findEditableRole(c, id)
+	if !ok {
 		return
 	}
 
 	// Check if role is one of the default roles
-	defaultRoles := []string{"admin", "user", "moderator"}
+	defaultRoles := []string{"admin", "user", "moderator", models.OwnerRoleName}
 	for _, defaultRole := range defaultRoles {
 		if role.Name == defaultRole {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete default role"})
@@ -162,7 +311,7 @@ func (rc *RoleController) DeleteRole(c *gin.Context) {
 		}
 	}
 
-	// Check if role has users assigned
+	// Check if role has users assigned in any organization
 	var userCount int64
 	config.DB.Model(&models.User{}).Joins("JOIN user_roles ON users.id = user_roles.user_id").Where("user_roles.role_id = ?", role.ID).Count(&userCount)
 	if userCount > 0 {
@@ -170,7 +319,28 @@ func (rc *RoleController) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&role).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := loadRoleAudit(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+
+		// Roles that inherited from this one no longer do
+		if err := tx.Where("role_id = ? OR parent_id = ?", role.ID, role.ID).Delete(&models.RoleParent{}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditSource(c), audit.Change{
+			Action:     audit.RoleDeleted,
+			TargetType: audit.TargetRole,
+			TargetID:   role.ID,
+			Before:     before,
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
 		return
 	}
@@ -188,3 +358,186 @@ func (rc *RoleController) GetPermissions(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
 }
+
+// findEditableRole loads a role usable in the current organization that the
+// request may change. Shared roles can only be changed from the default
+// organization.
+func findEditableRole(c *gin.Context, id uuid.UUID) (models.Role, bool) {
+	var role models.Role
+	if err := tenant.Roles(middleware.CurrentOrganization(c)).Where("id = ?", id).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return role, false
+	}
+	if role.OrganizationID == nil && !requireDefaultOrganization(c) {
+		return role, false
+	}
+	return role, true
+}
+
+// roleNameTaken reports whether another role visible from the organization,
+// deleted or not, has the name. Shared roles are visible from every
+// organization, so their names must be free in all of them, and role gates
+// matching on a shared role's name cannot be met with an organization's own
+// role.
+func roleNameTaken(orgID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	query := tenant.Roles(orgID)
+	if orgID == models.DefaultOrganizationID {
+		query = config.DB.Model(&models.Role{})
+	}
+	var count int64
+	err := query.Unscoped().Where("name = ? AND id <> ?", name, except).Count(&count).Error
+	return count > 0, err
+}
+
+// findRoleParents loads the roles a role is to inherit from, rejecting
+// unknown roles and assignments that would create a cycle. Parents must be
+// usable in the current organization.
+func findRoleParents(c *gin.Context, roleID uuid.UUID, parentIDs []uuid.UUID) ([]models.Role, int, error) {
+	var parents []models.Role
+	if len(parentIDs) > 0 {
+		if err := tenant.Roles(middleware.CurrentOrganization(c)).Where("id IN ?", parentIDs).Find(&parents).Error; err != nil {
+			return nil, http.StatusInternalServerError, errors.New("Failed to load parent roles")
+		}
+		if len(parents) != len(uniqueIDs(parentIDs)) {
+			return nil, http.StatusBadRequest, errors.New("Parent role not found")
+		}
+	}
+
+	if err := rbac.ValidateParents(roleID, parentIDs); err != nil {
+		if errors.Is(err, rbac.ErrRoleCycle) {
+			return nil, http.StatusBadRequest, errors.New("Role hierarchy would contain a cycle")
+		}
+		return nil, http.StatusInternalServerError, errors.New("Failed to validate parent roles")
+	}
+	return parents, http.StatusOK, nil
+}
+
+// authorizeRoleDefinition checks that the current user already has every
+// permission an organization's role is to grant, directly or through its
+// parents. Otherwise anyone managing an organization's roles could grant
+// themselves more than they hold.
+func authorizeRoleDefinition(c *gin.Context, permissionIDs []uuid.UUID, parents []models.Role) bool {
+	permissions, err := middleware.CurrentPermissions(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return false
+	}
+
+	var granted []models.Permission
+	if len(permissionIDs) > 0 {
+		if err := config.DB.Where("id IN ?", permissionIDs).Find(&granted).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			return false
+		}
+	}
+	for _, permission := range granted {
+		if !permissions.Covers(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant a permission you do not have: " + permission.Name})
+			return false
+		}
+	}
+
+	if len(parents) == 0 {
+		return true
+	}
+	parentIDs := make([]uuid.UUID, 0, len(parents))
+	for _, parent := range parents {
+		parentIDs = append(parentIDs, parent.ID)
+	}
+	inherited, err := rbac.ForRoles(parentIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return false
+	}
+	for _, grant := range inherited.Grants {
+		if grant.Effect != models.EffectDeny && !permissions.Covers(grant.Permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot inherit from role " + grant.Role + ", which grants a permission you do not have: " + grant.Permission.Name})
+			return false
+		}
+	}
+	return true
+}
+
+// recordRoleChange records the role's state after a change within tx,
+// compared with its state before
+func recordRoleChange(c *gin.Context, tx *gorm.DB, action string, roleID uuid.UUID, before *roleAudit) error {
+	after, err := loadRoleAudit(tx, roleID)
+	if err != nil {
+		return err
+	}
+	return audit.Record(tx, auditSource(c), audit.Change{
+		Action:     action,
+		TargetType: audit.TargetRole,
+		TargetID:   roleID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+func inheritedRoleNames(set *rbac.PermissionSet, self string) []string {
+	names := []string{}
+	for _, role := range set.Roles {
+		if role.Name != self {
+			names = append(names, role.Name)
+		}
+	}
+	return names
+}
+
+func uniqueIDs(ids []uuid.UUID) map[uuid.UUID]bool {
+	unique := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
+
+// replaceGrants makes the permissions the role's only grants with the effect.
+// A permission already granted with the other effect is switched over.
+func replaceGrants(tx *gorm.DB, roleID uuid.UUID, permissionIDs []uuid.UUID, effect string) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ? AND effect = ?", roleID, effect).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissionIDs) == 0 {
+			return nil
+		}
+
+		var permissions []models.Permission
+		if err := tx.Where("id IN ?", permissionIDs).Find(&permissions).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "role_id"}, {Name: "permission_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"effect"}),
+			}).Create(&models.RolePermission{
+				RoleID:       roleID,
+				PermissionID: permission.ID,
+				Effect:       effect,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func grantedAndDenied(allowIDs, denyIDs []uuid.UUID) bool {
+	allowed := uniqueIDs(allowIDs)
+	for _, id := range denyIDs {
+		if allowed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func separateDenied(role *models.Role) error {
+	roles := []models.Role{*role}
+	if err := rbac.SeparateDenied(roles); err != nil {
+		return err
+	}
+	*role = roles[0]
+	return nil
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SecurityController struct{}
+
+// GetTokenReuseEvents returns detected refresh token reuse attempts
+func (sc *SecurityController) GetTokenReuseEvents(c *gin.Context) {
+	var events []models.RefreshTokenReuse
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.RefreshTokenReuse{})
+
+	// Filter by user
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch token reuse events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetLockouts returns login lockout counters. Pass active=true to list only
+// accounts and IPs that are currently locked.
+func (sc *SecurityController) GetLockouts(c *gin.Context) {
+	var lockouts []models.LoginLockout
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.LoginLockout{})
+
+	// Filter by scope
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	// Only currently locked entries
+	if c.Query("active") == "true" {
+		query = query.Where("locked_until > ?", time.Now())
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("last_failure_at DESC").Offset(offset).Limit(limit).Find(&lockouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ClearLockout unlocks an account or IP and resets its failure counter
+func (sc *SecurityController) ClearLockout(c *gin.Context) {
+	id := c.Param("id")
+
+	result := config.DB.Where("id = ?", id).Delete(&models.LoginLockout{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared successfully"})
+}
+
+// GetExpiredRoleAssignments returns the time-bound role assignments the
+// sweeper removed after they expired
+func (sc *SecurityController) GetExpiredRoleAssignments(c *gin.Context) {
+	var assignments []models.ExpiredRoleAssignment
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.ExpiredRoleAssignment{})
+
+	// Filter by user
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	// Filter by organization
+	if orgID := c.Query("organization_id"); orgID != "" {
+		query = query.Where("organization_id = ?", orgID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("removed_at DESC").Offset(offset).Limit(limit).Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expired role assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assignments": assignments,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetAuditEvents returns the audit log of administrative changes and
+// authentication events. Outside the default organization only the events
+// of the current organization are listed.
+func (sc *SecurityController) GetAuditEvents(c *gin.Context) {
+	var events []models.AuditEvent
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.AuditEvent{})
+
+	// Filter by organization
+	if orgID := middleware.CurrentOrganization(c); orgID != models.DefaultOrganizationID {
+		query = query.Where("organization_id = ?", orgID)
+	} else if orgID := c.Query("organization_id"); orgID != "" {
+		query = query.Where("organization_id = ?", orgID)
+	}
+
+	// Filter by actor, action and target
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	// Filter by request
+	if requestID := c.Query("request_id"); requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
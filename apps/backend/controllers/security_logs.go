@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/middleware"
+	"backend/models"
+	"backend/requestlog"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Security logs are listed newest first, a page at a time
+const (
+	defaultLogPageSize = 50
+	maxLogPageSize     = 500
+	exportBatchSize    = 1000
+)
+
+// Export formats besides the default JSON page
+const (
+	exportCSV   = "csv"
+	exportJSONL = "jsonl"
+)
+
+var statusClassPattern = regexp.MustCompile(`^[1-5]xx$`)
+
+// logCursor points after the last row of a page. Rows are ordered by
+// created_at and then id, both descending, so rows written later never
+// shift the following pages.
+type logCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// logPage loads up to limit rows after the cursor, or from the newest row
+// when it is nil. It returns them as JSON values and as CSV records.
+type logPage func(after *logCursor, limit int) (rows []interface{}, records [][]string, last *logCursor, err error)
+
+var requestLogColumns = []string{"id", "created_at", "user_id", "ip", "method", "path", "status", "duration_ms", "user_agent"}
+
+var failedLoginColumns = []string{"id", "created_at", "user_id", "username", "ip", "reason", "user_agent"}
+
+// GetRequestLogs lists or exports the request log. Filters: user_id, ip,
+// method, path (prefix), status (such as 404 or 4xx), from, to and q, which
+// searches the path, IP and user agent.
+func (sc *SecurityController) GetRequestLogs(c *gin.Context) {
+	query, err := filterLog(c, config.DB.Model(&models.RequestLog{}), "path", "ip", "user_agent")
+	if err == nil {
+		query, err = filterRequestLog(c, query)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondLog(c, "requests", requestLogColumns, func(after *logCursor, limit int) ([]interface{}, [][]string, *logCursor, error) {
+		var logs []models.RequestLog
+		if err := pageAfter(query, after, limit).Find(&logs).Error; err != nil {
+			return nil, nil, nil, err
+		}
+
+		rows := make([]interface{}, 0, len(logs))
+		records := make([][]string, 0, len(logs))
+		for _, entry := range logs {
+			rows = append(rows, entry)
+			records = append(records, []string{
+				entry.ID.String(), entry.CreatedAt.UTC().Format(time.RFC3339Nano), optionalID(entry.UserID),
+				entry.IP, entry.Method, entry.Path, strconv.Itoa(entry.Status), strconv.FormatInt(entry.Duration, 10), entry.UserAgent,
+			})
+		}
+		if len(logs) == 0 {
+			return rows, records, nil, nil
+		}
+		last := logs[len(logs)-1]
+		return rows, records, &logCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+	})
+}
+
+// GetRequestLogStats returns this process's request log writer counters:
+// entries written, dropped because the buffer was full and lost to failed
+// writes
+func (sc *SecurityController) GetRequestLogStats(c *gin.Context) {
+	if requestlog.Default == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Request log not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, requestlog.Default.Stats())
+}
+
+// GetFailedLogins lists or exports failed login attempts. Filters: user_id,
+// ip, username, reason, from, to and q, which searches the username, IP and
+// user agent.
+func (sc *SecurityController) GetFailedLogins(c *gin.Context) {
+	query, err := filterLog(c, config.DB.Model(&models.FailedLogin{}), "username", "ip", "user_agent")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("LOWER(username) = LOWER(?)", username)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	respondLog(c, "failed_logins", failedLoginColumns, func(after *logCursor, limit int) ([]interface{}, [][]string, *logCursor, error) {
+		var attempts []models.FailedLogin
+		if err := pageAfter(query, after, limit).Find(&attempts).Error; err != nil {
+			return nil, nil, nil, err
+		}
+
+		rows := make([]interface{}, 0, len(attempts))
+		records := make([][]string, 0, len(attempts))
+		for _, attempt := range attempts {
+			rows = append(rows, attempt)
+			records = append(records, []string{
+				attempt.ID.String(), attempt.CreatedAt.UTC().Format(time.RFC3339Nano), optionalID(attempt.UserID),
+				attempt.Username, attempt.IP, attempt.Reason, attempt.UserAgent,
+			})
+		}
+		if len(attempts) == 0 {
+			return rows, records, nil, nil
+		}
+		last := attempts[len(attempts)-1]
+		return rows, records, &logCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+	})
+}
+
+// filterLog applies the filters shared by the security logs: user_id, ip,
+// the from/to time range and a free text q matched against textColumns
+func filterLog(c *gin.Context, query *gorm.DB, textColumns ...string) (*gorm.DB, error) {
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return nil, errors.New("Invalid user_id")
+		}
+		query = query.Where("user_id = ?", id)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	for _, bound := range []struct{ param, condition string }{{"from", "created_at >= ?"}, {"to", "created_at < ?"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time such as 2024-01-31T00:00:00Z", bound.param)
+		}
+		query = query.Where(bound.condition, at)
+	}
+
+	if text := strings.TrimSpace(c.Query("q")); text != "" {
+		conditions := make([]string, len(textColumns))
+		args := make([]interface{}, len(textColumns))
+		for i, column := range textColumns {
+			conditions[i] = column + ` ILIKE ? ESCAPE '\'`
+			args[i] = "%" + escapeLike(text) + "%"
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
+	}
+	return query, nil
+}
+
+// filterRequestLog applies the filters only the request log has
+func filterRequestLog(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method = ?", strings.ToUpper(method))
+	}
+	if path := c.Query("path"); path != "" {
+		query = query.Where(`path LIKE ? ESCAPE '\'`, escapeLike(path)+"%")
+	}
+	if status := strings.ToLower(c.Query("status")); status != "" {
+		if statusClassPattern.MatchString(status) {
+			class := int(status[0]-'0') * 100
+			query = query.Where("status BETWEEN ? AND ?", class, class+99)
+		} else if code, err := strconv.Atoi(status); err == nil {
+			query = query.Where("status = ?", code)
+		} else {
+			return nil, errors.New("status must be a status code such as 404 or a class such as 4xx")
+		}
+	}
+	return query, nil
+}
+
+// respondLog writes one page of a security log as JSON with the cursor of
+// the next page, or streams every matching row when format is csv or jsonl.
+// The logs cover all organizations, so they can only be read from the
+// default organization.
+func respondLog(c *gin.Context, name string, columns []string, load logPage) {
+	if middleware.CurrentOrganization(c) != models.DefaultOrganizationID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Security logs can only be read from the default organization"})
+		return
+	}
+
+	var after *logCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		var err error
+		if after, err = decodeLogCursor(cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogPageSize)))
+		if err != nil || limit < 1 || limit > maxLogPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLogPageSize)})
+			return
+		}
+
+		rows, _, last, err := load(after, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch " + strings.ReplaceAll(name, "_", " ")})
+			return
+		}
+		response := gin.H{name: rows, "next_cursor": nil}
+		if len(rows) == limit {
+			response["next_cursor"] = encodeLogCursor(last)
+		}
+		c.JSON(http.StatusOK, response)
+	case exportCSV, exportJSONL:
+		streamLog(c, name, format, columns, after, load)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or jsonl"})
+	}
+}
+
+// streamLog writes every row after the cursor as an attachment, a batch at
+// a time so that large exports are never held in memory. Once streaming has
+// started, failures can only end the response early.
+func streamLog(c *gin.Context, name, format string, columns []string, after *logCursor, load logPage) {
+	filename := fmt.Sprintf("%s-%s.%s", strings.ReplaceAll(name, "_", "-"), time.Now().UTC().Format("20060102T150405Z"), format)
+	contentType := "application/x-ndjson"
+	if format == exportCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == exportCSV {
+		csvWriter.Write(columns)
+	}
+
+	for {
+		rows, records, last, err := load(after, exportBatchSize)
+		if err != nil {
+			log.Printf("Failed to export %s: %v", name, err)
+			return
+		}
+
+		if format == exportCSV {
+			for _, record := range records {
+				for i, cell := range record {
+					record[i] = csvCell(cell)
+				}
+				csvWriter.Write(record)
+			}
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return
+			}
+		} else {
+			for _, row := range rows {
+				if err := encoder.Encode(row); err != nil {
+					return
+				}
+			}
+		}
+		c.Writer.Flush()
+
+		if len(rows) < exportBatchSize {
+			return
+		}
+		after = last
+	}
+}
+
+// pageAfter orders the query newest first and limits it to the rows after
+// the cursor
+func pageAfter(query *gorm.DB, after *logCursor, limit int) *gorm.DB {
+	query = query.Session(&gorm.Session{}).Order("created_at DESC, id DESC").Limit(limit)
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+	return query
+}
+
+// encodeLogCursor makes an opaque cursor from the last row of a page
+func encodeLogCursor(cursor *logCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeLogCursor(value string) (*logCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, id, found := strings.Cut(string(raw), ",")
+	if !found {
+		return nil, errors.New("malformed cursor")
+	}
+	cursor := &logCursor{}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, err
+	}
+	if cursor.ID, err = uuid.Parse(id); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// csvCell keeps spreadsheets from running logged values, such as a user
+// agent starting with "=", as formulas
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func optionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,140 @@
+// Package features evaluates feature flags. A flag is on for a user when
+// the user, their organization or one of their roles is targeted, or when
+// the user falls inside the flag's percentage rollout; otherwise the flag
+// takes its default for the deployment environment.
+package features
+
+import (
+	"backend/config"
+	"backend/models"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// reloadInterval bounds how stale the cached flags can be on instances that
+// did not make a change themselves
+const reloadInterval = 30 * time.Second
+
+// Subject is who a flag is evaluated for
+type Subject struct {
+	UserID         uuid.UUID
+	OrganizationID uuid.UUID
+	Roles          []string // effective roles, including inherited ones
+}
+
+// Evaluation is the outcome of evaluating a flag
+type Evaluation struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+var (
+	mu       sync.Mutex
+	current  map[string]models.FeatureFlag
+	loadedAt time.Time
+)
+
+// Flags returns every flag by name, reloading them every 30 seconds or
+// after Invalidate
+func Flags() (map[string]models.FeatureFlag, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil && time.Since(loadedAt) < reloadInterval {
+		return current, nil
+	}
+
+	var rows []models.FeatureFlag
+	if err := config.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	flags := make(map[string]models.FeatureFlag, len(rows))
+	for _, row := range rows {
+		flags[row.Name] = row
+	}
+	current, loadedAt = flags, time.Now()
+	return current, nil
+}
+
+// Invalidate makes the next Flags call reload the flags
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	current = nil
+}
+
+// Enabled reports whether the named flag is on for the subject. Unknown
+// flags are off.
+func Enabled(name string, subject Subject) (bool, error) {
+	flags, err := Flags()
+	if err != nil {
+		return false, err
+	}
+	flag, ok := flags[name]
+	if !ok {
+		return false, nil
+	}
+	return Evaluate(flag, subject, config.Environment()).Enabled, nil
+}
+
+// EvaluateAll returns whether each flag is on for the subject
+func EvaluateAll(subject Subject) (map[string]bool, error) {
+	flags, err := Flags()
+	if err != nil {
+		return nil, err
+	}
+	environment := config.Environment()
+	enabled := make(map[string]bool, len(flags))
+	for name, flag := range flags {
+		enabled[name] = Evaluate(flag, subject, environment).Enabled
+	}
+	return enabled, nil
+}
+
+// Evaluate decides the flag for the subject in the environment
+func Evaluate(flag models.FeatureFlag, subject Subject, environment string) Evaluation {
+	if contains(flag.UserIDs, subject.UserID.String()) {
+		return Evaluation{Enabled: true, Reason: "user is targeted"}
+	}
+	if subject.OrganizationID != uuid.Nil && contains(flag.OrganizationIDs, subject.OrganizationID.String()) {
+		return Evaluation{Enabled: true, Reason: "organization is targeted"}
+	}
+	for _, role := range subject.Roles {
+		if contains(flag.Roles, role) {
+			return Evaluation{Enabled: true, Reason: "role " + role + " is targeted"}
+		}
+	}
+	if flag.Percentage > 0 && subject.UserID != uuid.Nil {
+		if bucket := Bucket(flag.Name, subject.UserID); bucket < flag.Percentage {
+			return Evaluation{Enabled: true, Reason: fmt.Sprintf("user is in the %d%% rollout", flag.Percentage)}
+		}
+	}
+	if value, ok := flag.Environments[environment].(bool); ok {
+		return Evaluation{Enabled: value, Reason: "default for " + environment}
+	}
+	return Evaluation{Enabled: flag.DefaultOn, Reason: "default"}
+}
+
+// Bucket places the user in one of 100 buckets for the flag. A user keeps
+// the same bucket for a flag, and buckets are independent across flags, so
+// raising a percentage only adds users.
+func Bucket(flag string, userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{':'})
+	h.Write(userID[:])
+	return int(h.Sum32() % 100)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"backend/config"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Message is an email to be delivered
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by the application, configured by Init
+var Default Mailer
+
+// Init configures Default from the environment. MAIL_DRIVER selects the
+// implementation: "smtp", "file" or "memory". Outside development the
+// driver defaults to SMTP; in development messages are written to MAIL_DIR.
+func Init() error {
+	driver := strings.ToLower(os.Getenv("MAIL_DRIVER"))
+	if driver == "" {
+		driver = "smtp"
+		if config.IsDevelopment() {
+			driver = "file"
+		}
+	}
+
+	from := getEnv("MAIL_FROM", "no-reply@localhost")
+
+	switch driver {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+		Default = &SMTPMailer{
+			Host:     host,
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		Default = &FileMailer{Dir: getEnv("MAIL_DIR", "tmp/mail"), From: from}
+	case "memory":
+		Default = &MemoryMailer{}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+
+	log.Printf("✅ Mailer configured (driver: %s)", driver)
+	return nil
+}
+
+// SendAsync delivers a message with the default mailer without blocking the
+// caller, so response times do not reveal whether a message was sent
+func SendAsync(msg Message) {
+	if Default == nil {
+		log.Printf("Mailer not configured, dropping message %q", msg.Subject)
+		return
+	}
+
+	go func() {
+		if err := Default.Send(msg); err != nil {
+			log.Printf("Failed to send email %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
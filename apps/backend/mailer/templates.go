@@ -0,0 +1,87 @@
+package mailer
+
+import "fmt"
+
+// PasswordResetMessage builds the email carrying a password reset link
+func PasswordResetMessage(to, name, link string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: "Reset your password",
+		Text: fmt.Sprintf(`Hi %s,
+
+We received a request to reset your password. Open the link below to choose a new one:
+
+%s
+
+The link expires in one hour and can only be used once. If you did not request a reset, you can ignore this email.
+`, name, link),
+	}
+}
+
+// EmailVerificationMessage builds the email asking a user to confirm their address
+func EmailVerificationMessage(to, name, link string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf(`Hi %s,
+
+Please confirm that this is your email address by opening the link below:
+
+%s
+
+The link expires in 48 hours.
+`, name, link),
+	}
+}
+
+// OrganizationInvitationMessage builds the email inviting someone to join an organization
+func OrganizationInvitationMessage(to, organization, inviter, link string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("You have been invited to join %s", organization),
+		Text: fmt.Sprintf(`Hi,
+
+%s has invited you to join %s. Sign in or create an account with this email address, then open the link below to accept:
+
+%s
+
+The invitation expires in 7 days.
+`, inviter, organization, link),
+	}
+}
+
+// ElevationRequestedMessage builds the email asking an approver to review a
+// request for a temporary role
+func ElevationRequestedMessage(to, requester, role, duration, justification, link string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("%s requests the %s role", requester, role),
+		Text: fmt.Sprintf(`Hi,
+
+%s has requested the %s role for %s:
+
+%s
+
+Review the request here:
+
+%s
+`, requester, role, duration, justification, link),
+	}
+}
+
+// ElevationDecidedMessage builds the email telling a user whether their
+// request for a temporary role was approved
+func ElevationDecidedMessage(to, name, role, status, note string) Message {
+	text := fmt.Sprintf(`Hi %s,
+
+Your request for the %s role was %s.
+`, name, role, status)
+	if note != "" {
+		text += fmt.Sprintf("\nNote from the approver: %s\n", note)
+	}
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Your request for the %s role was %s", role, status),
+		Text:    text,
+	}
+}
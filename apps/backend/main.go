@@ -1,12 +1,22 @@
 package main
 
 import (
+	"backend/audit"
 	"backend/config"
 	"backend/controllers"
+	"backend/mailer"
 	"backend/middleware"
+	"backend/ratelimit"
+	"backend/requestlog"
+	"backend/tenant"
+	"backend/utils"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -34,19 +44,50 @@ func main() {
 		gin.SetMode(gin.DebugMode)
 	}
 
+	// Load JWT signing keys; refuses to start without keys outside development
+	if err := utils.InitKeys(); err != nil {
+		log.Fatal("Failed to load keys:", err)
+	}
+
+	// Configure outgoing mail
+	if err := mailer.Init(); err != nil {
+		log.Fatal("Failed to configure mailer:", err)
+	}
+
+	// Configure request rate limiting
+	if err := ratelimit.Init(); err != nil {
+		log.Fatal("Failed to configure rate limiter:", err)
+	}
+
 	// Connect to database
 	config.ConnectDB()
 
+	// Background jobs run until shutdown
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Remove time-bound role assignments once they expire, auditing each removal
+	tenant.StartAssignmentSweeper(background, config.RoleSweepInterval(), audit.RecordExpiredAssignments)
+
+	// Seal finished days of the audit and security log hash chains
+	audit.StartCheckpointer(background, config.AuditChain())
+
+	// Write the request log in batches in the background
+	if err := requestlog.Init(); err != nil {
+		log.Fatal("Failed to configure request log:", err)
+	}
+
 	r := gin.Default()
 
-	// Add security middleware to all routes
-	r.Use(middleware.SecurityMiddleware())
+	// Tag requests with an ID and add security middleware to all routes
+	r.Use(middleware.RequestID(), middleware.SecurityMiddleware())
 
 	// Configure CORS
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"http://localhost:3000"} // Next.js dev server
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", middleware.RequestIDHeader}
+	corsConfig.ExposeHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", middleware.RequestIDHeader}
 	r.Use(cors.New(corsConfig))
 
 	// Initialize controllers
@@ -54,6 +95,16 @@ func main() {
 	userController := &controllers.UserController{}
 	roleController := &controllers.RoleController{}
 	permissionController := &controllers.PermissionController{}
+	securityController := &controllers.SecurityController{}
+	policyController := &controllers.PolicyController{}
+	mfaController := &controllers.MFAController{}
+	organizationController := &controllers.OrganizationController{}
+	elevationController := &controllers.ElevationController{}
+	menuController := &controllers.MenuController{}
+	featureController := &controllers.FeatureController{}
+
+	// JSON Web Key Set so other services can verify access tokens locally
+	r.GET("/.well-known/jwks.json", authController.JWKS)
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
@@ -70,6 +121,11 @@ func main() {
 		public.POST("/auth/register", authController.Register)
 		public.POST("/auth/login", authController.Login)
 		public.POST("/auth/refresh", authController.RefreshToken)
+		public.POST("/auth/mfa/verify", authController.VerifyMFA)
+		public.POST("/auth/verify-email", authController.VerifyEmail)
+		public.POST("/auth/resend-verification", authController.ResendVerification)
+		public.POST("/auth/forgot-password", authController.ForgotPassword)
+		public.POST("/auth/reset-password", authController.ResetPassword)
 
 		// Public hello endpoint (for testing)
 		public.GET("/hello", func(c *gin.Context) {
@@ -82,23 +138,56 @@ func main() {
 
 	// Protected routes (authentication required)
 	protected := r.Group("/api/v1")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(), middleware.RateLimitByUser(middleware.UserRateLimit()))
 	{
 		// Auth routes
 		protected.GET("/auth/me", authController.Me)
 		protected.GET("/auth/menu-access", authController.GetMenuAccess)
+		protected.POST("/auth/can", authController.Can)
+		protected.GET("/auth/features", authController.GetFeatures)
 		protected.POST("/auth/logout", authController.Logout)
 		protected.POST("/auth/logout-all", authController.LogoutAll)
+		protected.POST("/auth/mfa/enroll", mfaController.Enroll)
+		protected.POST("/auth/mfa/confirm", mfaController.Confirm)
+		protected.POST("/auth/mfa/disable", mfaController.Disable)
+		protected.POST("/auth/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+
+		// Organization routes; everything else acts in the organization of the access token
+		orgs := protected.Group("/orgs")
+		{
+			orgs.GET("", organizationController.GetOrganizations)
+			orgs.POST("", organizationController.CreateOrganization)
+			orgs.GET("/current", organizationController.GetCurrentOrganization)
+			orgs.POST("/:id/switch", organizationController.SwitchOrganization)
+			orgs.GET("/current/invitations", middleware.RequirePermission("users", "read"), organizationController.GetInvitations)
+			orgs.POST("/current/invitations", middleware.RequirePermission("users", "write"), organizationController.InviteMember)
+			orgs.DELETE("/current/invitations/:id", middleware.RequirePermission("users", "write"), organizationController.RevokeInvitation)
+			orgs.POST("/invitations/accept", organizationController.AcceptInvitation)
+		}
 
 		// User management routes
 		users := protected.Group("/users")
 		{
-			users.GET("", middleware.RequirePermission("users", "read"), userController.GetUsers)
-			users.GET("/:id", middleware.RequirePermission("users", "read"), userController.GetUser)
+			users.GET("", middleware.RequireScopedPermission("users", "read"), userController.GetUsers)
+			users.GET("/:id", middleware.RequireScopedPermission("users", "read"), middleware.RequirePolicy("users", "read"), userController.GetUser)
 			users.POST("", middleware.RequirePermission("users", "write"), userController.CreateUser)
-			users.PUT("/:id", middleware.RequirePermission("users", "write"), userController.UpdateUser)
+			users.PUT("/:id", middleware.RequireScopedPermission("users", "write"), middleware.RequirePolicy("users", "write"), userController.UpdateUser)
 			users.DELETE("/:id", middleware.RequirePermission("users", "delete"), userController.DeleteUser)
-			users.POST("/:id/roles", middleware.RequireRole("admin"), userController.AssignRoles)
+			users.POST("/:id/roles", middleware.RequirePermission("users", "write"), userController.AssignRoles)
+			users.POST("/:id/roles/:role_id", middleware.RequirePermission("users", "write"), userController.GrantRole)
+			users.DELETE("/:id/roles/:role_id", middleware.RequirePermission("users", "write"), userController.RevokeRole)
+		}
+
+		// Just-in-time elevation routes
+		approverResource, approverAction := config.Elevation().Approver()
+		elevations := protected.Group("/elevations")
+		{
+			elevations.GET("", elevationController.GetElevations)
+			elevations.GET("/:id", elevationController.GetElevation)
+			elevations.POST("", middleware.RequirePermission("elevations", "request"), elevationController.CreateElevation)
+			elevations.POST("/:id/approve", middleware.RequirePermission(approverResource, approverAction), elevationController.ApproveElevation)
+			elevations.POST("/:id/reject", middleware.RequirePermission(approverResource, approverAction), elevationController.RejectElevation)
+			elevations.POST("/:id/cancel", elevationController.CancelElevation)
 		}
 
 		// Role management routes
@@ -121,6 +210,60 @@ func main() {
 			permissions.DELETE("/:id", middleware.RequirePermission("permissions", "delete"), permissionController.DeletePermission)
 		}
 
+		// Navigation menu routes
+		menus := protected.Group("/menus")
+		{
+			menus.GET("", middleware.RequirePermission("menus", "read"), menuController.GetMenus)
+			menus.GET("/:id", middleware.RequirePermission("menus", "read"), menuController.GetMenu)
+			menus.POST("", middleware.RequirePermission("menus", "write"), menuController.CreateMenu)
+			menus.PUT("/:id", middleware.RequirePermission("menus", "write"), menuController.UpdateMenu)
+			menus.DELETE("/:id", middleware.RequirePermission("menus", "delete"), menuController.DeleteMenu)
+		}
+
+		// Feature flag routes
+		featureFlags := protected.Group("/features")
+		{
+			featureFlags.GET("", middleware.RequirePermission("features", "read"), featureController.GetFeatureFlags)
+			featureFlags.GET("/:id", middleware.RequirePermission("features", "read"), featureController.GetFeatureFlag)
+			featureFlags.POST("", middleware.RequirePermission("features", "write"), featureController.CreateFeatureFlag)
+			featureFlags.PUT("/:id", middleware.RequirePermission("features", "write"), featureController.UpdateFeatureFlag)
+			featureFlags.DELETE("/:id", middleware.RequirePermission("features", "delete"), featureController.DeleteFeatureFlag)
+		}
+
+		// Attribute-based policy routes
+		policies := protected.Group("/policies")
+		{
+			policies.GET("", middleware.RequirePermission("policies", "read"), policyController.GetPolicies)
+			policies.GET("/:id", middleware.RequirePermission("policies", "read"), policyController.GetPolicy)
+			policies.POST("", middleware.RequirePermission("policies", "write"), policyController.CreatePolicy)
+			policies.POST("/evaluate", middleware.RequirePermission("policies", "read"), policyController.EvaluatePolicy)
+			policies.PUT("/:id", middleware.RequirePermission("policies", "write"), policyController.UpdatePolicy)
+			policies.DELETE("/:id", middleware.RequirePermission("policies", "delete"), policyController.DeletePolicy)
+		}
+
+		// Security monitoring routes
+		security := protected.Group("/security")
+		security.Use(middleware.AdminOnlyMiddleware())
+		{
+			// Token reuse, lockouts and expired assignments span every
+			// organization; the audit log is scoped to the current one
+			global := middleware.RequireDefaultOrganization()
+			security.GET("/token-reuse", global, securityController.GetTokenReuseEvents)
+			security.GET("/lockouts", global, securityController.GetLockouts)
+			security.DELETE("/lockouts/:id", global, securityController.ClearLockout)
+			security.GET("/expired-role-assignments", global, securityController.GetExpiredRoleAssignments)
+			security.GET("/audit-events", securityController.GetAuditEvents)
+		}
+
+		// Security log routes; the logs have their own permission rather than the admin role
+		securityLogs := protected.Group("/security")
+		securityLogs.Use(middleware.RequirePermission("security_logs", "read"))
+		{
+			securityLogs.GET("/requests", securityController.GetRequestLogs)
+			securityLogs.GET("/requests/stats", securityController.GetRequestLogStats)
+			securityLogs.GET("/failed-logins", securityController.GetFailedLogins)
+		}
+
 		// Legacy routes for backward compatibility
 		protected.GET("/users-legacy", func(c *gin.Context) {
 			users := []map[string]interface{}{
@@ -140,5 +283,39 @@ func main() {
 		port = "8080"
 	}
 
-	r.Run(":" + port)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// On SIGINT or SIGTERM, or when the server fails, finish in-flight
+	// requests, then flush the request log they queued
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	var failure error
+	select {
+	case <-quit:
+		log.Println("Shutting down...")
+	case failure = <-serverErr:
+		log.Printf("Server failed: %v; shutting down...", failure)
+	}
+	stopBackground()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to finish in-flight requests: %v", err)
+	}
+	if err := requestlog.Default.Close(ctx); err != nil {
+		log.Printf("Failed to flush the request log: %v", err)
+	}
+	stats := requestlog.Default.Stats()
+	log.Printf("Request log: %d written, %d dropped, %d failed", stats.Written, stats.Dropped, stats.Failed)
+	if failure != nil {
+		cancel()
+		os.Exit(1)
+	}
 }
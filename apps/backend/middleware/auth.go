@@ -3,11 +3,14 @@ package middleware
 import (
 	"backend/config"
 	"backend/models"
+	"backend/rbac"
+	"backend/tenant"
 	"backend/utils"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // AuthMiddleware validates JWT tokens
@@ -30,7 +33,7 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Get user from database
 		var user models.User
-		if err := config.DB.Preload("Roles.Permissions").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		if err := config.DB.Where("id = ?", claims.UserID).First(&user).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
@@ -42,9 +45,26 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Only the roles held in the token's organization apply
+		orgID, ok := organizationFor(c, &user, claims.OrganizationID)
+		if !ok {
+			return
+		}
+
+		if utils.EmailVerificationBlocks(&user) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                       "Email address not verified",
+				"email_verification_required": true,
+			})
+			c.Abort()
+			return
+		}
+		RestrictSession(&user)
+
 		// Store user in context
 		c.Set("user", user)
 		c.Set("user_id", user.ID)
+		c.Set("organization_id", orgID)
 		c.Next()
 	})
 }
@@ -60,8 +80,52 @@ func RequirePermission(resource, action string) gin.HandlerFunc {
 		}
 
 		u := user.(models.User)
-		if !hasPermission(u, resource, action) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		permissions, err := permissionsFor(c, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		if decision := permissions.Decide(resource, action); !decision.Allowed {
+			response := gin.H{"error": "Insufficient permissions"}
+			// Outside release mode, show which grant denied the request
+			if gin.IsDebugging() {
+				response["debug"] = decision
+			}
+			c.JSON(http.StatusForbidden, response)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// RequireScopedPermission lets through users allowed the action on at least
+// the rows they own, such as with users.write:own. The handler must then
+// check the target row with rbac.AuthorizeTarget.
+func RequireScopedPermission(resource, action string) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		u := user.(models.User)
+		permissions, err := permissionsFor(c, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		if permissions.Scope(resource, action) == "" {
+			response := gin.H{"error": "Insufficient permissions"}
+			if gin.IsDebugging() {
+				response["debug"] = permissions.DecideOwn(resource, action)
+			}
+			c.JSON(http.StatusForbidden, response)
 			c.Abort()
 			return
 		}
@@ -70,7 +134,8 @@ func RequirePermission(resource, action string) gin.HandlerFunc {
 	})
 }
 
-// RequireRole checks if user has specific role
+// RequireRole checks if user has specific role, and that no deny grant
+// takes back what it allows (see rbac.PermissionSet.ActsAs)
 func RequireRole(roleName string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		user, exists := c.Get("user")
@@ -81,7 +146,13 @@ func RequireRole(roleName string) gin.HandlerFunc {
 		}
 
 		u := user.(models.User)
-		if !hasRole(u, roleName) {
+		permissions, err := permissionsFor(c, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		if !permissions.ActsAs(roleName) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
 			c.Abort()
 			return
@@ -91,7 +162,7 @@ func RequireRole(roleName string) gin.HandlerFunc {
 	})
 }
 
-// RequireAnyRole checks if user has any of the specified roles
+// RequireAnyRole checks if user has any of the specified roles, as RequireRole does
 func RequireAnyRole(roleNames ...string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		user, exists := c.Get("user")
@@ -102,8 +173,14 @@ func RequireAnyRole(roleNames ...string) gin.HandlerFunc {
 		}
 
 		u := user.(models.User)
+		permissions, err := permissionsFor(c, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
 		for _, roleName := range roleNames {
-			if hasRole(u, roleName) {
+			if permissions.ActsAs(roleName) {
 				c.Next()
 				return
 			}
@@ -115,6 +192,69 @@ func RequireAnyRole(roleNames ...string) gin.HandlerFunc {
 }
 
 // Helper functions
+
+// organizationFor resolves the organization a request acts in and loads the
+// user's roles there. Tokens without an organization, issued before
+// organizations existed, act in the user's active one. It responds with 401
+// when the user is no longer a member.
+func organizationFor(c *gin.Context, user *models.User, tokenOrgID uuid.UUID) (uuid.UUID, bool) {
+	orgID := tokenOrgID
+	if orgID == uuid.Nil {
+		var err error
+		if orgID, err = tenant.ActiveOrganization(user, uuid.Nil); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not a member of any organization"})
+			c.Abort()
+			return uuid.Nil, false
+		}
+	} else if !tenant.IsMember(orgID, user.ID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not a member of this organization"})
+		c.Abort()
+		return uuid.Nil, false
+	}
+
+	if err := tenant.LoadRoles(user, orgID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		c.Abort()
+		return uuid.Nil, false
+	}
+	user.ActiveOrganizationID = &orgID
+	return orgID, true
+}
+
+// RestrictSession limits the roles a session acts with. Unverified accounts
+// keep only the default role under the restrict policy, and roles requiring
+// MFA stay inactive until the user has enrolled. It reports whether the user
+// must enroll.
+func RestrictSession(user *models.User) bool {
+	if utils.EmailVerificationRestricts(user) {
+		user.Roles = defaultRoleOnly(user.Roles)
+	}
+	return restrictUnenrolledMFA(user)
+}
+
+// restrictUnenrolledMFA leaves a user whose roles require MFA without it
+// enrolled only the default role, or no role when even that requires MFA
+func restrictUnenrolledMFA(user *models.User) bool {
+	if user.MFAEnabled || !utils.UserRequiresMFA(user) {
+		return false
+	}
+	user.Roles = defaultRoleOnly(user.Roles)
+	if utils.UserRequiresMFA(user) {
+		user.Roles = nil
+	}
+	return true
+}
+
+func defaultRoleOnly(roles []models.Role) []models.Role {
+	var kept []models.Role
+	for _, role := range roles {
+		if role.Name == models.DefaultRoleName {
+			kept = append(kept, role)
+		}
+	}
+	return kept
+}
+
 func getTokenFromRequest(c *gin.Context) string {
 	// Check Authorization header
 	bearerToken := c.GetHeader("Authorization")
@@ -126,22 +266,28 @@ func getTokenFromRequest(c *gin.Context) string {
 	return c.Query("token")
 }
 
-func hasPermission(user models.User, resource, action string) bool {
-	for _, role := range user.Roles {
-		for _, permission := range role.Permissions {
-			if permission.Resource == resource && permission.Action == action {
-				return true
-			}
-		}
-	}
-	return false
+// CurrentOrganization returns the organization the authenticated request acts in
+func CurrentOrganization(c *gin.Context) uuid.UUID {
+	return c.MustGet("organization_id").(uuid.UUID)
 }
 
-func hasRole(user models.User, roleName string) bool {
-	for _, role := range user.Roles {
-		if role.Name == roleName {
-			return true
-		}
+// CurrentPermissions returns the effective permissions of the authenticated user
+func CurrentPermissions(c *gin.Context) (*rbac.PermissionSet, error) {
+	return permissionsFor(c, c.MustGet("user").(models.User))
+}
+
+// permissionsFor returns the user's effective permissions, including those
+// inherited through parent roles. They are resolved once per request.
+func permissionsFor(c *gin.Context, user models.User) (*rbac.PermissionSet, error) {
+	if cached, exists := c.Get("permissions"); exists {
+		return cached.(*rbac.PermissionSet), nil
+	}
+
+	permissions, err := rbac.ForUser(&user)
+	if err != nil {
+		return nil, err
 	}
-	return false
+	permissions.OrganizationID = CurrentOrganization(c)
+	c.Set("permissions", permissions)
+	return permissions, nil
 }
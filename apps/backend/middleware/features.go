@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"backend/features"
+	"backend/models"
+	"backend/rbac"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// FeatureSubject describes a user acting in an organization, with the given
+// effective permissions, for feature flag evaluation
+func FeatureSubject(user *models.User, orgID uuid.UUID, permissions *rbac.PermissionSet) features.Subject {
+	roles := make([]string, 0, len(permissions.Roles))
+	for _, role := range permissions.Roles {
+		roles = append(roles, role.Name)
+	}
+	return features.Subject{UserID: user.ID, OrganizationID: orgID, Roles: roles}
+}
+
+// CurrentFeatureSubject is FeatureSubject for the authenticated user
+func CurrentFeatureSubject(c *gin.Context) (features.Subject, error) {
+	permissions, err := CurrentPermissions(c)
+	if err != nil {
+		return features.Subject{}, err
+	}
+	user := c.MustGet("user").(models.User)
+	return FeatureSubject(&user, CurrentOrganization(c), permissions), nil
+}
+
+// RequireFeature refuses the request unless the feature flag is on for the
+// current user. Routes behind a flag that is off respond as if they did not exist.
+func RequireFeature(name string) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		subject, err := CurrentFeatureSubject(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		enabled, err := features.Enabled(name, subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate feature flags"})
+			c.Abort()
+			return
+		}
+		if !enabled {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
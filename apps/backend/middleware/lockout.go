@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"backend/audit"
+	"backend/config"
+	"backend/models"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons recorded with failed login attempts
+const (
+	FailureUnknownUser     = "unknown_user"
+	FailureInvalidPassword = "invalid_password"
+	FailureAccountDisabled = "account_disabled"
+	FailureInvalidMFACode  = "invalid_mfa_code"
+)
+
+// AccountLockoutKey returns the key that failed logins for an account are
+// counted under. Known users are keyed by ID so that their username and email
+// share one counter; unknown identifiers are counted too, so a lockout looks
+// the same whether or not the account exists.
+func AccountLockoutKey(identifier string, user *models.User) string {
+	if user != nil {
+		return "user:" + user.ID.String()
+	}
+	return "name:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// LoginLockoutRemaining returns how long logins for the account key or from
+// the client IP are still refused, or zero when neither is locked
+func LoginLockoutRemaining(ip, accountKey string) time.Duration {
+	now := time.Now()
+
+	var lockouts []models.LoginLockout
+	config.DB.Where("(scope = ? AND key = ?) OR (scope = ? AND key = ?)",
+		models.LockoutScopeAccount, accountKey, models.LockoutScopeIP, ip).
+		Where("locked_until > ?", now).
+		Find(&lockouts)
+
+	var remaining time.Duration
+	for _, lockout := range lockouts {
+		if wait := lockout.LockedUntil.Sub(now); wait > remaining {
+			remaining = wait
+		}
+	}
+	return remaining
+}
+
+// RecordFailedLogin stores the attempt and counts it against the account
+// and the client IP, locking either once its threshold is reached
+func RecordFailedLogin(ip, accountKey, username, userAgent, reason string, userID *uuid.UUID) {
+	if err := audit.Append(config.DB, &models.FailedLogin{
+		IP:        ip,
+		Username:  username,
+		UserID:    userID,
+		UserAgent: userAgent,
+		Reason:    reason,
+	}); err != nil {
+		log.Printf("Failed to record failed login for %s: %v", accountKey, err)
+	}
+
+	settings := config.LoginLockout()
+	if err := countFailure(models.LockoutScopeAccount, accountKey, userID, settings.AccountThreshold, settings); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", accountKey, err)
+	}
+	if err := countFailure(models.LockoutScopeIP, ip, nil, settings.IPThreshold, settings); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", ip, err)
+	}
+}
+
+// ResetLoginFailures clears the account counter after a successful login.
+// The IP counter is left to expire so one valid account cannot be used to
+// keep resetting it between guesses against others.
+func ResetLoginFailures(accountKey string) {
+	config.DB.Where("scope = ? AND key = ?", models.LockoutScopeAccount, accountKey).Delete(&models.LoginLockout{})
+}
+
+func countFailure(scope, key string, userID *uuid.UUID, threshold int, settings config.LockoutConfig) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Make sure the row exists, then lock it so concurrent failures are all counted
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginLockout{
+			Scope:         scope,
+			Key:           key,
+			UserID:        userID,
+			LastFailureAt: now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var lockout models.LoginLockout
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND key = ?", scope, key).First(&lockout).Error; err != nil {
+			return err
+		}
+
+		// Start over once the window has passed without failures and no lock is active
+		locked := lockout.LockedUntil != nil && lockout.LockedUntil.After(now)
+		if !locked && now.Sub(lockout.LastFailureAt) > settings.Window {
+			lockout.Failures = 0
+			lockout.LockedUntil = nil
+		}
+
+		lockout.Failures++
+		lockout.LastFailureAt = now
+		if duration := settings.LockDuration(lockout.Failures, threshold); duration > 0 {
+			until := now.Add(duration)
+			lockout.LockedUntil = &until
+		}
+
+		return tx.Save(&lockout).Error
+	})
+}
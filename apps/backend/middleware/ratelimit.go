@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"backend/models"
+	"backend/ratelimit"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitRule limits requests to a single route per client IP
+type RateLimitRule struct {
+	Method string
+	Path   string // route pattern as registered, e.g. /api/v1/users/:id
+	Limit  ratelimit.Limit
+}
+
+// routeRateLimits are tighter limits for endpoints that attract brute force
+// or abuse. They apply in addition to the global per-IP limit.
+var routeRateLimits = []RateLimitRule{
+	{Method: "POST", Path: "/api/v1/auth/login", Limit: ratelimit.Limit{Requests: 10, Window: time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/register", Limit: ratelimit.Limit{Requests: 5, Window: time.Hour}},
+	{Method: "POST", Path: "/api/v1/auth/refresh", Limit: ratelimit.Limit{Requests: 30, Window: time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/mfa/verify", Limit: ratelimit.Limit{Requests: 10, Window: time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/forgot-password", Limit: ratelimit.Limit{Requests: 5, Window: 15 * time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/reset-password", Limit: ratelimit.Limit{Requests: 10, Window: 15 * time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/verify-email", Limit: ratelimit.Limit{Requests: 10, Window: 15 * time.Minute}},
+	{Method: "POST", Path: "/api/v1/auth/resend-verification", Limit: ratelimit.Limit{Requests: 5, Window: 15 * time.Minute}},
+}
+
+// rateLimitResultKey stores the most restrictive result seen for the request
+const rateLimitResultKey = "rate_limit_result"
+
+var (
+	fallbackLimiterOnce sync.Once
+	fallbackLimiter     *ratelimit.MemoryLimiter
+)
+
+// localLimiter returns the in-process limiter that enforces routeRateLimits
+// while ratelimit.Default is unavailable
+func localLimiter() ratelimit.Limiter {
+	fallbackLimiterOnce.Do(func() {
+		fallbackLimiter = ratelimit.NewMemoryLimiter(time.Minute)
+	})
+	return fallbackLimiter
+}
+
+// RateLimitByUser limits requests per authenticated user. It must run after
+// AuthMiddleware; requests without a user are passed through.
+func RateLimitByUser(limit ratelimit.Limit) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		key := "user:" + user.(models.User).ID.String()
+		if !allowRequest(c, key, limit, false) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// UserRateLimit returns the per-user limit from RATE_LIMIT_USER_REQUESTS and
+// RATE_LIMIT_USER_WINDOW (default: 300 requests per minute)
+func UserRateLimit() ratelimit.Limit {
+	return ratelimit.Limit{
+		Requests: envInt("RATE_LIMIT_USER_REQUESTS", 300),
+		Window:   envDuration("RATE_LIMIT_USER_WINDOW", time.Minute),
+	}
+}
+
+// checkRateLimit applies the global per-IP limit and any rule for the
+// matched route, writing the response itself when a limit is exceeded
+func checkRateLimit(c *gin.Context) bool {
+	clientIP := c.ClientIP()
+
+	global := ratelimit.Limit{Requests: securityConfig.RateLimitRequests, Window: securityConfig.RateLimitWindow}
+	if !allowRequest(c, "ip:"+clientIP, global, false) {
+		return false
+	}
+
+	route := c.FullPath()
+	for _, rule := range routeRateLimits {
+		if rule.Method == c.Request.Method && rule.Path == route {
+			if !allowRequest(c, "route:"+rule.Method+" "+rule.Path+":"+clientIP, rule.Limit, true) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allowRequest checks one limit and sets the RateLimit-* headers for the most
+// restrictive limit seen so far. Limiter errors let the request through
+// rather than taking the API down with the limiter's backend, except for
+// strict limits, which fall back to a limiter in this process.
+func allowRequest(c *gin.Context, key string, limit ratelimit.Limit, strict bool) bool {
+	if ratelimit.Default == nil || limit.Requests <= 0 {
+		return true
+	}
+
+	result, err := ratelimit.Default.Allow(c.Request.Context(), key, limit)
+	if err != nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		if !strict {
+			return true
+		}
+		if result, err = localLimiter().Allow(c.Request.Context(), key, limit); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rate limiter unavailable"})
+			return false
+		}
+	}
+
+	if previous, exists := c.Get(rateLimitResultKey); !exists || result.Remaining < previous.(ratelimit.Result).Remaining || !result.Allowed {
+		c.Set(rateLimitResultKey, result)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	}
+
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+func envInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
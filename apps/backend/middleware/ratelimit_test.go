@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"backend/ratelimit"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingLimiter stands for a limiter whose backend is unreachable
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+// rateLimitedRouter serves the login route and another route behind the
+// rate limits, with limiter as ratelimit.Default
+func rateLimitedRouter(t *testing.T, limiter ratelimit.Limiter) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previous, previousConfig := ratelimit.Default, securityConfig
+	ratelimit.Default = limiter
+	securityConfig.RateLimitRequests = 1000
+	securityConfig.RateLimitWindow = time.Hour
+	t.Cleanup(func() { ratelimit.Default, securityConfig = previous, previousConfig })
+	// Each test starts with an empty fallback limiter
+	if fallbackLimiter != nil {
+		fallbackLimiter.Close()
+	}
+	fallbackLimiterOnce, fallbackLimiter = sync.Once{}, nil
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if !checkRateLimit(c) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/v1/auth/login", ok)
+	r.GET("/api/v1/health", ok)
+	return r
+}
+
+func serve(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitLoginRoute(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(time.Hour)
+	defer limiter.Close()
+	r := rateLimitedRouter(t, limiter)
+
+	// The login rule allows 10 a minute and is tighter than the global limit,
+	// so its numbers are the ones reported
+	for i := 1; i <= 10; i++ {
+		w := serve(r, "POST", "/api/v1/auth/login")
+		if w.Code != http.StatusOK {
+			t.Fatalf("login %d = %d, want 200", i, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "10" {
+			t.Fatalf("login %d RateLimit-Limit = %q, want 10", i, got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(10-i) {
+			t.Fatalf("login %d RateLimit-Remaining = %q, want %d", i, got, 10-i)
+		}
+		if got := w.Header().Get("RateLimit-Reset"); got == "" || got == "0" {
+			t.Fatalf("login %d RateLimit-Reset = %q, want the seconds until refilled", i, got)
+		}
+	}
+
+	w := serve(r, "POST", "/api/v1/auth/login")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("11th login = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "6" {
+		t.Errorf("Retry-After = %q, want 6 (one token per 6s)", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	// Other routes only count against the global limit
+	w = serve(r, "GET", "/api/v1/health")
+	if w.Code != http.StatusOK {
+		t.Fatalf("other route = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "1000" {
+		t.Errorf("other route RateLimit-Limit = %q, want the global 1000", got)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After set on an allowed request")
+	}
+}
+
+func TestRateLimitFallsBackForRouteRules(t *testing.T) {
+	r := rateLimitedRouter(t, failingLimiter{})
+
+	// Without the limiter the global limit lets requests through
+	for i := 0; i < 20; i++ {
+		if w := serve(r, "GET", "/api/v1/health"); w.Code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200", i+1, w.Code)
+		}
+	}
+
+	// The login rule is still enforced, in this process
+	for i := 1; i <= 10; i++ {
+		if w := serve(r, "POST", "/api/v1/auth/login"); w.Code != http.StatusOK {
+			t.Fatalf("login %d = %d, want 200", i, w.Code)
+		}
+	}
+	if w := serve(r, "POST", "/api/v1/auth/login"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("11th login = %d, want 429 from the fallback limiter", w.Code)
+	}
+}
@@ -1,8 +1,8 @@
 package middleware
 
 import (
-	"backend/config"
 	"backend/models"
+	"backend/requestlog"
 	"crypto/subtle"
 	"net/http"
 	"os"
@@ -22,32 +22,7 @@ type SecurityConfig struct {
 	MaxRequestSize    int64
 }
 
-// RequestLog stores request information for security monitoring
-type RequestLog struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID    uuid.UUID `json:"user_id,omitempty" gorm:"type:uuid"`
-	IP        string    `json:"ip" gorm:"not null"`
-	Method    string    `json:"method" gorm:"not null"`
-	Path      string    `json:"path" gorm:"not null"`
-	UserAgent string    `json:"user_agent"`
-	Status    int       `json:"status"`
-	Duration  int64     `json:"duration"` // in milliseconds
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// FailedLogin tracks failed login attempts
-type FailedLogin struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	IP        string    `json:"ip" gorm:"not null"`
-	Username  string    `json:"username"`
-	UserAgent string    `json:"user_agent"`
-	Attempts  int       `json:"attempts" gorm:"default:1"`
-	LastTry   time.Time `json:"last_try"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
 var (
-	rateLimitStore = make(map[string][]time.Time)
 	securityConfig = SecurityConfig{
 		RateLimitRequests: 100,
 		RateLimitWindow:   time.Hour,
@@ -61,6 +36,9 @@ var (
 
 // SecurityMiddleware provides comprehensive security features
 func SecurityMiddleware() gin.HandlerFunc {
+	securityConfig.RateLimitRequests = envInt("RATE_LIMIT_REQUESTS", securityConfig.RateLimitRequests)
+	securityConfig.RateLimitWindow = envDuration("RATE_LIMIT_WINDOW", securityConfig.RateLimitWindow)
+
 	return gin.HandlerFunc(func(c *gin.Context) {
 		start := time.Now()
 
@@ -69,7 +47,6 @@ func SecurityMiddleware() gin.HandlerFunc {
 
 		// Rate limiting
 		if !checkRateLimit(c) {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
 			c.Abort()
 			return
 		}
@@ -106,32 +83,6 @@ func setSecurityHeaders(c *gin.Context) {
 	c.Header("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 }
 
-// checkRateLimit implements simple in-memory rate limiting
-func checkRateLimit(c *gin.Context) bool {
-	clientIP := c.ClientIP()
-	now := time.Now()
-
-	// Clean old entries
-	if requests, exists := rateLimitStore[clientIP]; exists {
-		var validRequests []time.Time
-		for _, reqTime := range requests {
-			if now.Sub(reqTime) < securityConfig.RateLimitWindow {
-				validRequests = append(validRequests, reqTime)
-			}
-		}
-		rateLimitStore[clientIP] = validRequests
-	}
-
-	// Check limit
-	if len(rateLimitStore[clientIP]) >= securityConfig.RateLimitRequests {
-		return false
-	}
-
-	// Add current request
-	rateLimitStore[clientIP] = append(rateLimitStore[clientIP], now)
-	return true
-}
-
 // isAllowedIP checks if IP is in whitelist
 func isAllowedIP(ip string) bool {
 	for _, allowedIP := range securityConfig.AllowedIPs {
@@ -142,17 +93,18 @@ func isAllowedIP(ip string) bool {
 	return false
 }
 
-// logRequest logs request for security monitoring
+// logRequest queues the request for the request log, which is written in
+// batches in the background
 func logRequest(c *gin.Context, start time.Time) {
 	duration := time.Since(start).Milliseconds()
 
-	var userID uuid.UUID
+	var userID *uuid.UUID
 	if user, exists := c.Get("user"); exists {
 		userObj := user.(models.User)
-		userID = userObj.ID
+		userID = &userObj.ID
 	}
 
-	requestLog := RequestLog{
+	requestlog.Log(models.RequestLog{
 		UserID:    userID,
 		IP:        c.ClientIP(),
 		Method:    c.Request.Method,
@@ -161,54 +113,11 @@ func logRequest(c *gin.Context, start time.Time) {
 		Status:    c.Writer.Status(),
 		Duration:  duration,
 		CreatedAt: time.Now(),
-	}
-
-	// Log to database (async to not block request)
-	go func() {
-		config.DB.Create(&requestLog)
-	}()
-}
-
-// LogFailedLogin logs failed login attempts for security monitoring
-func LogFailedLogin(ip, username, userAgent string) {
-	var failedLogin FailedLogin
-
-	// Check if there's an existing record for this IP
-	if err := config.DB.Where("ip = ?", ip).First(&failedLogin).Error; err != nil {
-		// Create new record
-		failedLogin = FailedLogin{
-			IP:        ip,
-			Username:  username,
-			UserAgent: userAgent,
-			Attempts:  1,
-			LastTry:   time.Now(),
-			CreatedAt: time.Now(),
-		}
-		config.DB.Create(&failedLogin)
-	} else {
-		// Update existing record
-		failedLogin.Username = username
-		failedLogin.Attempts++
-		failedLogin.LastTry = time.Now()
-		config.DB.Save(&failedLogin)
-	}
-
-	// If too many attempts, consider additional security measures
-	if failedLogin.Attempts >= 5 {
-		// Could implement IP blocking, admin notification, etc.
-		// For now, just log the event
-		config.DB.Create(&RequestLog{
-			IP:        ip,
-			Method:    "SECURITY",
-			Path:      "/security/suspicious-activity",
-			UserAgent: userAgent,
-			Status:    429,
-			CreatedAt: time.Now(),
-		})
-	}
+	})
 }
 
-// AdminOnlyMiddleware ensures only admin users can access certain endpoints
+// AdminOnlyMiddleware ensures only admin users can access certain endpoints.
+// Admins with any of the role's permissions denied are refused.
 func AdminOnlyMiddleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		user, exists := c.Get("user")
@@ -219,7 +128,13 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 		}
 
 		u := user.(models.User)
-		if !hasRole(u, "admin") {
+		permissions, err := permissionsFor(c, u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		if !permissions.ActsAs("admin") {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
@@ -293,3 +208,16 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// RequireDefaultOrganization refuses requests acting in any organization but
+// the default one, for endpoints whose data spans every organization
+func RequireDefaultOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentOrganization(c) != models.DefaultOrganizationID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only available in the default organization"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,144 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"backend/migrations"
+	"backend/testdb"
+)
+
+func TestAllOrdered(t *testing.T) {
+	all, err := migrations.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, m := range all {
+		if i > 0 && m.Version <= all[i-1].Version {
+			t.Errorf("migration %d follows %d", m.Version, all[i-1].Version)
+		}
+		if m.Name == "" || m.Up == "" || m.Down == "" {
+			t.Errorf("migration %d is missing its name, up or down file", m.Version)
+		}
+	}
+}
+
+func TestUpDownRoundTrip(t *testing.T) {
+	db := sqlDB(t)
+	ctx := context.Background()
+	all, err := migrations.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := all[len(all)-1]
+
+	pending, err := migrations.Pending(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(all) {
+		t.Fatalf("%d pending on an empty schema, want %d", len(pending), len(all))
+	}
+
+	applied, err := migrations.Up(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(all) {
+		t.Fatalf("Up applied %d migrations, want %d", len(applied), len(all))
+	}
+	assertPending(t, db, 0)
+
+	if applied, err := migrations.Up(ctx, db); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up: applied %d (%v), want none", len(applied), err)
+	}
+
+	// Down reverts the latest migration first
+	reverted, err := migrations.Down(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != latest.Version {
+		t.Fatalf("Down(1) reverted %v, want %d", reverted, latest.Version)
+	}
+	pending, err = migrations.Pending(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != latest.Version {
+		t.Fatalf("pending after Down(1) = %v, want only %d", pending, latest.Version)
+	}
+
+	// Every down file undoes its up file, so the whole chain can be replayed
+	if reverted, err := migrations.Down(ctx, db, len(all)); err != nil || len(reverted) != len(all)-1 {
+		t.Fatalf("Down(all): reverted %d (%v), want %d", len(reverted), err, len(all)-1)
+	}
+	assertPending(t, db, len(all))
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM pg_tables WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatalf("%d tables are left after reverting every migration", tables)
+	}
+	if applied, err := migrations.Up(ctx, db); err != nil || len(applied) != len(all) {
+		t.Fatalf("Up after Down(all): applied %d (%v), want %d", len(applied), err, len(all))
+	}
+}
+
+func TestConcurrentUpAppliesOnce(t *testing.T) {
+	db := sqlDB(t)
+	all, err := migrations.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, 3)
+	errs := make([]error, len(counts))
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			applied, err := migrations.Up(context.Background(), db)
+			counts[i], errs[i] = len(applied), err
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Up %d: %v", i, err)
+		}
+		total += counts[i]
+	}
+	if total != len(all) {
+		t.Fatalf("concurrent runs applied %d migrations in total, want %d", total, len(all))
+	}
+}
+
+func sqlDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := testdb.Empty(t).DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func assertPending(t *testing.T, db *sql.DB, want int) {
+	t.Helper()
+	pending, err := migrations.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != want {
+		t.Fatalf("%d migrations pending, want %d", len(pending), want)
+	}
+}
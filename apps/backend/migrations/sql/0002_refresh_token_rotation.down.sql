@@ -0,0 +1,13 @@
+-- Hashed tokens cannot be turned back into plaintext; all sessions end.
+DROP TABLE IF EXISTS refresh_token_reuse_events;
+
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS selector,
+    DROP COLUMN IF EXISTS verifier_hash,
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS parent_id,
+    DROP COLUMN IF EXISTS replaced_by_id,
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS revoked_reason,
+    ADD COLUMN token varchar(500) NOT NULL UNIQUE;
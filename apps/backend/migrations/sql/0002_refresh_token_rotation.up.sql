@@ -0,0 +1,37 @@
+-- Refresh tokens are stored as a selector and a keyed verifier hash and are
+-- rotated on every use. Plaintext tokens cannot be converted, so they are
+-- deleted and their users have to log in again.
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'refresh_tokens' AND column_name = 'token'
+    ) THEN
+        DELETE FROM refresh_tokens;
+        ALTER TABLE refresh_tokens DROP COLUMN token;
+    END IF;
+END $$;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS selector varchar(64) NOT NULL,
+    ADD COLUMN IF NOT EXISTS verifier_hash varchar(64) NOT NULL,
+    ADD COLUMN IF NOT EXISTS family_id uuid,
+    ADD COLUMN IF NOT EXISTS parent_id uuid,
+    ADD COLUMN IF NOT EXISTS replaced_by_id uuid,
+    ADD COLUMN IF NOT EXISTS revoked_at timestamptz,
+    ADD COLUMN IF NOT EXISTS revoked_reason text;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_selector ON refresh_tokens (selector);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS refresh_token_reuse_events (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    family_id uuid NOT NULL,
+    token_id uuid NOT NULL,
+    ip text,
+    user_agent text,
+    created_at timestamptz,
+    CONSTRAINT fk_refresh_token_reuse_events_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_reuse_events_user_id ON refresh_token_reuse_events (user_id);
@@ -0,0 +1,19 @@
+-- TOTP two-factor authentication and recovery codes
+
+ALTER TABLE roles
+    ADD COLUMN IF NOT EXISTS require_mfa boolean DEFAULT false;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS mfa_enabled boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS mfa_secret text,
+    ADD COLUMN IF NOT EXISTS mfa_pending text,
+    ADD COLUMN IF NOT EXISTS mfa_last_step bigint DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
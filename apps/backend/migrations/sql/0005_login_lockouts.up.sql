@@ -0,0 +1,27 @@
+-- Failed login attempts and account/IP lockouts
+
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    scope varchar(16) NOT NULL,
+    key varchar(255) NOT NULL,
+    user_id uuid,
+    failures bigint NOT NULL,
+    locked_until timestamptz,
+    last_failure_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_lockouts_scope_key ON login_lockouts (scope, key);
+CREATE INDEX IF NOT EXISTS idx_login_lockouts_user_id ON login_lockouts (user_id);
+
+CREATE TABLE IF NOT EXISTS failed_logins (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    ip text NOT NULL,
+    username text,
+    user_id uuid,
+    user_agent text,
+    reason text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_ip ON failed_logins (ip);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_user_id ON failed_logins (user_id);
@@ -0,0 +1,12 @@
+-- Roles inherit the permissions of their parent roles
+
+CREATE TABLE IF NOT EXISTS role_parents (
+    role_id uuid NOT NULL,
+    parent_id uuid NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (role_id, parent_id),
+    CONSTRAINT fk_role_parents_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    CONSTRAINT fk_role_parents_parent FOREIGN KEY (parent_id) REFERENCES roles (id) ON DELETE CASCADE,
+    CONSTRAINT chk_role_parents_not_self CHECK (role_id <> parent_id)
+);
+CREATE INDEX IF NOT EXISTS idx_role_parents_parent_id ON role_parents (parent_id);
@@ -0,0 +1,4 @@
+-- Dropping the column would turn every deny into an allow
+DELETE FROM role_permissions WHERE effect = 'deny';
+ALTER TABLE role_permissions DROP CONSTRAINT IF EXISTS chk_role_permissions_effect;
+ALTER TABLE role_permissions DROP COLUMN IF EXISTS effect;
@@ -0,0 +1,10 @@
+-- Role permission grants either allow or deny; a deny overrides any allow
+
+ALTER TABLE role_permissions ADD COLUMN IF NOT EXISTS effect varchar(10) NOT NULL DEFAULT 'allow';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_role_permissions_effect') THEN
+        ALTER TABLE role_permissions ADD CONSTRAINT chk_role_permissions_effect CHECK (effect IN ('allow', 'deny'));
+    END IF;
+END $$;
@@ -0,0 +1,5 @@
+-- Without the column own-scoped permissions would apply to every row
+DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE scope = 'own');
+DELETE FROM permissions WHERE scope = 'own';
+ALTER TABLE permissions DROP CONSTRAINT IF EXISTS chk_permissions_scope;
+ALTER TABLE permissions DROP COLUMN IF EXISTS scope;
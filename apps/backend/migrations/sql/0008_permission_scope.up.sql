@@ -0,0 +1,11 @@
+-- Own-scoped permissions such as users.write:own only apply to rows the
+-- user owns; existing permissions keep applying to every row
+
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS scope varchar(10) NOT NULL DEFAULT 'any';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_permissions_scope') THEN
+        ALTER TABLE permissions ADD CONSTRAINT chk_permissions_scope CHECK (scope IN ('any', 'own'));
+    END IF;
+END $$;
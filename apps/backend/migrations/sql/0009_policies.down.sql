@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS policies;
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,19 @@
+-- Attribute-based access policies and the user attributes they can refer to
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS policies (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL UNIQUE,
+    description text,
+    resource text NOT NULL,
+    action text NOT NULL,
+    effect varchar(10) NOT NULL CHECK (effect IN ('allow', 'deny')),
+    priority bigint NOT NULL DEFAULT 0,
+    conditions jsonb NOT NULL DEFAULT '[]',
+    enabled boolean NOT NULL DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_policies_deleted_at ON policies (deleted_at);
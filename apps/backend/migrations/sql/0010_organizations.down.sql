@@ -0,0 +1,20 @@
+-- Only the default organization's role assignments are kept
+DROP TABLE IF EXISTS organization_invitations;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS active_organization_id;
+
+DELETE FROM user_roles WHERE role_id IN (SELECT id FROM roles WHERE organization_id IS NOT NULL);
+DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE organization_id IS NOT NULL);
+DELETE FROM role_parents WHERE role_id IN (SELECT id FROM roles WHERE organization_id IS NOT NULL)
+    OR parent_id IN (SELECT id FROM roles WHERE organization_id IS NOT NULL);
+DELETE FROM roles WHERE organization_id IS NOT NULL;
+ALTER TABLE roles DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM user_roles WHERE organization_id <> '00000000-0000-0000-0000-000000000001';
+ALTER TABLE user_roles DROP CONSTRAINT IF EXISTS fk_user_roles_organization;
+ALTER TABLE user_roles DROP CONSTRAINT IF EXISTS user_roles_pkey;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE user_roles ADD PRIMARY KEY (user_id, role_id);
+
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
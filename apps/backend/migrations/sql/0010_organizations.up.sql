@@ -0,0 +1,74 @@
+-- Organizations. Users can belong to several, with different roles in each.
+-- Everything that existed before is adopted by the default organization.
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    slug text NOT NULL UNIQUE,
+    created_by uuid,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_organizations_deleted_at ON organizations (deleted_at);
+
+INSERT INTO organizations (id, name, slug, created_at, updated_at)
+VALUES ('00000000-0000-0000-0000-000000000001', 'Default', 'default', now(), now())
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    invited_by uuid,
+    created_at timestamptz,
+    PRIMARY KEY (organization_id, user_id),
+    CONSTRAINT fk_organization_members_organization FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    CONSTRAINT fk_organization_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
+
+INSERT INTO organization_members (organization_id, user_id, created_at)
+SELECT '00000000-0000-0000-0000-000000000001', id, now() FROM users
+ON CONFLICT DO NOTHING;
+
+-- Role assignments become per organization
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'user_roles' AND column_name = 'organization_id'
+    ) THEN
+        ALTER TABLE user_roles ADD COLUMN organization_id uuid;
+        UPDATE user_roles SET organization_id = '00000000-0000-0000-0000-000000000001';
+        ALTER TABLE user_roles ALTER COLUMN organization_id SET NOT NULL;
+        ALTER TABLE user_roles DROP CONSTRAINT IF EXISTS user_roles_pkey;
+        ALTER TABLE user_roles ADD PRIMARY KEY (user_id, role_id, organization_id);
+        ALTER TABLE user_roles ADD CONSTRAINT fk_user_roles_organization
+            FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS idx_user_roles_organization_user ON user_roles (organization_id, user_id);
+
+-- Roles created inside an organization; NULL for roles shared by all
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS organization_id uuid REFERENCES organizations (id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_roles_organization_id ON roles (organization_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active_organization_id uuid;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS organization_id uuid;
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id uuid NOT NULL,
+    email text NOT NULL,
+    role_id uuid NOT NULL,
+    selector varchar(64) NOT NULL,
+    verifier_hash varchar(64) NOT NULL,
+    invited_by uuid NOT NULL,
+    expires_at timestamptz NOT NULL,
+    accepted_at timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_organization_invitations_organization FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    CONSTRAINT fk_organization_invitations_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_organization_id ON organization_invitations (organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_selector ON organization_invitations (selector);
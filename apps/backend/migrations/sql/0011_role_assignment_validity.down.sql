@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS expired_role_assignments;
+DROP INDEX IF EXISTS idx_user_roles_expires_at;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS reason;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS starts_at;
@@ -0,0 +1,22 @@
+-- Role assignments can start later and expire; expired ones are moved to
+-- expired_role_assignments by the sweeper
+
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS starts_at timestamptz;
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS reason text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_user_roles_expires_at ON user_roles (expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS expired_role_assignments (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    role_id uuid NOT NULL,
+    organization_id uuid NOT NULL,
+    assigned_by uuid,
+    assigned_at timestamptz,
+    starts_at timestamptz,
+    expires_at timestamptz NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    removed_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_expired_role_assignments_user_id ON expired_role_assignments (user_id);
+CREATE INDEX IF NOT EXISTS idx_expired_role_assignments_removed_at ON expired_role_assignments (removed_at);
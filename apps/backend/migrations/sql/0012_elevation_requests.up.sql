@@ -0,0 +1,31 @@
+-- Just-in-time elevation: temporary roles requested by users and approved
+-- by someone else, with every step recorded in elevation_events
+
+CREATE TABLE IF NOT EXISTS elevation_requests (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id uuid NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id uuid NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    duration_seconds bigint NOT NULL,
+    justification text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    decided_by uuid,
+    decided_at timestamptz,
+    decision_note text NOT NULL DEFAULT '',
+    expires_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_elevation_requests_organization_id ON elevation_requests (organization_id);
+CREATE INDEX IF NOT EXISTS idx_elevation_requests_user_id ON elevation_requests (user_id);
+CREATE INDEX IF NOT EXISTS idx_elevation_requests_status ON elevation_requests (status);
+
+CREATE TABLE IF NOT EXISTS elevation_events (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id uuid NOT NULL REFERENCES elevation_requests (id) ON DELETE CASCADE,
+    actor_id uuid NOT NULL,
+    action text NOT NULL,
+    note text NOT NULL DEFAULT '',
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_elevation_events_request_id ON elevation_events (request_id);
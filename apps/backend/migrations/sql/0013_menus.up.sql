@@ -0,0 +1,19 @@
+-- Navigation menus, previously hard-coded in the backend. The default
+-- entries are added by the seed.
+
+CREATE TABLE IF NOT EXISTS menus (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    parent_id uuid REFERENCES menus (id) ON DELETE RESTRICT,
+    name text NOT NULL UNIQUE,
+    label text NOT NULL,
+    icon text NOT NULL DEFAULT '',
+    path text NOT NULL DEFAULT '',
+    permission text NOT NULL,
+    feature text NOT NULL DEFAULT '',
+    sort_order integer NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_menus_parent_id ON menus (parent_id);
+CREATE INDEX IF NOT EXISTS idx_menus_deleted_at ON menus (deleted_at);
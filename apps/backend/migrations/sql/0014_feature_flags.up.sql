@@ -0,0 +1,18 @@
+-- Feature flags with per-environment defaults and targeting. The default
+-- flags are added by the seed.
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT '',
+    default_on boolean NOT NULL DEFAULT false,
+    environments jsonb NOT NULL DEFAULT '{}',
+    roles jsonb NOT NULL DEFAULT '[]',
+    user_ids jsonb NOT NULL DEFAULT '[]',
+    organization_ids jsonb NOT NULL DEFAULT '[]',
+    percentage integer NOT NULL DEFAULT 0 CHECK (percentage BETWEEN 0 AND 100),
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_feature_flags_deleted_at ON feature_flags (deleted_at);
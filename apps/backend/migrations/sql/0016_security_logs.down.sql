@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_failed_logins_created_at_id;
+DROP TABLE IF EXISTS request_logs;
@@ -0,0 +1,23 @@
+-- request_logs was only ever created by the former AutoMigrate startup; the
+-- indexes serve the security log queries, which page newest first
+
+CREATE TABLE IF NOT EXISTS request_logs (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid,
+    ip text NOT NULL,
+    method text NOT NULL,
+    path text NOT NULL,
+    user_agent text,
+    status bigint,
+    duration bigint,
+    created_at timestamptz
+);
+
+-- Anonymous requests used to be logged with the nil UUID
+UPDATE request_logs SET user_id = NULL WHERE user_id = '00000000-0000-0000-0000-000000000000';
+
+CREATE INDEX IF NOT EXISTS idx_request_logs_created_at_id ON request_logs (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_request_logs_user_id ON request_logs (user_id);
+CREATE INDEX IF NOT EXISTS idx_request_logs_ip ON request_logs (ip);
+
+CREATE INDEX IF NOT EXISTS idx_failed_logins_created_at_id ON failed_logins (created_at DESC, id DESC);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS chain_checkpoints;
+DROP TABLE IF EXISTS chain_heads;
+
+ALTER TABLE request_logs DROP COLUMN IF EXISTS hash;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS chain_seq;
+
+ALTER TABLE failed_logins DROP COLUMN IF EXISTS hash;
+ALTER TABLE failed_logins DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE failed_logins DROP COLUMN IF EXISTS chain_seq;
+
+ALTER TABLE audit_events DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS chain_seq;
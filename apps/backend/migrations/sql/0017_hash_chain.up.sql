@@ -0,0 +1,36 @@
+-- Hash chain over the audit and security logs. Rows written before the chain
+-- existed keep a NULL chain_seq and are not verified.
+
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS chain_seq bigint;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash text NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash text NOT NULL DEFAULT '';
+
+ALTER TABLE failed_logins ADD COLUMN IF NOT EXISTS chain_seq bigint;
+ALTER TABLE failed_logins ADD COLUMN IF NOT EXISTS prev_hash text NOT NULL DEFAULT '';
+ALTER TABLE failed_logins ADD COLUMN IF NOT EXISTS hash text NOT NULL DEFAULT '';
+
+ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS chain_seq bigint;
+ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS prev_hash text NOT NULL DEFAULT '';
+ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS hash text NOT NULL DEFAULT '';
+
+-- The last link of each chain per UTC day; writers lock the row to append
+CREATE TABLE IF NOT EXISTS chain_heads (
+    chain text NOT NULL,
+    day date NOT NULL,
+    seq bigint NOT NULL,
+    hash text NOT NULL,
+    PRIMARY KEY (chain, day)
+);
+
+-- Seals over finished days, each linked to the chain's previous checkpoint
+CREATE TABLE IF NOT EXISTS chain_checkpoints (
+    chain text NOT NULL,
+    day date NOT NULL,
+    seq bigint NOT NULL,
+    hash text NOT NULL,
+    prev_hash text NOT NULL DEFAULT '',
+    key_id text NOT NULL DEFAULT '',
+    signature text NOT NULL DEFAULT '',
+    created_at timestamptz,
+    PRIMARY KEY (chain, day)
+);
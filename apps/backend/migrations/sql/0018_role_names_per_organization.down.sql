@@ -0,0 +1,4 @@
+-- Fails while two organizations have roles with the same name
+DROP INDEX IF EXISTS idx_roles_shared_name;
+DROP INDEX IF EXISTS idx_roles_organization_name;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
@@ -0,0 +1,7 @@
+-- Role names only need to be unique within an organization, and among the
+-- shared roles. A shared role's name can still not be reused by an
+-- organization; the role controller checks that.
+
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_organization_name ON roles (organization_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_shared_name ON roles (name) WHERE organization_id IS NULL;
@@ -0,0 +1,23 @@
+-- The permissions and their grants come back; flag targeting is kept
+INSERT INTO permissions (id, name, description, resource, action, scope, created_at, updated_at)
+VALUES
+    (gen_random_uuid(), 'feature.export', 'Export Data', 'feature', 'export', 'any', now(), now()),
+    (gen_random_uuid(), 'feature.import', 'Import Data', 'feature', 'import', 'any', now(), now()),
+    (gen_random_uuid(), 'feature.backup', 'Backup System', 'feature', 'backup', 'any', now(), now()),
+    (gen_random_uuid(), 'feature.maintenance', 'System Maintenance', 'feature', 'maintenance', 'any', now(), now())
+ON CONFLICT (name) DO NOTHING;
+
+-- Custom feature permissions are restored with the grants that used them
+INSERT INTO permissions (id, name, description, resource, action, scope, created_at, updated_at)
+SELECT gen_random_uuid(), grants.permission_name, '', 'feature', split_part(grants.permission_name, '.', 2), 'any', now(), now()
+FROM (SELECT DISTINCT permission_name FROM feature_permission_grants) grants
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id, effect)
+SELECT feature_permission_grants.role_id, permissions.id, feature_permission_grants.effect
+FROM feature_permission_grants
+JOIN permissions ON permissions.name = feature_permission_grants.permission_name
+JOIN roles ON roles.id = feature_permission_grants.role_id
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS feature_permission_grants;
@@ -0,0 +1,68 @@
+-- The feature.* permissions stopped deciding anything once features became
+-- flags. Shared roles still granted one, custom roles included, are added to
+-- the targeting of the flag named by its action, and the permissions are
+-- removed. Flags the seed has not created yet get their targeting from
+-- seed.yaml.
+--
+-- Flags target roles by name across every organization, so a grant on an
+-- organization's own role has no faithful equivalent. The migration stops
+-- while such grants exist; move them to the flag's user or organization
+-- targeting, or remove them, and run it again.
+
+DO $$
+DECLARE
+    held text;
+BEGIN
+    SELECT string_agg(DISTINCT roles.name || ' (' || permissions.name || ')', ', ')
+    INTO held
+    FROM role_permissions
+    JOIN permissions ON permissions.id = role_permissions.permission_id
+    JOIN roles ON roles.id = role_permissions.role_id
+    WHERE permissions.resource = 'feature'
+        AND role_permissions.effect = 'allow'
+        AND roles.organization_id IS NOT NULL
+        AND roles.deleted_at IS NULL;
+    IF held IS NOT NULL THEN
+        RAISE EXCEPTION 'organization roles still grant feature permissions: %', held
+            USING HINT = 'Target the flags by user or organization instead, then remove these grants';
+    END IF;
+END $$;
+
+-- Kept so the down migration can restore the grants
+CREATE TABLE IF NOT EXISTS feature_permission_grants (
+    role_id uuid NOT NULL,
+    permission_name text NOT NULL,
+    effect text NOT NULL,
+    PRIMARY KEY (role_id, permission_name)
+);
+INSERT INTO feature_permission_grants (role_id, permission_name, effect)
+SELECT role_permissions.role_id, permissions.name, role_permissions.effect
+FROM role_permissions
+JOIN permissions ON permissions.id = role_permissions.permission_id
+WHERE permissions.resource = 'feature'
+ON CONFLICT DO NOTHING;
+
+WITH grants AS (
+    SELECT DISTINCT permissions.action AS flag, roles.name AS role
+    FROM role_permissions
+    JOIN permissions ON permissions.id = role_permissions.permission_id
+    JOIN roles ON roles.id = role_permissions.role_id
+    WHERE permissions.resource = 'feature'
+        AND role_permissions.effect = 'allow'
+        AND roles.organization_id IS NULL
+        AND roles.deleted_at IS NULL
+)
+UPDATE feature_flags
+SET roles = feature_flags.roles || missing.roles, updated_at = now()
+FROM (
+    SELECT grants.flag, jsonb_agg(grants.role ORDER BY grants.role) AS roles
+    FROM grants
+    JOIN feature_flags ON feature_flags.name = grants.flag
+    WHERE NOT feature_flags.roles @> to_jsonb(grants.role)
+    GROUP BY grants.flag
+) missing
+WHERE feature_flags.name = missing.flag;
+
+DELETE FROM role_permissions
+WHERE permission_id IN (SELECT id FROM permissions WHERE resource = 'feature');
+DELETE FROM permissions WHERE resource = 'feature';
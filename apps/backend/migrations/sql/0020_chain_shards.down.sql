@@ -0,0 +1,20 @@
+-- Records and heads of shards other than 0 cannot be merged back into one
+-- chain; they are kept unlinked and dropped respectively.
+
+UPDATE audit_events SET chain_seq = NULL, prev_hash = '', hash = '' WHERE chain_shard <> 0;
+UPDATE failed_logins SET chain_seq = NULL, prev_hash = '', hash = '' WHERE chain_shard <> 0;
+UPDATE request_logs SET chain_seq = NULL, prev_hash = '', hash = '' WHERE chain_shard <> 0;
+
+DELETE FROM chain_checkpoints WHERE shard <> 0;
+ALTER TABLE chain_checkpoints DROP CONSTRAINT IF EXISTS chain_checkpoints_pkey;
+ALTER TABLE chain_checkpoints DROP COLUMN IF EXISTS shard;
+ALTER TABLE chain_checkpoints ADD PRIMARY KEY (chain, day);
+
+DELETE FROM chain_heads WHERE shard <> 0;
+ALTER TABLE chain_heads DROP CONSTRAINT IF EXISTS chain_heads_pkey;
+ALTER TABLE chain_heads DROP COLUMN IF EXISTS shard;
+ALTER TABLE chain_heads ADD PRIMARY KEY (chain, day);
+
+ALTER TABLE request_logs DROP COLUMN IF EXISTS chain_shard;
+ALTER TABLE failed_logins DROP COLUMN IF EXISTS chain_shard;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS chain_shard;
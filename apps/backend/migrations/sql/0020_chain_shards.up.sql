@@ -0,0 +1,14 @@
+-- Split each hash chain into shards so that appends to different shards do
+-- not wait for each other. Records linked so far belong to shard 0.
+
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS chain_shard smallint NOT NULL DEFAULT 0;
+ALTER TABLE failed_logins ADD COLUMN IF NOT EXISTS chain_shard smallint NOT NULL DEFAULT 0;
+ALTER TABLE request_logs ADD COLUMN IF NOT EXISTS chain_shard smallint NOT NULL DEFAULT 0;
+
+ALTER TABLE chain_heads ADD COLUMN IF NOT EXISTS shard smallint NOT NULL DEFAULT 0;
+ALTER TABLE chain_heads DROP CONSTRAINT IF EXISTS chain_heads_pkey;
+ALTER TABLE chain_heads ADD PRIMARY KEY (chain, shard, day);
+
+ALTER TABLE chain_checkpoints ADD COLUMN IF NOT EXISTS shard smallint NOT NULL DEFAULT 0;
+ALTER TABLE chain_checkpoints DROP CONSTRAINT IF EXISTS chain_checkpoints_pkey;
+ALTER TABLE chain_checkpoints ADD PRIMARY KEY (chain, shard, day);
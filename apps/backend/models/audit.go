@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditEvent records one administrative change or authentication event.
+// Before and After hold only the fields of the target that changed; a
+// created target has an empty Before and a deleted one an empty After.
+type AuditEvent struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	OrganizationID *uuid.UUID `json:"organization_id" gorm:"type:uuid;index"`
+	ActorID        *uuid.UUID `json:"actor_id" gorm:"type:uuid;index"` // nil for anonymous requests
+	Action         string     `json:"action" gorm:"not null;index"`
+	TargetType     string     `json:"target_type" gorm:"not null"`
+	TargetID       *uuid.UUID `json:"target_id" gorm:"type:uuid"`
+	Before         JSONMap    `json:"before" gorm:"type:jsonb;not null;default:'{}'"`
+	After          JSONMap    `json:"after" gorm:"type:jsonb;not null;default:'{}'"`
+	IP             string     `json:"ip"`
+	UserAgent      string     `json:"user_agent"`
+	RequestID      string     `json:"request_id"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index"`
+	ChainLink      `gorm:"embedded"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+func (ae *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if ae.ID == uuid.Nil {
+		ae.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChainLink places a record in the hash chain of its table. Each table's
+// chain is split into shards, so unrelated writers do not wait for each
+// other, and each UTC day of a shard is its own segment: ChainSeq counts
+// from 1 within the segment and Hash covers the record's content and the
+// PrevHash of the record before it. Records written before the chain existed
+// have no link.
+type ChainLink struct {
+	ChainShard int16  `json:"chain_shard" gorm:"not null;default:0"`
+	ChainSeq   *int64 `json:"chain_seq,omitempty"`
+	PrevHash   string `json:"prev_hash,omitempty" gorm:"not null;default:''"`
+	Hash       string `json:"hash,omitempty" gorm:"not null;default:''"`
+}
+
+// Chained is a record kept in a hash chain by audit.Append
+type Chained interface {
+	// ChainName names the chain, which is the record's table
+	ChainName() string
+	// ChainFields returns the fields audit.Append fills in before hashing
+	ChainFields() (id *uuid.UUID, createdAt *time.Time, link *ChainLink)
+	// ChainPayload returns the content covered by the hash
+	ChainPayload() interface{}
+	// ChainShardKey picks the record's shard; records with the same key
+	// share one
+	ChainShardKey() uuid.UUID
+}
+
+// ChainHead is the last link of one day of a chain shard. Writers lock it
+// to append, so the links of a segment are written one at a time.
+type ChainHead struct {
+	Chain string    `gorm:"primaryKey"`
+	Shard int16     `gorm:"primaryKey"`
+	Day   time.Time `gorm:"type:date;primaryKey"`
+	Seq   int64     `gorm:"not null"`
+	Hash  string    `gorm:"not null"`
+}
+
+// ChainCheckpoint seals a finished day of a chain shard. PrevHash is the
+// Hash of the shard's previous checkpoint, so checkpoints cannot be removed
+// unnoticed either. Signature is empty unless checkpoints are signed.
+type ChainCheckpoint struct {
+	Chain     string    `json:"chain" gorm:"primaryKey"`
+	Shard     int16     `json:"shard" gorm:"primaryKey"`
+	Day       time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Seq       int64     `json:"seq" gorm:"not null"`
+	Hash      string    `json:"hash" gorm:"not null"`
+	PrevHash  string    `json:"prev_hash" gorm:"not null;default:''"`
+	KeyID     string    `json:"key_id" gorm:"not null;default:''"`
+	Signature string    `json:"signature" gorm:"not null;default:''"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ChainHead) TableName() string {
+	return "chain_heads"
+}
+
+func (ChainCheckpoint) TableName() string {
+	return "chain_checkpoints"
+}
+
+// The fields each chained record is hashed with. New columns stay out of the
+// hash until added here, which would break the chain of older records.
+
+type auditEventPayload struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID *uuid.UUID `json:"organization_id"`
+	ActorID        *uuid.UUID `json:"actor_id"`
+	Action         string     `json:"action"`
+	TargetType     string     `json:"target_type"`
+	TargetID       *uuid.UUID `json:"target_id"`
+	Before         JSONMap    `json:"before"`
+	After          JSONMap    `json:"after"`
+	IP             string     `json:"ip"`
+	UserAgent      string     `json:"user_agent"`
+	RequestID      string     `json:"request_id"`
+	CreatedAt      string     `json:"created_at"`
+}
+
+type failedLoginPayload struct {
+	ID        uuid.UUID  `json:"id"`
+	IP        string     `json:"ip"`
+	Username  string     `json:"username"`
+	UserID    *uuid.UUID `json:"user_id"`
+	UserAgent string     `json:"user_agent"`
+	Reason    string     `json:"reason"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type requestLogPayload struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    *uuid.UUID `json:"user_id"`
+	IP        string     `json:"ip"`
+	Method    string     `json:"method"`
+	Path      string     `json:"path"`
+	UserAgent string     `json:"user_agent"`
+	Status    int        `json:"status"`
+	Duration  int64      `json:"duration"`
+	CreatedAt string     `json:"created_at"`
+}
+
+func (ae *AuditEvent) ChainName() string {
+	return ae.TableName()
+}
+
+func (ae *AuditEvent) ChainFields() (*uuid.UUID, *time.Time, *ChainLink) {
+	return &ae.ID, &ae.CreatedAt, &ae.ChainLink
+}
+
+func (ae *AuditEvent) ChainPayload() interface{} {
+	return auditEventPayload{
+		ID:             ae.ID,
+		OrganizationID: ae.OrganizationID,
+		ActorID:        ae.ActorID,
+		Action:         ae.Action,
+		TargetType:     ae.TargetType,
+		TargetID:       ae.TargetID,
+		Before:         chainJSON(ae.Before),
+		After:          chainJSON(ae.After),
+		IP:             ae.IP,
+		UserAgent:      ae.UserAgent,
+		RequestID:      ae.RequestID,
+		CreatedAt:      chainTime(ae.CreatedAt),
+	}
+}
+
+// ChainShardKey keeps each organization's events together, so audited
+// transactions in different organizations append in parallel
+func (ae *AuditEvent) ChainShardKey() uuid.UUID {
+	if ae.OrganizationID == nil {
+		return uuid.Nil
+	}
+	return *ae.OrganizationID
+}
+
+func (fl *FailedLogin) ChainName() string {
+	return fl.TableName()
+}
+
+func (fl *FailedLogin) ChainFields() (*uuid.UUID, *time.Time, *ChainLink) {
+	return &fl.ID, &fl.CreatedAt, &fl.ChainLink
+}
+
+func (fl *FailedLogin) ChainPayload() interface{} {
+	return failedLoginPayload{
+		ID:        fl.ID,
+		IP:        fl.IP,
+		Username:  fl.Username,
+		UserID:    fl.UserID,
+		UserAgent: fl.UserAgent,
+		Reason:    fl.Reason,
+		CreatedAt: chainTime(fl.CreatedAt),
+	}
+}
+
+func (fl *FailedLogin) ChainShardKey() uuid.UUID {
+	return fl.ID
+}
+
+func (rl *RequestLog) ChainName() string {
+	return rl.TableName()
+}
+
+func (rl *RequestLog) ChainFields() (*uuid.UUID, *time.Time, *ChainLink) {
+	return &rl.ID, &rl.CreatedAt, &rl.ChainLink
+}
+
+func (rl *RequestLog) ChainPayload() interface{} {
+	return requestLogPayload{
+		ID:        rl.ID,
+		UserID:    rl.UserID,
+		IP:        rl.IP,
+		Method:    rl.Method,
+		Path:      rl.Path,
+		UserAgent: rl.UserAgent,
+		Status:    rl.Status,
+		Duration:  rl.Duration,
+		CreatedAt: chainTime(rl.CreatedAt),
+	}
+}
+
+func (rl *RequestLog) ChainShardKey() uuid.UUID {
+	return rl.ID
+}
+
+// chainJSON reads nil as the empty object it is stored as
+func chainJSON(m JSONMap) JSONMap {
+	if m == nil {
+		return JSONMap{}
+	}
+	return m
+}
+
+// chainTime formats a creation time the same way before it is stored and
+// after it is read back
+func chainTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FeatureFlag turns a feature on for some users. It is on for the targeted
+// roles, users and organizations and for Percentage of everyone else, and
+// otherwise takes its default for the deployment environment.
+type FeatureFlag struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name        string    `json:"name" gorm:"unique;not null"`
+	Description string    `json:"description"`
+	// DefaultOn applies in environments missing from Environments
+	DefaultOn bool `json:"default_on" gorm:"not null"`
+	// Environments maps environment names (see config.Environment) to their default
+	Environments    JSONMap        `json:"environments" gorm:"type:jsonb;not null;default:'{}'"`
+	Roles           JSONList       `json:"roles" gorm:"type:jsonb;not null;default:'[]'"`
+	UserIDs         JSONList       `json:"user_ids" gorm:"type:jsonb;not null;default:'[]'"`
+	OrganizationIDs JSONList       `json:"organization_ids" gorm:"type:jsonb;not null;default:'[]'"`
+	Percentage      int            `json:"percentage" gorm:"not null;default:0"` // 0 to 100
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+func (FeatureFlag) TableName() string {
+	return "feature_flags"
+}
+
+func (f *FeatureFlag) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Menu is an entry of the navigation shown by the web app. It is shown to
+// users allowed Permission, and only while Feature is enabled for them when
+// set. Entries with a parent are nested under it; siblings are ordered by
+// SortOrder.
+type Menu struct {
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ParentID   *uuid.UUID     `json:"parent_id" gorm:"type:uuid;index"`
+	Name       string         `json:"name" gorm:"unique;not null"`
+	Label      string         `json:"label" gorm:"not null"`
+	Icon       string         `json:"icon"`
+	Path       string         `json:"path"` // empty for groups without a page of their own
+	Permission string         `json:"permission" gorm:"not null"`
+	Feature    string         `json:"feature"`
+	SortOrder  int            `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+func (Menu) TableName() string {
+	return "menus"
+}
+
+func (m *Menu) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PermissionWildcard stands for any resource or any action in a permission.
+// A permission "users.*" grants every action on users, "*.read" grants read
+// on every resource and "*" grants everything.
+const PermissionWildcard = "*"
+
+var permissionSegment = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Scopes of a permission. ScopeAny applies to every row of the resource;
+// ScopeOwn only to rows the user owns, such as their own account.
+const (
+	ScopeAny = "any"
+	ScopeOwn = "own"
+)
+
+// Ownable is a row that own-scoped permissions can apply to
+type Ownable interface {
+	OwnerID() uuid.UUID
+}
+
+// Validate checks that resource and action are lowercase identifiers or the
+// wildcard, and that the name is "<resource>.<action>" ("*" alone for the
+// full wildcard) followed by ":own" for own-scoped permissions, so names and
+// the other fields always agree
+func (p Permission) Validate() error {
+	for _, segment := range []struct{ field, value string }{{"resource", p.Resource}, {"action", p.Action}} {
+		if segment.value != PermissionWildcard && !permissionSegment.MatchString(segment.value) {
+			return fmt.Errorf("%s %q must be %q or lowercase letters, digits, '-' and '_'", segment.field, segment.value, PermissionWildcard)
+		}
+	}
+
+	expected := p.Resource + "." + p.Action
+	if p.Resource == PermissionWildcard && p.Action == PermissionWildcard {
+		expected = PermissionWildcard
+	}
+	switch p.Scope {
+	case "", ScopeAny:
+		// "users.write:any" spells out the default scope
+		if p.Name == expected+":"+ScopeAny {
+			return nil
+		}
+	case ScopeOwn:
+		expected += ":" + ScopeOwn
+	default:
+		return fmt.Errorf("scope must be %q or %q", ScopeAny, ScopeOwn)
+	}
+	if p.Name != expected {
+		return fmt.Errorf("permission name must be %q", expected)
+	}
+	return nil
+}
+
+// SplitPermissionName splits a name such as "menu.dashboard" into its
+// resource and action
+func SplitPermissionName(name string) (resource, action string, ok bool) {
+	if name == PermissionWildcard {
+		return PermissionWildcard, PermissionWildcard, true
+	}
+	return strings.Cut(name, ".")
+}
+
+// IsWildcard reports whether the permission covers more than one resource/action pair
+func (p Permission) IsWildcard() bool {
+	return p.Resource == PermissionWildcard || p.Action == PermissionWildcard
+}
+
+// OwnOnly reports whether the permission only applies to rows the user owns
+func (p Permission) OwnOnly() bool {
+	return p.Scope == ScopeOwn
+}
+
+// Matches reports whether the permission grants the action on the resource
+func (p Permission) Matches(resource, action string) bool {
+	return (p.Resource == PermissionWildcard || p.Resource == resource) &&
+		(p.Action == PermissionWildcard || p.Action == action)
+}
+
+// Specificity ranks matching permissions from most to least specific:
+// an exact pair (3), then "resource.*" (2), "*.action" (1) and "*" (0).
+// A named resource outranks a named action.
+func (p Permission) Specificity() int {
+	specificity := 0
+	if p.Resource != PermissionWildcard {
+		specificity += 2
+	}
+	if p.Action != PermissionWildcard {
+		specificity++
+	}
+	return specificity
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Policy is an attribute-based access rule stored in the database.
+// Conditions holds the JSON encoded list of policy.Condition.
+type Policy struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name        string         `json:"name" gorm:"unique;not null"`
+	Description string         `json:"description"`
+	Resource    string         `json:"resource" gorm:"not null"`
+	Action      string         `json:"action" gorm:"not null"`
+	Effect      string         `json:"effect" gorm:"not null"`
+	Priority    int            `json:"priority" gorm:"not null;default:0"`
+	Conditions  string         `json:"-" gorm:"type:jsonb;not null;default:'[]'"`
+	Enabled     bool           `json:"enabled" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+func (Policy) TableName() string {
+	return "policies"
+}
+
+func (p *Policy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -7,16 +7,38 @@ import (
 	"gorm.io/gorm"
 )
 
+// DefaultRoleName is the role assigned to self-registered users
+const DefaultRoleName = "user"
+
+// OwnerRoleName is the role given to whoever creates an organization
+const OwnerRoleName = "owner"
+
+// DefaultOrganizationID is the organization the migrations created to adopt
+// every existing user. Self-registered users join it, and roles and
+// permissions shared by all organizations are managed from it.
+var DefaultOrganizationID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Effects of a role permission grant. A deny overrides any allow for the
+// same resource and action, including wildcard and inherited allows.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
 // Role represents a role in the system
 type Role struct {
-	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Name        string         `json:"name" gorm:"unique;not null"`
-	Description string         `json:"description"`
-	Permissions []Permission   `json:"permissions" gorm:"many2many:role_permissions;"`
-	Users       []User         `json:"users" gorm:"many2many:user_roles;"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID                uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name              string         `json:"name" gorm:"not null;uniqueIndex:idx_roles_organization_name,priority:2"` // Unique within the organization, and among shared roles
+	Description       string         `json:"description"`
+	OrganizationID    *uuid.UUID     `json:"organization_id" gorm:"type:uuid;index;uniqueIndex:idx_roles_organization_name,priority:1"` // Organization that defined the role, nil for roles shared by all
+	RequireMFA        bool           `json:"require_mfa" gorm:"default:false"`
+	Permissions       []Permission   `json:"permissions" gorm:"many2many:role_permissions;"`
+	Parents           []Role         `json:"parents,omitempty" gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID"` // Roles whose permissions this role inherits
+	DeniedPermissions []Permission   `json:"denied_permissions,omitempty" gorm:"-"`                                                         // Filled by rbac.SeparateDenied
+	Users             []User         `json:"users,omitempty" gorm:"-"`                                                                      // Holders in one organization, filled by the role controller
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
 // Permission represents a permission in the system
@@ -26,6 +48,7 @@ type Permission struct {
 	Description string         `json:"description"`
 	Resource    string         `json:"resource" gorm:"not null"`
 	Action      string         `json:"action" gorm:"not null"`
+	Scope       string         `json:"scope" gorm:"not null;default:any"` // ScopeAny or ScopeOwn
 	Roles       []Role         `json:"roles" gorm:"many2many:role_permissions;"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
@@ -34,46 +57,261 @@ type Permission struct {
 
 // User represents a user in the system
 type User struct {
-	ID            uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Username      string         `json:"username" gorm:"unique;not null"`
-	Email         string         `json:"email" gorm:"unique;not null"`
-	Password      string         `json:"-" gorm:"not null"` // Hidden from JSON
-	FirstName     string         `json:"first_name"`
-	LastName      string         `json:"last_name"`
-	IsActive      bool           `json:"is_active" gorm:"default:true"`
-	Roles         []Role         `json:"roles" gorm:"many2many:user_roles;"`
-	RefreshTokens []RefreshToken `json:"-" gorm:"foreignKey:UserID"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `json:"deleted_at" gorm:"index"`
-}
-
-// UserRole represents the many-to-many relationship between users and roles
+	ID                   uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Username             string         `json:"username" gorm:"unique;not null"`
+	Email                string         `json:"email" gorm:"unique;not null"`
+	EmailVerifiedAt      *time.Time     `json:"email_verified_at"`
+	Password             string         `json:"-" gorm:"not null"` // Hidden from JSON
+	FirstName            string         `json:"first_name"`
+	LastName             string         `json:"last_name"`
+	IsActive             bool           `json:"is_active" gorm:"default:true"`
+	MFAEnabled           bool           `json:"mfa_enabled" gorm:"default:false"`
+	MFASecret            string         `json:"-"`                                                  // Encrypted TOTP secret
+	MFAPending           string         `json:"-"`                                                  // Encrypted TOTP secret awaiting confirmation
+	MFALastStep          int64          `json:"-" gorm:"default:0"`                                 // Last accepted TOTP time step, prevents code replay
+	Attributes           JSONMap        `json:"attributes" gorm:"type:jsonb;not null;default:'{}'"` // Custom attributes for access policies, such as department
+	ActiveOrganizationID *uuid.UUID     `json:"active_organization_id" gorm:"type:uuid"`            // Organization of the latest session, used again at the next login
+	Roles                []Role         `json:"roles" gorm:"-"`                                     // Roles in one organization, filled by tenant.LoadRoles
+	RefreshTokens        []RefreshToken `json:"-" gorm:"foreignKey:UserID"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+// Organization is a tenant with its own members and role assignments
+type Organization struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name      string         `json:"name" gorm:"not null"`
+	Slug      string         `json:"slug" gorm:"unique;not null"`
+	CreatedBy *uuid.UUID     `json:"created_by" gorm:"type:uuid"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+// OrganizationMember makes a user a member of an organization
+type OrganizationMember struct {
+	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;primaryKey"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey"`
+	InvitedBy      *uuid.UUID `json:"invited_by" gorm:"type:uuid"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// OrganizationInvitation is an emailed invitation to join an organization
+// with a role. Like the other emailed tokens it is stored as a selector and a
+// keyed verifier hash.
+type OrganizationInvitation struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;not null;index"`
+	Email          string     `json:"email" gorm:"not null"`
+	RoleID         uuid.UUID  `json:"role_id" gorm:"type:uuid;not null"`
+	Selector       string     `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	VerifierHash   string     `json:"-" gorm:"not null;size:64"`
+	InvitedBy      uuid.UUID  `json:"invited_by" gorm:"type:uuid;not null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// UserRole assigns a role to a user within one organization. The role only
+// applies between StartsAt and ExpiresAt when they are set.
 type UserRole struct {
-	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
-	RoleID     uuid.UUID `json:"role_id" gorm:"type:uuid;primaryKey"`
-	AssignedBy uuid.UUID `json:"assigned_by" gorm:"type:uuid"`
-	CreatedAt  time.Time `json:"created_at"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey"`
+	RoleID         uuid.UUID  `json:"role_id" gorm:"type:uuid;primaryKey"`
+	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;primaryKey"`
+	AssignedBy     uuid.UUID  `json:"assigned_by" gorm:"type:uuid"`
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Reason         string     `json:"reason" gorm:"not null;default:''"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Role           *Role      `json:"role,omitempty" gorm:"foreignKey:RoleID"`
+}
+
+// ExpiredRoleAssignment records a time-bound role assignment removed by the
+// sweeper once it expired
+type ExpiredRoleAssignment struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	RoleID         uuid.UUID  `json:"role_id" gorm:"type:uuid;not null"`
+	OrganizationID uuid.UUID  `json:"organization_id" gorm:"type:uuid;not null"`
+	AssignedBy     *uuid.UUID `json:"assigned_by" gorm:"type:uuid"`
+	AssignedAt     *time.Time `json:"assigned_at"`
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	Reason         string     `json:"reason"`
+	RemovedAt      time.Time  `json:"removed_at" gorm:"not null"`
+}
+
+// Elevation request statuses
+const (
+	ElevationPending   = "pending"
+	ElevationApproved  = "approved"
+	ElevationRejected  = "rejected"
+	ElevationCancelled = "cancelled"
+)
+
+// ElevationRequest asks for a role to be held for a limited time. Once
+// approved the role is granted as a UserRole expiring after Duration.
+type ElevationRequest struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	OrganizationID  uuid.UUID  `json:"organization_id" gorm:"type:uuid;not null;index"`
+	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	User            *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	RoleID          uuid.UUID  `json:"role_id" gorm:"type:uuid;not null"`
+	Role            *Role      `json:"role,omitempty" gorm:"foreignKey:RoleID"`
+	DurationSeconds int64      `json:"duration_seconds" gorm:"not null"`
+	Justification   string     `json:"justification" gorm:"not null"`
+	Status          string     `json:"status" gorm:"not null;default:pending;index"`
+	DecidedBy       *uuid.UUID `json:"decided_by" gorm:"type:uuid"`
+	DecidedAt       *time.Time `json:"decided_at"`
+	DecisionNote    string     `json:"decision_note"`
+	ExpiresAt       *time.Time `json:"expires_at"` // end of the granted role, set on approval
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ElevationEvent records a step in the life of an elevation request
+type ElevationEvent struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	RequestID uuid.UUID `json:"request_id" gorm:"type:uuid;not null;index"`
+	ActorID   uuid.UUID `json:"actor_id" gorm:"type:uuid;not null"`
+	Action    string    `json:"action" gorm:"not null"` // requested, approved, rejected or cancelled
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // RolePermission represents the many-to-many relationship between roles and permissions
 type RolePermission struct {
 	RoleID       uuid.UUID `json:"role_id" gorm:"type:uuid;primaryKey"`
 	PermissionID uuid.UUID `json:"permission_id" gorm:"type:uuid;primaryKey"`
+	Effect       string    `json:"effect" gorm:"default:allow"` // EffectAllow or EffectDeny
 	CreatedAt    time.Time `json:"created_at"`
 }
 
-// RefreshToken represents a refresh token for JWT authentication
+// RoleParent makes RoleID inherit every permission of ParentID
+type RoleParent struct {
+	RoleID    uuid.UUID `json:"role_id" gorm:"type:uuid;primaryKey"`
+	ParentID  uuid.UUID `json:"parent_id" gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RefreshToken represents a refresh token for JWT authentication.
+// The token handed to the client is "<selector>.<verifier>"; only the
+// selector and a keyed hash of the verifier are stored.
+// Every refresh rotates the token: the presented token is deactivated and
+// linked to its successor, and all tokens descending from the same login
+// share a FamilyID so the whole chain can be revoked at once.
 type RefreshToken struct {
-	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Token     string         `json:"-" gorm:"unique;not null;size:500"` // Hidden from JSON
-	UserID    uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
-	User      User           `json:"user" gorm:"foreignKey:UserID"`
-	ExpiresAt time.Time      `json:"expires_at" gorm:"not null"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Selector       string         `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	VerifierHash   string         `json:"-" gorm:"not null;size:64"` // HMAC of the secret part, never the token itself
+	UserID         uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
+	User           User           `json:"user" gorm:"foreignKey:UserID"`
+	OrganizationID *uuid.UUID     `json:"organization_id,omitempty" gorm:"type:uuid"` // Organization the issued access tokens act in
+	FamilyID       uuid.UUID      `json:"family_id" gorm:"type:uuid;index"`
+	ParentID       *uuid.UUID     `json:"parent_id,omitempty" gorm:"type:uuid"`
+	ReplacedByID   *uuid.UUID     `json:"replaced_by_id,omitempty" gorm:"type:uuid"`
+	ExpiresAt      time.Time      `json:"expires_at" gorm:"not null"`
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	RevokedAt      *time.Time     `json:"revoked_at,omitempty"`
+	RevokedReason  string         `json:"revoked_reason,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+// RefreshTokenReuse records an attempt to use a refresh token that had
+// already been rotated, which indicates the token was stolen
+type RefreshTokenReuse struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	FamilyID  uuid.UUID `json:"family_id" gorm:"type:uuid;not null"`
+	TokenID   uuid.UUID `json:"token_id" gorm:"type:uuid;not null"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MFARecoveryCode is a single-use code that can replace a TOTP code
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;size:64"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken is a single-use token emailed to reset a forgotten password.
+// Like refresh tokens it is stored as a selector and a keyed verifier hash.
+type PasswordResetToken struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Selector     string     `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	VerifierHash string     `json:"-" gorm:"not null;size:64"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	RequestedIP  string     `json:"requested_ip"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// EmailVerificationToken is a single-use token emailed to confirm that the
+// user controls Email. It is only valid while Email is still the user's address.
+type EmailVerificationToken struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Email        string     `json:"email" gorm:"not null"`
+	Selector     string     `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	VerifierHash string     `json:"-" gorm:"not null;size:64"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Lockout scopes
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+// LoginLockout counts recent failed logins for an account or a client IP and
+// records until when further attempts are refused
+type LoginLockout struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Scope         string     `json:"scope" gorm:"not null;size:16;uniqueIndex:idx_login_lockouts_scope_key"`
+	Key           string     `json:"key" gorm:"not null;size:255;uniqueIndex:idx_login_lockouts_scope_key"`
+	UserID        *uuid.UUID `json:"user_id,omitempty" gorm:"type:uuid;index"`
+	Failures      int        `json:"failures" gorm:"not null"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// FailedLogin records a single failed login attempt
+type FailedLogin struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	IP        string     `json:"ip" gorm:"not null;index"`
+	Username  string     `json:"username"`
+	UserID    *uuid.UUID `json:"user_id,omitempty" gorm:"type:uuid;index"`
+	UserAgent string     `json:"user_agent"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+	ChainLink `gorm:"embedded"`
+}
+
+// RequestLog records one HTTP request for security monitoring
+type RequestLog struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    *uuid.UUID `json:"user_id,omitempty" gorm:"type:uuid"` // nil for anonymous requests
+	IP        string     `json:"ip" gorm:"not null"`
+	Method    string     `json:"method" gorm:"not null"`
+	Path      string     `json:"path" gorm:"not null"`
+	UserAgent string     `json:"user_agent"`
+	Status    int        `json:"status"`
+	Duration  int64      `json:"duration"` // in milliseconds
+	CreatedAt time.Time  `json:"created_at"`
+	ChainLink `gorm:"embedded"`
 }
 
 // TableName methods for custom table names
@@ -93,14 +331,76 @@ func (UserRole) TableName() string {
 	return "user_roles"
 }
 
+func (ExpiredRoleAssignment) TableName() string {
+	return "expired_role_assignments"
+}
+
+func (ElevationRequest) TableName() string {
+	return "elevation_requests"
+}
+
+func (ElevationEvent) TableName() string {
+	return "elevation_events"
+}
+
 func (RolePermission) TableName() string {
 	return "role_permissions"
 }
 
+func (RoleParent) TableName() string {
+	return "role_parents"
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+func (OrganizationInvitation) TableName() string {
+	return "organization_invitations"
+}
+
 func (RefreshToken) TableName() string {
 	return "refresh_tokens"
 }
 
+func (RefreshTokenReuse) TableName() string {
+	return "refresh_token_reuse_events"
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+func (EmailVerificationToken) TableName() string {
+	return "email_verification_tokens"
+}
+
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
+
+func (FailedLogin) TableName() string {
+	return "failed_logins"
+}
+
+func (RequestLog) TableName() string {
+	return "request_logs"
+}
+
+// OwnerID identifies who owns the row for own-scoped permissions; a user
+// account is owned by that user
+func (u User) OwnerID() uuid.UUID {
+	return u.ID
+}
+
 // GORM hooks for UUID generation
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
@@ -123,9 +423,89 @@ func (p *Permission) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+func (oi *OrganizationInvitation) BeforeCreate(tx *gorm.DB) error {
+	if oi.ID == uuid.Nil {
+		oi.ID = uuid.New()
+	}
+	return nil
+}
+
+func (er *ElevationRequest) BeforeCreate(tx *gorm.DB) error {
+	if er.ID == uuid.Nil {
+		er.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ee *ElevationEvent) BeforeCreate(tx *gorm.DB) error {
+	if ee.ID == uuid.Nil {
+		ee.ID = uuid.New()
+	}
+	return nil
+}
+
 func (rt *RefreshToken) BeforeCreate(tx *gorm.DB) error {
 	if rt.ID == uuid.Nil {
 		rt.ID = uuid.New()
 	}
+	if rt.FamilyID == uuid.Nil {
+		rt.FamilyID = rt.ID
+	}
+	return nil
+}
+
+func (r *RefreshTokenReuse) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (rc *MFARecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if rc.ID == uuid.Nil {
+		rc.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pr *PasswordResetToken) BeforeCreate(tx *gorm.DB) error {
+	if pr.ID == uuid.Nil {
+		pr.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ev *EmailVerificationToken) BeforeCreate(tx *gorm.DB) error {
+	if ev.ID == uuid.Nil {
+		ev.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ll *LoginLockout) BeforeCreate(tx *gorm.DB) error {
+	if ll.ID == uuid.Nil {
+		ll.ID = uuid.New()
+	}
+	return nil
+}
+
+func (fl *FailedLogin) BeforeCreate(tx *gorm.DB) error {
+	if fl.ID == uuid.Nil {
+		fl.ID = uuid.New()
+	}
+	return nil
+}
+
+func (rl *RequestLog) BeforeCreate(tx *gorm.DB) error {
+	if rl.ID == uuid.Nil {
+		rl.ID = uuid.New()
+	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"time"
+
+	"backend/models"
+)
+
+// UserAttributes describes a user as a policy subject or resource. Custom
+// attributes come first so the built-in fields cannot be overridden.
+func UserAttributes(user *models.User, roles []string) Attributes {
+	attributes := Attributes{}
+	for key, value := range user.Attributes {
+		attributes[key] = value
+	}
+	attributes["id"] = user.ID.String()
+	attributes["username"] = user.Username
+	attributes["email"] = user.Email
+	attributes["is_active"] = user.IsActive
+	attributes["email_verified"] = user.EmailVerifiedAt != nil
+	attributes["mfa_enabled"] = user.MFAEnabled
+	if roles == nil {
+		roles = make([]string, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			roles = append(roles, role.Name)
+		}
+	}
+	attributes["roles"] = roles
+	return attributes
+}
+
+// RequestAttributes describes the request being authorized
+func RequestAttributes(ip, method, path string, now time.Time) Attributes {
+	return Attributes{
+		"ip":     ip,
+		"method": method,
+		"path":   path,
+		"time":   now,
+	}
+}
@@ -0,0 +1,425 @@
+// Package policy evaluates attribute-based access rules alongside RBAC.
+// A policy allows or denies an action on a resource when all of its
+// conditions over subject, resource and request attributes hold. The
+// evaluator is pure: it only sees the attributes it is given, so it can be
+// exercised without a database or an HTTP request.
+package policy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Effects and decisions
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+
+	DecisionAllow         = "allow"
+	DecisionDeny          = "deny"
+	DecisionNotApplicable = "not_applicable"
+)
+
+// Wildcard matches any resource or action in a policy
+const Wildcard = "*"
+
+// Policy is a rule that decides an action on a resource when all of its
+// conditions hold
+type Policy struct {
+	Name        string      `json:"name" yaml:"name"`
+	Description string      `json:"description" yaml:"description"`
+	Resource    string      `json:"resource" yaml:"resource"`
+	Action      string      `json:"action" yaml:"action"`
+	Effect      string      `json:"effect" yaml:"effect"`
+	Priority    int         `json:"priority" yaml:"priority"` // higher is evaluated first
+	Conditions  []Condition `json:"conditions" yaml:"conditions"`
+	Source      string      `json:"source" yaml:"-"` // "database" or the file it was loaded from
+}
+
+// Condition compares an attribute such as "subject.department" with a
+// literal Value or with another attribute named by ValueFrom
+type Condition struct {
+	Attribute string      `json:"attribute" yaml:"attribute"`
+	Operator  string      `json:"operator" yaml:"operator"`
+	Value     interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty" yaml:"value_from,omitempty"`
+}
+
+// Attributes of the subject, resource or request. Values are strings,
+// numbers, booleans, string lists or, for request.time, a time.Time.
+type Attributes map[string]interface{}
+
+// Input holds everything a policy can look at
+type Input struct {
+	Subject  Attributes `json:"subject"`
+	Resource Attributes `json:"resource"`
+	Request  Attributes `json:"request"`
+}
+
+// Result is the outcome of an evaluation and how it was reached
+type Result struct {
+	Decision string `json:"decision"`
+	Policy   string `json:"policy,omitempty"` // policy that decided, empty when none applied
+	Trace    []Step `json:"trace"`
+}
+
+// Step records one policy considered during an evaluation
+type Step struct {
+	Policy  string `json:"policy"`
+	Matched bool   `json:"matched"`
+	Detail  string `json:"detail,omitempty"` // first condition that failed
+}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "in": true, "not_in": true, "contains": true, "exists": true,
+	"gt": true, "gte": true, "lt": true, "lte": true,
+	"cidr": true, "not_cidr": true, "hours_between": true, "weekday_in": true,
+}
+
+var namespaces = map[string]bool{"subject": true, "resource": true, "request": true}
+
+// Validate checks a policy before it is stored or loaded
+func Validate(p Policy) error {
+	if p.Name == "" || p.Resource == "" || p.Action == "" {
+		return fmt.Errorf("policy needs a name, resource and action")
+	}
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("policy %q: effect must be %q or %q", p.Name, EffectAllow, EffectDeny)
+	}
+	for i, cond := range p.Conditions {
+		if err := validateCondition(cond); err != nil {
+			return fmt.Errorf("policy %q condition %d: %w", p.Name, i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateCondition(cond Condition) error {
+	if !operators[cond.Operator] {
+		return fmt.Errorf("unknown operator %q", cond.Operator)
+	}
+	for _, attribute := range []string{cond.Attribute, cond.ValueFrom} {
+		if attribute == "" && cond.Attribute != "" {
+			continue // no value_from
+		}
+		namespace, key, ok := strings.Cut(attribute, ".")
+		if !ok || key == "" || !namespaces[namespace] {
+			return fmt.Errorf("attribute %q must start with subject., resource. or request.", attribute)
+		}
+	}
+	if cond.Operator == "exists" {
+		return nil
+	}
+	if cond.Value == nil && cond.ValueFrom == "" {
+		return fmt.Errorf("%s needs a value or value_from", cond.Operator)
+	}
+
+	switch cond.Operator {
+	case "cidr", "not_cidr":
+		for _, cidr := range toStrings(cond.Value) {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid CIDR %q", cidr)
+			}
+		}
+	case "hours_between":
+		if _, _, err := parseHours(toString(cond.Value)); err != nil {
+			return err
+		}
+	case "weekday_in":
+		for _, day := range toStrings(cond.Value) {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("invalid weekday %q", day)
+			}
+		}
+	}
+	return nil
+}
+
+// Engine evaluates a fixed set of policies
+type Engine struct {
+	policies []Policy
+	location *time.Location
+}
+
+// NewEngine validates and orders the policies. Times are compared in the
+// location, UTC when nil.
+func NewEngine(policies []Policy, location *time.Location) (*Engine, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	names := make(map[string]bool, len(policies))
+	sorted := make([]Policy, 0, len(policies))
+	for _, p := range policies {
+		if err := Validate(p); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("policy %q is defined twice", p.Name)
+		}
+		names[p.Name] = true
+		sorted = append(sorted, p)
+	}
+
+	// Higher priority first, deny before allow at the same priority, then by name
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Effect != b.Effect {
+			return a.Effect == EffectDeny
+		}
+		return a.Name < b.Name
+	})
+	return &Engine{policies: sorted, location: location}, nil
+}
+
+// Policies returns the policies in evaluation order
+func (e *Engine) Policies() []Policy {
+	return append([]Policy(nil), e.policies...)
+}
+
+// Evaluate returns the effect of the first policy, in evaluation order,
+// that targets the resource and action and whose conditions all hold.
+// When none does the decision is DecisionNotApplicable.
+func (e *Engine) Evaluate(resource, action string, in Input) Result {
+	result := Result{Decision: DecisionNotApplicable, Trace: []Step{}}
+	for _, p := range e.policies {
+		if !targets(p.Resource, resource) || !targets(p.Action, action) {
+			continue
+		}
+
+		step := Step{Policy: p.Name, Matched: true}
+		for _, cond := range p.Conditions {
+			if ok, detail := e.check(cond, in); !ok {
+				step.Matched = false
+				step.Detail = detail
+				break
+			}
+		}
+		result.Trace = append(result.Trace, step)
+
+		if step.Matched {
+			result.Decision = p.Effect
+			result.Policy = p.Name
+			return result
+		}
+	}
+	return result
+}
+
+func targets(pattern, value string) bool {
+	return pattern == Wildcard || pattern == value
+}
+
+func lookup(in Input, attribute string) (interface{}, bool) {
+	namespace, key, _ := strings.Cut(attribute, ".")
+	var attributes Attributes
+	switch namespace {
+	case "subject":
+		attributes = in.Subject
+	case "resource":
+		attributes = in.Resource
+	case "request":
+		attributes = in.Request
+	}
+	value, ok := attributes[key]
+	return value, ok && value != nil
+}
+
+// check evaluates one condition. A missing attribute fails every operator
+// except exists.
+func (e *Engine) check(cond Condition, in Input) (bool, string) {
+	actual, found := lookup(in, cond.Attribute)
+	if cond.Operator == "exists" {
+		if !found {
+			return false, cond.Attribute + " is not set"
+		}
+		return true, ""
+	}
+	if !found {
+		return false, cond.Attribute + " is not set"
+	}
+
+	expected := cond.Value
+	if cond.ValueFrom != "" {
+		var ok bool
+		if expected, ok = lookup(in, cond.ValueFrom); !ok {
+			return false, cond.ValueFrom + " is not set"
+		}
+	}
+
+	var ok bool
+	switch cond.Operator {
+	case "eq":
+		ok = toString(actual) == toString(expected)
+	case "ne":
+		ok = toString(actual) != toString(expected)
+	case "in":
+		ok = containsString(toStrings(expected), toString(actual))
+	case "not_in":
+		ok = !containsString(toStrings(expected), toString(actual))
+	case "contains":
+		ok = containsString(toStrings(actual), toString(expected))
+	case "gt", "gte", "lt", "lte":
+		ok = compareNumbers(cond.Operator, actual, expected)
+	case "cidr":
+		ok = inNetworks(toString(actual), toStrings(expected))
+	case "not_cidr":
+		ok = net.ParseIP(toString(actual)) != nil && !inNetworks(toString(actual), toStrings(expected))
+	case "hours_between":
+		ok = e.withinHours(actual, toString(expected))
+	case "weekday_in":
+		ok = e.onWeekday(actual, toStrings(expected))
+	}
+	if !ok {
+		return false, fmt.Sprintf("%s %s %v does not hold", cond.Attribute, cond.Operator, expected)
+	}
+	return true, ""
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func toStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, toString(item))
+		}
+		return out
+	}
+	return []string{toString(value)}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareNumbers(operator string, actual, expected interface{}) bool {
+	a, ok := toFloat(actual)
+	b, ok2 := toFloat(expected)
+	if !ok || !ok2 {
+		return false
+	}
+	switch operator {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	}
+	return a <= b
+}
+
+func inNetworks(ip string, cidrs []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHours parses "09:00-17:00" into minutes since midnight. The end is
+// exclusive, and a range may wrap past midnight ("22:00-06:00").
+func parseHours(value string) (int, int, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("hours %q must look like 09:00-17:00", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (e *Engine) withinHours(actual interface{}, hours string) bool {
+	t, ok := actual.(time.Time)
+	if !ok {
+		return false
+	}
+	start, end, err := parseHours(hours)
+	if err != nil {
+		return false
+	}
+	t = t.In(e.location)
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (e *Engine) onWeekday(actual interface{}, days []string) bool {
+	t, ok := actual.(time.Time)
+	if !ok {
+		return false
+	}
+	weekday := t.In(e.location).Weekday()
+	for _, day := range days {
+		if d, ok := weekdays[strings.ToLower(day)]; ok && d == weekday {
+			return true
+		}
+	}
+	return false
+}
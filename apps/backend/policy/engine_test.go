@@ -0,0 +1,253 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func when(attribute, operator string, value interface{}) Condition {
+	return Condition{Attribute: attribute, Operator: operator, Value: value}
+}
+
+func newEngine(t *testing.T, location *time.Location, policies ...Policy) *Engine {
+	t.Helper()
+	engine, err := NewEngine(policies, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestEvaluateOrder(t *testing.T) {
+	isAdmin := when("subject.roles", "contains", "admin")
+	tests := []struct {
+		name     string
+		policies []Policy
+		resource string
+		decision string
+		policy   string
+	}{
+		{"no policies", nil, "users", DecisionNotApplicable, ""},
+		{"other resource", []Policy{{Name: "a", Resource: "billing", Action: "read", Effect: EffectAllow}}, "users", DecisionNotApplicable, ""},
+		{"resource wildcard", []Policy{{Name: "a", Resource: Wildcard, Action: "read", Effect: EffectAllow}}, "users", DecisionAllow, "a"},
+		{"action wildcard", []Policy{{Name: "a", Resource: "users", Action: Wildcard, Effect: EffectDeny}}, "users", DecisionDeny, "a"},
+		{"higher priority first", []Policy{
+			{Name: "a", Resource: "users", Action: "read", Effect: EffectDeny},
+			{Name: "b", Resource: "users", Action: "read", Effect: EffectAllow, Priority: 10},
+		}, "users", DecisionAllow, "b"},
+		{"deny before allow at equal priority", []Policy{
+			{Name: "a", Resource: "users", Action: "read", Effect: EffectAllow},
+			{Name: "b", Resource: "users", Action: "read", Effect: EffectDeny},
+		}, "users", DecisionDeny, "b"},
+		{"name breaks ties", []Policy{
+			{Name: "b", Resource: "users", Action: "read", Effect: EffectAllow},
+			{Name: "a", Resource: "users", Action: "read", Effect: EffectAllow},
+		}, "users", DecisionAllow, "a"},
+		{"unmatched policy is skipped", []Policy{
+			{Name: "a", Resource: "users", Action: "read", Effect: EffectDeny, Priority: 10, Conditions: []Condition{isAdmin}},
+			{Name: "b", Resource: "users", Action: "read", Effect: EffectAllow},
+		}, "users", DecisionAllow, "b"},
+		{"nothing matches", []Policy{
+			{Name: "a", Resource: "users", Action: "read", Effect: EffectAllow, Conditions: []Condition{isAdmin}},
+		}, "users", DecisionNotApplicable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := Input{Subject: Attributes{"roles": []string{"user"}}}
+			result := newEngine(t, nil, tt.policies...).Evaluate(tt.resource, "read", input)
+			if result.Decision != tt.decision || result.Policy != tt.policy {
+				t.Fatalf("got %s by %q, want %s by %q (trace %+v)", result.Decision, result.Policy, tt.decision, tt.policy, result.Trace)
+			}
+		})
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	engine := newEngine(t, nil,
+		Policy{Name: "admins", Resource: "users", Action: "read", Effect: EffectAllow, Priority: 10,
+			Conditions: []Condition{when("subject.roles", "contains", "admin")}},
+		Policy{Name: "everyone", Resource: "users", Action: "read", Effect: EffectAllow},
+		Policy{Name: "billing", Resource: "billing", Action: "read", Effect: EffectAllow},
+	)
+	result := engine.Evaluate("users", "read", Input{Subject: Attributes{"roles": []string{"user"}}})
+	if len(result.Trace) != 2 {
+		t.Fatalf("trace = %+v, want the two users policies", result.Trace)
+	}
+	if step := result.Trace[0]; step.Policy != "admins" || step.Matched || !strings.Contains(step.Detail, "subject.roles contains admin") {
+		t.Fatalf("first step = %+v, want admins unmatched on its role condition", step)
+	}
+	if step := result.Trace[1]; step.Policy != "everyone" || !step.Matched {
+		t.Fatalf("second step = %+v, want everyone matched", step)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	input := Input{
+		Subject: Attributes{
+			"department": "sales",
+			"level":      3,
+			"roles":      []string{"manager", "user"},
+			"team":       "sales",
+			"active":     true,
+		},
+		Resource: Attributes{"department": "sales", "owner": nil, "score": "7.5"},
+		Request:  Attributes{"ip": "10.1.2.3"},
+	}
+	tests := []struct {
+		name    string
+		cond    Condition
+		matched bool
+	}{
+		{"eq", when("subject.department", "eq", "sales"), true},
+		{"eq other", when("subject.department", "eq", "support"), false},
+		{"eq number as string", when("subject.level", "eq", "3"), true},
+		{"eq boolean", when("subject.active", "eq", true), true},
+		{"ne", when("subject.department", "ne", "support"), true},
+		{"in", when("subject.department", "in", []interface{}{"sales", "support"}), true},
+		{"in missing", when("subject.department", "in", []interface{}{"support"}), false},
+		{"not_in", when("subject.department", "not_in", []interface{}{"support"}), true},
+		{"contains", when("subject.roles", "contains", "manager"), true},
+		{"contains missing", when("subject.roles", "contains", "admin"), false},
+		{"contains on a string", when("subject.department", "contains", "sales"), true},
+		{"exists", when("subject.department", "exists", nil), true},
+		{"exists missing", when("subject.region", "exists", nil), false},
+		{"exists nil", when("resource.owner", "exists", nil), false},
+		{"gt", when("subject.level", "gt", 2), true},
+		{"gt equal", when("subject.level", "gt", 3), false},
+		{"gte", when("subject.level", "gte", 3), true},
+		{"lt", when("resource.score", "lt", 8), true},
+		{"lte", when("resource.score", "lte", "7.5"), true},
+		{"compare non-number", when("subject.department", "gt", 1), false},
+		{"cidr", when("request.ip", "cidr", []interface{}{"10.0.0.0/8"}), true},
+		{"cidr outside", when("request.ip", "cidr", "192.168.0.0/16"), false},
+		{"not_cidr", when("request.ip", "not_cidr", []interface{}{"192.168.0.0/16"}), true},
+		{"not_cidr inside", when("request.ip", "not_cidr", []interface{}{"10.0.0.0/8"}), false},
+		{"not_cidr invalid ip", when("subject.department", "not_cidr", "10.0.0.0/8"), false},
+		{"missing attribute", when("subject.region", "ne", "emea"), false},
+		{"missing namespace", when("request.method", "eq", "GET"), false},
+		{"value_from", Condition{Attribute: "resource.department", Operator: "eq", ValueFrom: "subject.department"}, true},
+		{"value_from other", Condition{Attribute: "resource.department", Operator: "ne", ValueFrom: "subject.team"}, false},
+		{"value_from missing", Condition{Attribute: "resource.department", Operator: "ne", ValueFrom: "subject.region"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newEngine(t, nil, Policy{Name: "p", Resource: "users", Action: "read", Effect: EffectAllow, Conditions: []Condition{tt.cond}})
+			result := engine.Evaluate("users", "read", input)
+			if matched := result.Decision == DecisionAllow; matched != tt.matched {
+				t.Fatalf("matched = %v, want %v (%+v)", matched, tt.matched, result.Trace)
+			}
+		})
+	}
+}
+
+func TestTimeConditions(t *testing.T) {
+	// 2024-01-05 is a Friday. At 23:30 UTC it is already Saturday 01:30 at UTC+2.
+	friday := time.Date(2024, 1, 5, 23, 30, 0, 0, time.UTC)
+	plusTwo := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		name     string
+		location *time.Location
+		cond     Condition
+		now      interface{}
+		matched  bool
+	}{
+		{"hours", nil, when("request.time", "hours_between", "09:00-17:00"), friday.Add(-10 * time.Hour), true},
+		{"hours end is exclusive", nil, when("request.time", "hours_between", "09:00-17:00"), friday.Add(-6*time.Hour - 30*time.Minute), false},
+		{"hours outside", nil, when("request.time", "hours_between", "09:00-17:00"), friday, false},
+		{"hours wrap past midnight", nil, when("request.time", "hours_between", "22:00-06:00"), friday, true},
+		{"hours wrap after midnight", nil, when("request.time", "hours_between", "22:00-06:00"), friday.Add(2 * time.Hour), true},
+		{"hours wrap outside", nil, when("request.time", "hours_between", "22:00-06:00"), friday.Add(-12 * time.Hour), false},
+		{"hours in location", plusTwo, when("request.time", "hours_between", "00:00-02:00"), friday, true},
+		{"weekday", nil, when("request.time", "weekday_in", []interface{}{"mon", "fri"}), friday, true},
+		{"weekday case", nil, when("request.time", "weekday_in", []interface{}{"FRI"}), friday, true},
+		{"weekday in location", plusTwo, when("request.time", "weekday_in", []interface{}{"fri"}), friday, false},
+		{"weekend in location", plusTwo, when("request.time", "weekday_in", []interface{}{"sat", "sun"}), friday, true},
+		{"not a time", nil, when("request.time", "hours_between", "00:00-23:59"), "2024-01-05T10:00:00Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newEngine(t, tt.location, Policy{Name: "p", Resource: "users", Action: "read", Effect: EffectAllow, Conditions: []Condition{tt.cond}})
+			result := engine.Evaluate("users", "read", Input{Request: Attributes{"time": tt.now}})
+			if matched := result.Decision == DecisionAllow; matched != tt.matched {
+				t.Fatalf("matched = %v, want %v (%+v)", matched, tt.matched, result.Trace)
+			}
+		})
+	}
+}
+
+func TestNewEngineRejectsInvalidPolicies(t *testing.T) {
+	valid := Policy{Name: "p", Resource: "users", Action: "read", Effect: EffectAllow}
+	withCondition := func(cond Condition) Policy {
+		p := valid
+		p.Conditions = []Condition{cond}
+		return p
+	}
+	tests := []struct {
+		name     string
+		policies []Policy
+		want     string
+	}{
+		{"no name", []Policy{{Resource: "users", Action: "read", Effect: EffectAllow}}, "needs a name"},
+		{"no action", []Policy{{Name: "p", Resource: "users", Effect: EffectAllow}}, "needs a name, resource and action"},
+		{"effect", []Policy{{Name: "p", Resource: "users", Action: "read", Effect: "permit"}}, "effect must be"},
+		{"duplicate", []Policy{valid, valid}, "defined twice"},
+		{"operator", []Policy{withCondition(when("subject.level", "between", 1))}, `unknown operator "between"`},
+		{"namespace", []Policy{withCondition(when("user.level", "eq", 1))}, "must start with subject."},
+		{"no key", []Policy{withCondition(when("subject.", "eq", 1))}, "must start with subject."},
+		{"value_from namespace", []Policy{withCondition(Condition{Attribute: "subject.level", Operator: "eq", ValueFrom: "level"})}, `attribute "level"`},
+		{"no value", []Policy{withCondition(when("subject.level", "eq", nil))}, "needs a value or value_from"},
+		{"cidr", []Policy{withCondition(when("request.ip", "cidr", "10.0.0.0/33"))}, `invalid CIDR "10.0.0.0/33"`},
+		{"hours", []Policy{withCondition(when("request.time", "hours_between", "0900"))}, "must look like 09:00-17:00"},
+		{"clock", []Policy{withCondition(when("request.time", "hours_between", "09:00-25:00"))}, `invalid time "25:00"`},
+		{"weekday", []Policy{withCondition(when("request.time", "weekday_in", []interface{}{"monday"}))}, `invalid weekday "monday"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEngine(tt.policies, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("NewEngine() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExamplePolicies(t *testing.T) {
+	policies, err := LoadFiles("../policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) == 0 {
+		t.Fatal("no example policies loaded")
+	}
+
+	// The examples narrow the seeded users-read policy
+	policies = append(policies, Policy{Name: "users-read", Resource: "users", Action: "read", Effect: EffectAllow})
+	engine := newEngine(t, nil, policies...)
+	tuesday := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		roles    []string
+		resource string
+		now      time.Time
+		decision string
+	}{
+		{"admin", []string{"admin", "manager"}, "support", tuesday.Add(12 * time.Hour), DecisionAllow},
+		{"manager in department", []string{"manager"}, "sales", tuesday, DecisionAllow},
+		{"manager in other department", []string{"manager"}, "support", tuesday, DecisionDeny},
+		{"manager out of hours", []string{"manager"}, "sales", tuesday.Add(12 * time.Hour), DecisionDeny},
+		{"other user", []string{"user"}, "support", tuesday.Add(12 * time.Hour), DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := Input{
+				Subject:  Attributes{"roles": tt.roles, "department": "sales"},
+				Resource: Attributes{"department": tt.resource},
+				Request:  Attributes{"time": tt.now},
+			}
+			if result := engine.Evaluate("users", "read", input); result.Decision != tt.decision {
+				t.Fatalf("got %s by %q, want %s", result.Decision, result.Policy, tt.decision)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceDatabase marks policies stored in the policies table
+const SourceDatabase = "database"
+
+// reloadInterval bounds how stale the cached engine can be on instances
+// that did not make a change themselves
+const reloadInterval = 30 * time.Second
+
+var (
+	mu       sync.Mutex
+	current  *Engine
+	loadedAt time.Time
+)
+
+// Current returns an engine over the enabled database policies and the
+// files in POLICY_DIR, reloading them every 30 seconds or after Invalidate
+func Current() (*Engine, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current != nil && time.Since(loadedAt) < reloadInterval {
+		return current, nil
+	}
+
+	policies, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	engine, err := NewEngine(policies, location())
+	if err != nil {
+		return nil, err
+	}
+	current, loadedAt = engine, time.Now()
+	return current, nil
+}
+
+// Invalidate makes the next Current call reload the policies
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	current = nil
+}
+
+// Load reads the policy files and the enabled database policies. A database
+// policy replaces a file policy with the same name.
+func Load() ([]Policy, error) {
+	files, err := LoadFiles(os.Getenv("POLICY_DIR"))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.Policy
+	if err := config.DB.Where("enabled = ?", true).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Policy, len(files)+len(rows))
+	for _, p := range files {
+		byName[p.Name] = p
+	}
+	for _, row := range rows {
+		p, err := FromModel(row)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := byName[p.Name]; ok {
+			log.Printf("Policy %q in the database overrides %s", p.Name, existing.Source)
+		}
+		byName[p.Name] = p
+	}
+
+	policies := make([]Policy, 0, len(byName))
+	for _, p := range byName {
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// LoadFiles reads every *.yaml and *.yml file in dir. Each file holds a
+// top-level "policies" list. An empty dir loads nothing.
+func LoadFiles(dir string) ([]Policy, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	var policies []Policy
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Policies []Policy `yaml:"policies"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+		}
+		for _, p := range file.Policies {
+			p.Source = path
+			if err := Validate(p); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// FromModel converts a stored policy
+func FromModel(row models.Policy) (Policy, error) {
+	p := Policy{
+		Name:        row.Name,
+		Description: row.Description,
+		Resource:    row.Resource,
+		Action:      row.Action,
+		Effect:      row.Effect,
+		Priority:    row.Priority,
+		Source:      SourceDatabase,
+	}
+	if row.Conditions != "" {
+		if err := json.Unmarshal([]byte(row.Conditions), &p.Conditions); err != nil {
+			return Policy{}, fmt.Errorf("policy %q has invalid conditions: %w", row.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// EncodeConditions returns the conditions as stored in models.Policy
+func EncodeConditions(conditions []Condition) (string, error) {
+	if conditions == nil {
+		conditions = []Condition{}
+	}
+	data, err := json.Marshal(conditions)
+	return string(data), err
+}
+
+// location is the time zone business-hour conditions are evaluated in
+func location() *time.Location {
+	name := os.Getenv("POLICY_TIMEZONE")
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid POLICY_TIMEZONE %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+// MemoryLimiter is a token bucket limiter that keeps its buckets in memory.
+// Each bucket holds up to Limit.Requests tokens and refills evenly over
+// Limit.Window. Idle buckets are evicted once they would be full again.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryLimiter creates a limiter that evicts idle buckets every cleanupInterval
+func NewMemoryLimiter(cleanupInterval time.Duration) *MemoryLimiter {
+	m := &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		stop:    make(chan struct{}),
+	}
+	go m.janitor(cleanupInterval)
+	return m
+}
+
+// Allow takes a token from the key's bucket if one is available
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return m.allow(key, limit, time.Now()), nil
+}
+
+func (m *MemoryLimiter) allow(key string, limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Window.Seconds() // tokens per second
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.window = limit.Window
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = secondsToDuration((capacity - b.tokens) / rate)
+
+	return result
+}
+
+// Close stops the cleanup goroutine
+func (m *MemoryLimiter) Close() {
+	m.once.Do(func() { close(m.stop) })
+}
+
+func (m *MemoryLimiter) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanup(time.Now())
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// cleanup removes buckets that have been idle long enough to be full again
+func (m *MemoryLimiter) cleanup(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= b.window {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
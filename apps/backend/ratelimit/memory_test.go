@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestMemoryLimiter(t *testing.T) *MemoryLimiter {
+	t.Helper()
+	m := NewMemoryLimiter(time.Hour)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestMemoryLimiterCapacityAndRefill(t *testing.T) {
+	m := newTestMemoryLimiter(t)
+	limit := Limit{Requests: 3, Window: 3 * time.Second} // one token per second
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		result := m.allow("k", limit, start)
+		if !result.Allowed || result.Remaining != 2-i || result.Limit != 3 {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, result, 2-i)
+		}
+	}
+	if result := m.allow("k", limit, start); result.Allowed {
+		t.Fatalf("fourth request = %+v, want denied at capacity", result)
+	}
+
+	// One second brings back one token, and no more than one
+	if result := m.allow("k", limit, start.Add(time.Second)); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after 1s = %+v, want allowed with none remaining", result)
+	}
+	if result := m.allow("k", limit, start.Add(time.Second)); result.Allowed {
+		t.Fatalf("second request after 1s = %+v, want denied", result)
+	}
+
+	// Idle time never fills the bucket past capacity
+	for i := 0; i < 3; i++ {
+		if result := m.allow("k", limit, start.Add(time.Hour)); !result.Allowed {
+			t.Fatalf("request %d after an hour was denied", i+1)
+		}
+	}
+	if result := m.allow("k", limit, start.Add(time.Hour)); result.Allowed {
+		t.Fatal("bucket refilled past capacity")
+	}
+
+	// Keys have their own buckets
+	if result := m.allow("other", limit, start.Add(time.Hour)); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("other key = %+v, want a full bucket", result)
+	}
+}
+
+func TestMemoryLimiterRetryAndResetAfter(t *testing.T) {
+	m := newTestMemoryLimiter(t)
+	limit := Limit{Requests: 2, Window: 10 * time.Second} // one token per 5s
+	start := time.Unix(1700000000, 0)
+
+	if result := m.allow("k", limit, start); result.ResetAfter != 5*time.Second || result.RetryAfter != 0 {
+		t.Fatalf("first request = %+v, want ResetAfter 5s and no RetryAfter", result)
+	}
+	if result := m.allow("k", limit, start); result.ResetAfter != 10*time.Second {
+		t.Fatalf("second request = %+v, want ResetAfter 10s", result)
+	}
+
+	denied := m.allow("k", limit, start.Add(2*time.Second))
+	if denied.Allowed {
+		t.Fatalf("third request = %+v, want denied", denied)
+	}
+	if denied.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %v, want 3s until the next token", denied.RetryAfter)
+	}
+	if denied.ResetAfter != 8*time.Second {
+		t.Errorf("ResetAfter = %v, want 8s until the bucket is full", denied.ResetAfter)
+	}
+
+	if result := m.allow("k", limit, start.Add(5*time.Second)); !result.Allowed {
+		t.Fatalf("request after RetryAfter = %+v, want allowed", result)
+	}
+}
+
+func TestMemoryLimiterCleanupEvictsIdleBuckets(t *testing.T) {
+	m := newTestMemoryLimiter(t)
+	start := time.Unix(1700000000, 0)
+
+	m.allow("short", Limit{Requests: 5, Window: time.Minute}, start)
+	m.allow("long", Limit{Requests: 5, Window: time.Hour}, start)
+	m.allow("recent", Limit{Requests: 5, Window: time.Minute}, start.Add(30*time.Minute))
+
+	m.cleanup(start.Add(time.Minute - time.Second))
+	if len(m.buckets) != 3 {
+		t.Fatalf("%d buckets left before any window passed, want 3", len(m.buckets))
+	}
+
+	// A bucket is evicted once it has been idle for its own window
+	m.cleanup(start.Add(time.Hour - time.Second))
+	if _, ok := m.buckets["short"]; ok {
+		t.Error("idle bucket was not evicted")
+	}
+	if _, ok := m.buckets["long"]; !ok {
+		t.Error("bucket with a longer window was evicted early")
+	}
+	if _, ok := m.buckets["recent"]; ok {
+		t.Error("bucket idle for its window was not evicted")
+	}
+
+	m.cleanup(start.Add(time.Hour))
+	if len(m.buckets) != 0 {
+		t.Fatalf("%d buckets left, want none", len(m.buckets))
+	}
+
+	// An evicted key starts over with a full bucket
+	if result := m.allow("short", Limit{Requests: 5, Window: time.Minute}, start.Add(time.Hour)); result.Remaining != 4 {
+		t.Fatalf("evicted key = %+v, want a full bucket", result)
+	}
+}
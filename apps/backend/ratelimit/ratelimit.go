@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Window for a single key
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed per window
+	Limit int
+	// Remaining is the number of requests left right now
+	Remaining int
+	// ResetAfter is the time until the full quota is available again
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request is allowed when denied
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests per key. Implementations must be safe for
+// concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Default is the limiter used by the application, configured by Init
+var Default Limiter
+
+// Init configures Default from the environment. RATE_LIMIT_DRIVER selects the
+// implementation: "memory" (default) keeps buckets in this process, "redis"
+// shares counters between processes through REDIS_URL.
+func Init() error {
+	driver := strings.ToLower(os.Getenv("RATE_LIMIT_DRIVER"))
+	if driver == "" {
+		driver = "memory"
+	}
+
+	switch driver {
+	case "memory":
+		Default = NewMemoryLimiter(time.Minute)
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			return fmt.Errorf("REDIS_URL is required for the redis rate limit driver")
+		}
+		limiter, err := NewRedisLimiter(redisURL)
+		if err != nil {
+			return err
+		}
+		Default = limiter
+	default:
+		return fmt.Errorf("unknown RATE_LIMIT_DRIVER %q", driver)
+	}
+
+	log.Printf("✅ Rate limiter configured (driver: %s)", driver)
+	return nil
+}
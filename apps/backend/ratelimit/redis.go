@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisLimiter counts requests in fixed windows shared through Redis, so
+// every server process enforces the same limits. Each key is a counter that
+// expires at the end of its window.
+type RedisLimiter struct {
+	client *redisClient
+	prefix string
+}
+
+// NewRedisLimiter connects to the server at redisURL
+// (redis://[:password@]host:port[/db])
+func NewRedisLimiter(redisURL string) (*RedisLimiter, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return nil, fmt.Errorf("invalid REDIS_URL %q", redisURL)
+	}
+	if u.Scheme == "rediss" {
+		return nil, fmt.Errorf("TLS connections (rediss://) are not supported")
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr += ":6379"
+	}
+
+	client := &redisClient{addr: addr, pool: make(chan *redisConn, 16)}
+	if u.User != nil {
+		client.password, _ = u.User.Password()
+		if client.password == "" {
+			client.password = u.User.Username()
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" && db != "0" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+		client.db = db
+	}
+
+	// Fail at startup rather than on the first request
+	if _, err := client.do(context.Background(), []string{"PING"}); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisLimiter{client: client, prefix: "ratelimit:"}, nil
+}
+
+// Allow increments the key's counter for the current window
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	redisKey := r.prefix + key
+
+	replies, err := r.client.do(ctx, []string{"INCR", redisKey}, []string{"PTTL", redisKey})
+	if err != nil {
+		return Result{}, err
+	}
+	count, ok1 := replies[0].(int64)
+	ttl, ok2 := replies[1].(int64)
+	if !ok1 || !ok2 {
+		return Result{}, fmt.Errorf("unexpected Redis reply %v", replies)
+	}
+
+	// A fresh counter (or one whose expiry was never set) starts a new window
+	if ttl < 0 {
+		ttl = limit.Window.Milliseconds()
+		if _, err := r.client.do(ctx, []string{"PEXPIRE", redisKey, strconv.FormatInt(ttl, 10)}); err != nil {
+			return Result{}, err
+		}
+	}
+
+	resetAfter := time.Duration(ttl) * time.Millisecond
+	result := Result{
+		Allowed:    count <= int64(limit.Requests),
+		Limit:      limit.Requests,
+		Remaining:  limit.Requests - int(count),
+		ResetAfter: resetAfter,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !result.Allowed {
+		result.RetryAfter = resetAfter
+	}
+
+	return result, nil
+}
@@ -0,0 +1,301 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves the commands the limiter uses over RESP, keeping counters
+// in memory against a clock the test moves
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	now      time.Time
+	counters map[string]int64
+	expires  map[string]time.Time
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		listener: listener,
+		password: password,
+		now:      time.Unix(1700000000, 0),
+		counters: map[string]int64{},
+		expires:  map[string]time.Time{},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) url(userinfo string) string {
+	return "redis://" + userinfo + f.listener.Addr().String()
+}
+
+func (f *fakeRedis) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func (f *fakeRedis) seen(command string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case name == "AUTH":
+			authenticated = len(args) == 2 && args[1] == f.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = f.exec(name, args[1:])
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(name string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, strings.Join(append([]string{name}, args...), " "))
+
+	// Expire keys lazily, as Redis does on access
+	for key, at := range f.expires {
+		if !f.now.Before(at) {
+			delete(f.counters, key)
+			delete(f.expires, key)
+		}
+	}
+
+	switch name {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "INCR":
+		f.counters[args[0]]++
+		return fmt.Sprintf(":%d\r\n", f.counters[args[0]])
+	case "PTTL":
+		if _, ok := f.counters[args[0]]; !ok {
+			return ":-2\r\n"
+		}
+		at, ok := f.expires[args[0]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", at.Sub(f.now).Milliseconds())
+	case "PEXPIRE":
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		f.expires[args[0]] = f.now.Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command '" + name + "'\r\n"
+	}
+}
+
+// readCommand reads one RESP array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, count)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad argument header %q", header)
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func TestRedisLimiterWindow(t *testing.T) {
+	server := newFakeRedis(t, "")
+	limiter, err := NewRedisLimiter(server.url(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	for i := 1; i <= 3; i++ {
+		result, err := limiter.Allow(ctx, "ip:1", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != 3-i || result.Limit != 3 {
+			t.Fatalf("request %d: got %+v, want allowed with %d remaining", i, result, 3-i)
+		}
+		if result.ResetAfter != time.Minute {
+			t.Fatalf("request %d: ResetAfter = %v, want the full window", i, result.ResetAfter)
+		}
+	}
+
+	server.advance(20 * time.Second)
+	result, err := limiter.Allow(ctx, "ip:1", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 40*time.Second {
+		t.Fatalf("request over the limit: got %+v, want denied for 40s", result)
+	}
+
+	// Other keys are counted separately
+	if result, err := limiter.Allow(ctx, "ip:2", limit); err != nil || !result.Allowed {
+		t.Fatalf("other key: got %+v, %v, want allowed", result, err)
+	}
+
+	// The counter starts over once its window has expired
+	server.advance(40 * time.Second)
+	result, err = limiter.Allow(ctx, "ip:1", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("next window: got %+v, want allowed with 2 remaining", result)
+	}
+	if !server.seen("INCR ratelimit:ip:1") || !server.seen("PEXPIRE ratelimit:ip:1 60000") {
+		t.Fatal("limiter did not use prefixed, expiring counters")
+	}
+}
+
+func TestRedisLimiterRestoresMissingExpiry(t *testing.T) {
+	server := newFakeRedis(t, "")
+	limiter, err := NewRedisLimiter(server.url(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A counter left without an expiry, as after a crash between INCR and
+	// PEXPIRE, must not block the key forever
+	server.mu.Lock()
+	server.counters["ratelimit:stuck"] = 100
+	server.mu.Unlock()
+
+	limit := Limit{Requests: 1, Window: time.Second}
+	result, err := limiter.Allow(context.Background(), "stuck", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.ResetAfter != time.Second {
+		t.Fatalf("got %+v, want denied until a new one second window ends", result)
+	}
+
+	server.advance(time.Second)
+	if result, err := limiter.Allow(context.Background(), "stuck", limit); err != nil || !result.Allowed {
+		t.Fatalf("after the window: got %+v, %v, want allowed", result, err)
+	}
+}
+
+func TestRedisLimiterAuthAndDatabase(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+
+	if _, err := NewRedisLimiter(server.url("")); err == nil {
+		t.Fatal("connected without a password")
+	}
+	if _, err := NewRedisLimiter(server.url(":wrong@")); err == nil {
+		t.Fatal("connected with the wrong password")
+	}
+
+	limiter, err := NewRedisLimiter(server.url(":secret@") + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := limiter.Allow(context.Background(), "user:1", Limit{Requests: 1, Window: time.Minute}); err != nil || !result.Allowed {
+		t.Fatalf("got %+v, %v, want allowed", result, err)
+	}
+	if !server.seen("SELECT 2") {
+		t.Fatal("database from the URL was not selected")
+	}
+}
+
+func TestRedisLimiterErrorReplyKeepsConnection(t *testing.T) {
+	server := newFakeRedis(t, "")
+	limiter, err := NewRedisLimiter(server.url(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An error reply is returned, and the pipeline is read to the end so the
+	// pooled connection stays usable
+	if _, err := limiter.client.do(context.Background(), []string{"NOPE"}, []string{"PING"}); err == nil {
+		t.Fatal("error reply was not reported")
+	}
+	if result, err := limiter.Allow(context.Background(), "ip:1", Limit{Requests: 1, Window: time.Minute}); err != nil || !result.Allowed {
+		t.Fatalf("after an error reply: got %+v, %v, want allowed", result, err)
+	}
+}
+
+func TestNewRedisLimiterRejectsBadURLs(t *testing.T) {
+	for _, redisURL := range []string{"http://localhost:6379", "rediss://localhost:6379", "redis://localhost:6379/x"} {
+		if _, err := NewRedisLimiter(redisURL); err == nil {
+			t.Errorf("NewRedisLimiter(%q) succeeded", redisURL)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package rbac
+
+import (
+	"backend/models"
+	"sync"
+)
+
+// TargetPolicy vets an action on a specific row after the permission check
+// has passed, returning a *DeniedError to refuse it
+type TargetPolicy func(actor *models.User, permissions *PermissionSet, action string, target models.Ownable) error
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string][]TargetPolicy{}
+)
+
+// RegisterTargetPolicy adds a policy consulted by AuthorizeTarget for the resource
+func RegisterTargetPolicy(resource string, policy TargetPolicy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[resource] = append(policies[resource], policy)
+}
+
+// DeniedError explains why AuthorizeTarget refused an action. Decision is
+// set when no grant allowed it and nil when a target policy refused it.
+type DeniedError struct {
+	Reason   string
+	Decision *Decision
+}
+
+func (e *DeniedError) Error() string {
+	return e.Reason
+}
+
+// AuthorizeTarget checks that the actor may perform the action on the target
+// row. Own-scoped grants only count when the actor owns the row, and every
+// policy registered for the resource must agree.
+func AuthorizeTarget(actor *models.User, permissions *PermissionSet, resource, action string, target models.Ownable) error {
+	decision := permissions.decideTarget(actor, resource, action, target)
+	if !decision.Allowed {
+		return &DeniedError{Reason: decision.Reason, Decision: &decision}
+	}
+	return checkTargetPolicies(actor, permissions, resource, action, target)
+}
+
+// DecideTarget is AuthorizeTarget returning the decision. A refusal by a
+// target policy is reported without a grant.
+func DecideTarget(actor *models.User, permissions *PermissionSet, resource, action string, target models.Ownable) Decision {
+	decision := permissions.decideTarget(actor, resource, action, target)
+	if !decision.Allowed {
+		return decision
+	}
+	if err := checkTargetPolicies(actor, permissions, resource, action, target); err != nil {
+		return Decision{Reason: err.Error()}
+	}
+	return decision
+}
+
+// decideTarget is Decide for the target row, counting own-scoped grants
+// when the actor owns it
+func (ps *PermissionSet) decideTarget(actor *models.User, resource, action string, target models.Ownable) Decision {
+	decision := ps.Decide(resource, action)
+	if !decision.Allowed && target.OwnerID() == actor.ID {
+		decision = ps.DecideOwn(resource, action)
+	}
+	return decision
+}
+
+func checkTargetPolicies(actor *models.User, permissions *PermissionSet, resource, action string, target models.Ownable) error {
+	policiesMu.RLock()
+	resourcePolicies := policies[resource]
+	policiesMu.RUnlock()
+	for _, policy := range resourcePolicies {
+		if err := policy(actor, permissions, action, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unrestricted reports whether the set holds the full "*" wildcard through a
+// shared role, without any denial, which exempts it from role containment.
+// A wildcard on an organization's own role only reaches that organization,
+// so it does not count.
+func (ps *PermissionSet) Unrestricted() bool {
+	full := false
+	for _, grant := range ps.Grants {
+		if grant.Effect == models.EffectDeny {
+			return false
+		}
+		if grant.Permission.Specificity() == 0 && !grant.Permission.OwnOnly() && ps.sharedRole(grant.Role) {
+			full = true
+		}
+	}
+	return full
+}
+
+// sharedRole reports whether the set's role with the name belongs to no
+// organization
+func (ps *PermissionSet) sharedRole(name string) bool {
+	for _, role := range ps.Roles {
+		if role.Name == name {
+			return role.OrganizationID == nil
+		}
+	}
+	return false
+}
+
+// Covers reports whether the set already allows everything the permission
+// does, so that granting it to a role gives its holders nothing the set
+// lacks. No denial of the set may overlap it either.
+func (ps *PermissionSet) Covers(permission models.Permission) bool {
+	for _, grant := range ps.Grants {
+		if grant.Effect == models.EffectDeny && overlaps(grant.Permission, permission) {
+			return false
+		}
+	}
+	if permission.OwnOnly() {
+		return ps.DecideOwn(permission.Resource, permission.Action).Allowed
+	}
+	return ps.Decide(permission.Resource, permission.Action).Allowed
+}
+
+// HoldsRoles reports whether the set acts as every one of the roles. Users
+// can only hand out, or manage holders of, roles they hold themselves. Roles
+// defined by the set's organization are also within reach of anyone allowed
+// roles.write there, who manage those roles anyway.
+func (ps *PermissionSet) HoldsRoles(roles []models.Role) bool {
+	if ps.Unrestricted() {
+		return true
+	}
+	managesOwn := ps.Decide("roles", "write").Allowed
+	for _, role := range roles {
+		if managesOwn && role.OrganizationID != nil && *role.OrganizationID == ps.OrganizationID {
+			continue
+		}
+		if !ps.ActsAs(role.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	// A user may only be changed by someone who holds every role they hold,
+	// so users.write on its own does not reach more privileged accounts.
+	// Nobody deletes their own account.
+	RegisterTargetPolicy("users", func(actor *models.User, permissions *PermissionSet, action string, target models.Ownable) error {
+		user, ok := target.(*models.User)
+		if !ok || action == "read" {
+			return nil
+		}
+		if action == "delete" && user.ID == actor.ID {
+			return &DeniedError{Reason: "Cannot delete your own account"}
+		}
+		if !permissions.HoldsRoles(user.Roles) {
+			return &DeniedError{Reason: "Cannot modify a user holding a role you do not hold"}
+		}
+		return nil
+	})
+}
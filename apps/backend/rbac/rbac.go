@@ -0,0 +1,428 @@
+// Package rbac resolves the effective roles and permissions of a user.
+// Roles form a hierarchy: a role inherits every permission of its parent
+// roles, transitively. The hierarchy is a DAG; cycles are rejected when
+// parents are assigned.
+package rbac
+
+import (
+	"backend/config"
+	"backend/models"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// ErrRoleCycle is returned when assigning parents would make a role inherit from itself
+var ErrRoleCycle = errors.New("role hierarchy cycle")
+
+// Grant is a permission allowed or denied through a role
+type Grant struct {
+	Permission models.Permission `json:"permission"`
+	Role       string            `json:"role"`      // role that grants the permission
+	Effect     string            `json:"effect"`    // models.EffectAllow or models.EffectDeny
+	Inherited  bool              `json:"inherited"` // held through a parent role rather than directly
+}
+
+// PermissionSet is the effective access of a set of roles, including
+// everything inherited from their ancestors
+type PermissionSet struct {
+	Roles  []models.Role `json:"roles"`
+	Grants []Grant       `json:"grants"`
+	// OrganizationID is the organization the roles were loaded for, when
+	// known
+	OrganizationID uuid.UUID `json:"-"`
+}
+
+// ForUser resolves the effective permissions of the user's loaded roles
+func ForUser(user *models.User) (*PermissionSet, error) {
+	roleIDs := make([]uuid.UUID, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return ForRoles(roleIDs)
+}
+
+// ForRoles resolves the effective permissions of the given roles
+func ForRoles(roleIDs []uuid.UUID) (*PermissionSet, error) {
+	set := &PermissionSet{}
+	if len(roleIDs) == 0 {
+		return set, nil
+	}
+
+	ancestors, err := Ancestors(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	direct := make(map[uuid.UUID]bool, len(roleIDs))
+	ids := make([]uuid.UUID, 0, len(roleIDs)+len(ancestors))
+	for _, id := range roleIDs {
+		direct[id] = true
+		ids = append(ids, id)
+	}
+	for id := range ancestors {
+		if !direct[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	var roles []models.Role
+	if err := config.DB.Where("id IN ?", ids).Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	// Grants are read from the join table directly because the effect lives there
+	var links []models.RolePermission
+	if err := config.DB.Where("role_id IN ?", ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	permissionIDs := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		permissionIDs = append(permissionIDs, link.PermissionID)
+	}
+	permissions := make(map[uuid.UUID]models.Permission)
+	if len(permissionIDs) > 0 {
+		var found []models.Permission
+		if err := config.DB.Where("id IN ?", permissionIDs).Order("name").Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, permission := range found {
+			permissions[permission.ID] = permission
+		}
+	}
+
+	for _, role := range roles {
+		var grants []Grant
+		for _, link := range links {
+			permission, ok := permissions[link.PermissionID]
+			if link.RoleID != role.ID || !ok {
+				continue
+			}
+			effect := link.Effect
+			if effect == "" {
+				effect = models.EffectAllow
+			}
+			grants = append(grants, Grant{
+				Permission: permission,
+				Role:       role.Name,
+				Effect:     effect,
+				Inherited:  !direct[role.ID],
+			})
+		}
+		sort.Slice(grants, func(i, j int) bool { return grants[i].Permission.Name < grants[j].Permission.Name })
+		set.Grants = append(set.Grants, grants...)
+		set.Roles = append(set.Roles, role)
+	}
+	return set, nil
+}
+
+// SeparateDenied moves the permissions that roles deny from Permissions to
+// DeniedPermissions. Preloading Permissions returns every grant regardless
+// of its effect.
+func SeparateDenied(roles []models.Role) error {
+	roleIDs := make([]uuid.UUID, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	if len(roleIDs) == 0 {
+		return nil
+	}
+
+	var denials []models.RolePermission
+	if err := config.DB.Where("role_id IN ? AND effect = ?", roleIDs, models.EffectDeny).Find(&denials).Error; err != nil {
+		return err
+	}
+	denied := make(map[[2]uuid.UUID]bool, len(denials))
+	for _, denial := range denials {
+		denied[[2]uuid.UUID{denial.RoleID, denial.PermissionID}] = true
+	}
+
+	for i := range roles {
+		allowed := roles[i].Permissions[:0:0]
+		for _, permission := range roles[i].Permissions {
+			if denied[[2]uuid.UUID{roles[i].ID, permission.ID}] {
+				roles[i].DeniedPermissions = append(roles[i].DeniedPermissions, permission)
+			} else {
+				allowed = append(allowed, permission)
+			}
+		}
+		roles[i].Permissions = allowed
+	}
+	return nil
+}
+
+// SeparateDeniedForUsers applies SeparateDenied to the roles of each user
+func SeparateDeniedForUsers(users []models.User) error {
+	for i := range users {
+		if err := SeparateDenied(users[i].Roles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ancestors returns every role the given roles inherit from, directly or
+// through other parents. Deleted roles break the chain.
+func Ancestors(roleIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	seen := make(map[uuid.UUID]bool)
+	frontier := roleIDs
+
+	for len(frontier) > 0 {
+		var parents []uuid.UUID
+		if err := config.DB.Table("role_parents").
+			Joins("JOIN roles ON roles.id = role_parents.parent_id AND roles.deleted_at IS NULL").
+			Where("role_parents.role_id IN ?", frontier).
+			Pluck("role_parents.parent_id", &parents).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, id := range parents {
+			if !seen[id] {
+				seen[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// Descendants returns every role that inherits from the given roles,
+// directly or through other children. Deleted roles break the chain.
+func Descendants(roleIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	seen := make(map[uuid.UUID]bool)
+	frontier := roleIDs
+
+	for len(frontier) > 0 {
+		var children []uuid.UUID
+		if err := config.DB.Table("role_parents").
+			Joins("JOIN roles ON roles.id = role_parents.role_id AND roles.deleted_at IS NULL").
+			Where("role_parents.parent_id IN ?", frontier).
+			Pluck("role_parents.role_id", &children).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, id := range children {
+			if !seen[id] {
+				seen[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// Granting returns the roles with an allow grant for the action on every
+// row of the resource, directly or inherited. Deny grants are not taken
+// into account, so holders still need their PermissionSet checked.
+func Granting(resource, action string) ([]uuid.UUID, error) {
+	var candidates []models.Permission
+	if err := config.DB.
+		Where("resource = ? OR resource = ?", resource, models.PermissionWildcard).
+		Where("action = ? OR action = ?", action, models.PermissionWildcard).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	permissionIDs := make([]uuid.UUID, 0, len(candidates))
+	for _, permission := range candidates {
+		if permission.Matches(resource, action) && !permission.OwnOnly() {
+			permissionIDs = append(permissionIDs, permission.ID)
+		}
+	}
+	if len(permissionIDs) == 0 {
+		return nil, nil
+	}
+
+	var direct []uuid.UUID
+	if err := config.DB.Model(&models.RolePermission{}).
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL").
+		Where("role_permissions.permission_id IN ?", permissionIDs).
+		Where("role_permissions.effect = ? OR role_permissions.effect = ''", models.EffectAllow).
+		Distinct().
+		Pluck("role_permissions.role_id", &direct).Error; err != nil {
+		return nil, err
+	}
+	if len(direct) == 0 {
+		return nil, nil
+	}
+
+	descendants, err := Descendants(direct)
+	if err != nil {
+		return nil, err
+	}
+	roleIDs := direct
+	for _, id := range direct {
+		delete(descendants, id)
+	}
+	for id := range descendants {
+		roleIDs = append(roleIDs, id)
+	}
+	return roleIDs, nil
+}
+
+// ValidateParents returns ErrRoleCycle if giving roleID the parents would
+// make it inherit from itself
+func ValidateParents(roleID uuid.UUID, parentIDs []uuid.UUID) error {
+	for _, id := range parentIDs {
+		if id == roleID {
+			return ErrRoleCycle
+		}
+	}
+
+	ancestors, err := Ancestors(parentIDs)
+	if err != nil {
+		return err
+	}
+	if ancestors[roleID] {
+		return ErrRoleCycle
+	}
+	return nil
+}
+
+// HasRole reports whether the set includes the role, directly or inherited
+func (ps *PermissionSet) HasRole(name string) bool {
+	for _, role := range ps.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ActsAs reports whether the set holds the role with everything it allows
+// intact. A deny grant on another role that overlaps any of the role's allow
+// grants takes the role away, as deny grants win over allow grants in
+// permission checks too.
+func (ps *PermissionSet) ActsAs(name string) bool {
+	if !ps.HasRole(name) {
+		return false
+	}
+	for _, grant := range ps.Grants {
+		if grant.Role != name || grant.Effect == models.EffectDeny {
+			continue
+		}
+		for _, denial := range ps.Grants {
+			if denial.Effect == models.EffectDeny && denial.Role != name && overlaps(grant.Permission, denial.Permission) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// overlaps reports whether two permissions cover a common resource and action
+func overlaps(a, b models.Permission) bool {
+	return (a.Resource == b.Resource || a.Resource == models.PermissionWildcard || b.Resource == models.PermissionWildcard) &&
+		(a.Action == b.Action || a.Action == models.PermissionWildcard || b.Action == models.PermissionWildcard)
+}
+
+// Decision is the outcome of a permission check
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Grant   *Grant `json:"grant,omitempty"` // grant that decided the check, nil when none matched
+	Reason  string `json:"reason"`
+}
+
+// Decide checks the action on every row of the resource, so own-scoped
+// grants are ignored. A matching deny grant always wins over allow grants,
+// however specific they are. Among grants of the same effect the most
+// specific decides (see models.Permission.Specificity), and a direct grant
+// wins over an inherited one.
+func (ps *PermissionSet) Decide(resource, action string) Decision {
+	return ps.decide(resource, action, false)
+}
+
+// DecideOwn is Decide for a row the user owns, where own-scoped grants apply too
+func (ps *PermissionSet) DecideOwn(resource, action string) Decision {
+	return ps.decide(resource, action, true)
+}
+
+// Scope returns models.ScopeAny if the action is allowed on every row,
+// models.ScopeOwn if only on rows the user owns and "" if on none
+func (ps *PermissionSet) Scope(resource, action string) string {
+	switch {
+	case ps.Decide(resource, action).Allowed:
+		return models.ScopeAny
+	case ps.DecideOwn(resource, action).Allowed:
+		return models.ScopeOwn
+	}
+	return ""
+}
+
+func (ps *PermissionSet) decide(resource, action string, owned bool) Decision {
+	var allow, deny *Grant
+	for i := range ps.Grants {
+		grant := &ps.Grants[i]
+		if !grant.Permission.Matches(resource, action) || (grant.Permission.OwnOnly() && !owned) {
+			continue
+		}
+		if grant.Effect == models.EffectDeny {
+			if deny == nil || outranks(grant, deny) {
+				deny = grant
+			}
+		} else if allow == nil || outranks(grant, allow) {
+			allow = grant
+		}
+	}
+
+	switch {
+	case deny != nil:
+		return Decision{Grant: deny, Reason: fmt.Sprintf("denied by %s on role %s", deny.Permission.Name, deny.Role)}
+	case allow != nil:
+		return Decision{Allowed: true, Grant: allow, Reason: fmt.Sprintf("allowed by %s on role %s", allow.Permission.Name, allow.Role)}
+	}
+	return Decision{Reason: "no role grants " + resource + "." + action}
+}
+
+func outranks(a, b *Grant) bool {
+	if sa, sb := a.Permission.Specificity(), b.Permission.Specificity(); sa != sb {
+		return sa > sb
+	}
+	return !a.Inherited && b.Inherited
+}
+
+// DecideName is Decide for a permission name such as "menu.dashboard"
+func (ps *PermissionSet) DecideName(name string) Decision {
+	if resource, action, ok := models.SplitPermissionName(name); ok {
+		if decision := ps.Decide(resource, action); decision.Grant != nil {
+			return decision
+		}
+	}
+
+	// Permissions created before names had to be "<resource>.<action>"
+	decision := Decision{Reason: "no role grants " + name}
+	for i := range ps.Grants {
+		grant := &ps.Grants[i]
+		if grant.Permission.Name != name {
+			continue
+		}
+		if grant.Effect == models.EffectDeny {
+			return Decision{Grant: grant, Reason: fmt.Sprintf("denied by %s on role %s", name, grant.Role)}
+		}
+		decision = Decision{Allowed: true, Grant: grant, Reason: fmt.Sprintf("allowed by %s on role %s", name, grant.Role)}
+	}
+	return decision
+}
+
+// Allows reports whether the set allows the action on the resource
+func (ps *PermissionSet) Allows(resource, action string) bool {
+	return ps.Decide(resource, action).Allowed
+}
+
+// AllowsName is Allows for a permission name
+func (ps *PermissionSet) AllowsName(name string) bool {
+	return ps.DecideName(name).Allowed
+}
+
+// RequiresMFA reports whether any effective role requires MFA
+func (ps *PermissionSet) RequiresMFA() bool {
+	for _, role := range ps.Roles {
+		if role.RequireMFA {
+			return true
+		}
+	}
+	return false
+}
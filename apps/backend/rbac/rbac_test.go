@@ -0,0 +1,382 @@
+package rbac
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/testdb"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func permission(name string) models.Permission {
+	p := models.Permission{Name: name, Scope: models.ScopeAny}
+	if base, scope, ok := strings.Cut(name, ":"); ok {
+		name, p.Scope = base, scope
+	}
+	p.Resource, p.Action, _ = models.SplitPermissionName(name)
+	return p
+}
+
+func allow(name, role string) Grant {
+	return Grant{Permission: permission(name), Role: role, Effect: models.EffectAllow}
+}
+
+func deny(name, role string) Grant {
+	return Grant{Permission: permission(name), Role: role, Effect: models.EffectDeny}
+}
+
+func inherited(grant Grant) Grant {
+	grant.Inherited = true
+	return grant
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name      string
+		grants    []Grant
+		owned     bool
+		allowed   bool
+		decidedBy string // "<permission>@<role>" of the deciding grant, "" for none
+	}{
+		{"no grants", nil, false, false, ""},
+		{"exact allow", []Grant{allow("users.read", "viewer")}, false, true, "users.read@viewer"},
+		{"other action", []Grant{allow("users.write", "editor")}, false, false, ""},
+		{"resource wildcard", []Grant{allow("users.*", "manager")}, false, true, "users.*@manager"},
+		{"full wildcard", []Grant{allow("*", "admin")}, false, true, "*@admin"},
+		{"most specific allow decides", []Grant{allow("*", "admin"), allow("users.*", "manager"), allow("users.read", "viewer")}, false, true, "users.read@viewer"},
+		{"resource outranks action", []Grant{allow("*.read", "reader"), allow("users.*", "manager")}, false, true, "users.*@manager"},
+		{"direct outranks inherited", []Grant{inherited(allow("users.read", "base")), allow("users.read", "viewer")}, false, true, "users.read@viewer"},
+		{"deny beats allow", []Grant{allow("users.read", "viewer"), deny("users.read", "suspended")}, false, false, "users.read@suspended"},
+		{"wildcard deny beats specific allow", []Grant{allow("users.read", "viewer"), deny("*", "suspended")}, false, false, "*@suspended"},
+		{"inherited deny beats direct allow", []Grant{allow("users.read", "viewer"), inherited(deny("users.*", "base"))}, false, false, "users.*@base"},
+		{"most specific deny is reported", []Grant{deny("*", "a"), deny("users.read", "b")}, false, false, "users.read@b"},
+		{"own allow ignored for any row", []Grant{allow("users.read:own", "user")}, false, false, ""},
+		{"own allow applies to owned row", []Grant{allow("users.read:own", "user")}, true, true, "users.read:own@user"},
+		{"own deny ignored for any row", []Grant{allow("users.read", "viewer"), deny("users.read:own", "user")}, false, true, "users.read@viewer"},
+		{"own deny applies to owned row", []Grant{allow("users.read", "viewer"), deny("users.read:own", "user")}, true, false, "users.read:own@user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &PermissionSet{Grants: tt.grants}
+			decision := set.Decide("users", "read")
+			if tt.owned {
+				decision = set.DecideOwn("users", "read")
+			}
+			if decision.Allowed != tt.allowed {
+				t.Fatalf("Allowed = %v, want %v (%s)", decision.Allowed, tt.allowed, decision.Reason)
+			}
+			decidedBy := ""
+			if decision.Grant != nil {
+				decidedBy = decision.Grant.Permission.Name + "@" + decision.Grant.Role
+			}
+			if decidedBy != tt.decidedBy {
+				t.Fatalf("decided by %q, want %q", decidedBy, tt.decidedBy)
+			}
+			if decision.Reason == "" {
+				t.Fatal("decision has no reason")
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		grants []Grant
+		want   string
+	}{
+		{"any", []Grant{allow("posts.write", "editor")}, models.ScopeAny},
+		{"own", []Grant{allow("posts.write:own", "author")}, models.ScopeOwn},
+		{"own and any", []Grant{allow("posts.write:own", "author"), allow("posts.write", "editor")}, models.ScopeAny},
+		{"denied", []Grant{allow("posts.write:own", "author"), deny("posts.*", "banned")}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &PermissionSet{Grants: tt.grants}
+			if got := set.Scope("posts", "write"); got != tt.want {
+				t.Fatalf("Scope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActsAs(t *testing.T) {
+	admin := models.Role{Name: "admin"}
+	tests := []struct {
+		name   string
+		grants []Grant
+		want   bool
+	}{
+		{"holds the role", []Grant{allow("*", "admin")}, true},
+		{"denial elsewhere on an unrelated resource", []Grant{allow("users.*", "admin"), deny("billing.read", "support")}, true},
+		{"denial within the wildcard", []Grant{allow("*", "admin"), deny("users.delete", "suspended")}, false},
+		{"wildcard denial", []Grant{allow("users.read", "admin"), deny("*.read", "suspended")}, false},
+		{"inherited denial", []Grant{allow("users.read", "admin"), inherited(deny("users.*", "base"))}, false},
+		{"denial on the role itself", []Grant{allow("*", "admin"), deny("users.delete", "admin")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &PermissionSet{Roles: []models.Role{admin, {Name: "support"}}, Grants: tt.grants}
+			if got := set.ActsAs("admin"); got != tt.want {
+				t.Fatalf("ActsAs(admin) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (&PermissionSet{Grants: []Grant{allow("*", "admin")}}).ActsAs("admin") {
+		t.Fatal("ActsAs without holding the role")
+	}
+}
+
+func TestHoldsRoles(t *testing.T) {
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	editor := models.Role{Name: "editor"}
+	own := models.Role{Name: "reviewer", OrganizationID: &orgID}
+	orgAdmin := models.Role{Name: "org-admin", OrganizationID: &orgID}
+	other := models.Role{Name: "auditor", OrganizationID: &otherOrgID}
+	tests := []struct {
+		name   string
+		grants []Grant
+		roles  []models.Role
+		want   bool
+	}{
+		{"holds every role", []Grant{allow("users.write", "editor")}, []models.Role{editor}, true},
+		{"shared role not held", []Grant{allow("roles.write", "editor")}, []models.Role{editor, {Name: "admin"}}, false},
+		{"own role with roles.write", []Grant{allow("roles.write", "editor")}, []models.Role{editor, own}, true},
+		{"own role without roles.write", []Grant{allow("users.write", "editor")}, []models.Role{own}, false},
+		{"own role with roles.write denied", []Grant{allow("roles.*", "editor"), deny("roles.write", "suspended")}, []models.Role{own}, false},
+		{"another organization's role", []Grant{allow("roles.write", "editor")}, []models.Role{other}, false},
+		{"unrestricted", []Grant{allow("*", "editor")}, []models.Role{{Name: "admin"}, other}, true},
+		{"organization wildcard does not reach shared roles", []Grant{allow("*", "org-admin")}, []models.Role{{Name: "admin"}}, false},
+		{"organization wildcard reaches own roles", []Grant{allow("*", "org-admin")}, []models.Role{own}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &PermissionSet{Roles: []models.Role{editor, orgAdmin}, Grants: tt.grants, OrganizationID: orgID}
+			if got := set.HoldsRoles(tt.roles); got != tt.want {
+				t.Fatalf("HoldsRoles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		name       string
+		grants     []Grant
+		permission string
+		want       bool
+	}{
+		{"exact grant", []Grant{allow("users.read", "viewer")}, "users.read", true},
+		{"wildcard grant", []Grant{allow("users.*", "manager")}, "users.delete", true},
+		{"not held", []Grant{allow("users.read", "viewer")}, "users.write", false},
+		{"wider than held", []Grant{allow("users.*", "manager")}, "*", false},
+		{"full wildcard", []Grant{allow("*", "owner")}, "*", true},
+		{"wildcard with a denial", []Grant{allow("*", "owner"), deny("users.delete", "limited")}, "*", false},
+		{"own held for own", []Grant{allow("users.write:own", "user")}, "users.write:own", true},
+		{"own held for any", []Grant{allow("users.write:own", "user")}, "users.write", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &PermissionSet{Grants: tt.grants}
+			if got := set.Covers(permission(tt.permission)); got != tt.want {
+				t.Fatalf("Covers(%s) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecideName(t *testing.T) {
+	set := &PermissionSet{Grants: []Grant{
+		allow("menu.*", "user"),
+		deny("menu.billing", "support"),
+		{Permission: models.Permission{Name: "legacy_reports"}, Role: "user", Effect: models.EffectAllow},
+	}}
+
+	for name, want := range map[string]bool{
+		"menu.dashboard": true,
+		"menu.billing":   false,
+		"legacy_reports": true,
+		"unknown":        false,
+	} {
+		if got := set.AllowsName(name); got != want {
+			t.Errorf("AllowsName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAuthorizeTargetOwnership(t *testing.T) {
+	actor := &models.User{ID: uuid.New()}
+	set := &PermissionSet{Grants: []Grant{allow("users.write:own", "user")}}
+
+	if err := AuthorizeTarget(actor, set, "users", "write", &models.User{ID: actor.ID}); err != nil {
+		t.Fatalf("own account: %v", err)
+	}
+	err := AuthorizeTarget(actor, set, "users", "write", &models.User{ID: uuid.New()})
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Decision == nil {
+		t.Fatalf("other account: got %v, want a DeniedError with a decision", err)
+	}
+}
+
+func TestUsersTargetPolicyContainment(t *testing.T) {
+	actor := &models.User{ID: uuid.New()}
+	manager := &PermissionSet{
+		Roles:  []models.Role{{Name: "manager"}, {Name: "user"}},
+		Grants: []Grant{allow("users.*", "manager")},
+	}
+	admin := &models.User{ID: uuid.New(), Roles: []models.Role{{Name: "admin"}}}
+	member := &models.User{ID: uuid.New(), Roles: []models.Role{{Name: "user"}}}
+
+	if err := AuthorizeTarget(actor, manager, "users", "write", member); err != nil {
+		t.Fatalf("user holding only roles the actor holds: %v", err)
+	}
+	if err := AuthorizeTarget(actor, manager, "users", "read", admin); err != nil {
+		t.Fatalf("reading a more privileged user: %v", err)
+	}
+	err := AuthorizeTarget(actor, manager, "users", "write", admin)
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Decision != nil {
+		t.Fatalf("writing a more privileged user: got %v, want a policy DeniedError", err)
+	}
+
+	superuser := &PermissionSet{Roles: []models.Role{{Name: "root"}}, Grants: []Grant{allow("*", "root")}}
+	if err := AuthorizeTarget(actor, superuser, "users", "write", admin); err != nil {
+		t.Fatalf("unrestricted actor: %v", err)
+	}
+	if err := AuthorizeTarget(actor, superuser, "users", "delete", admin); err != nil {
+		t.Fatalf("unrestricted actor deleting another user: %v", err)
+	}
+	if decision := DecideTarget(actor, superuser, "users", "delete", actor); decision.Allowed {
+		t.Fatal("actor may delete their own account")
+	}
+}
+
+// TestForRolesInheritance builds the hierarchy
+//
+//	base <- editor <- lead
+//	base <- auditor
+//
+// and checks what each role ends up with
+func TestForRolesInheritance(t *testing.T) {
+	config.DB = testdb.Open(t)
+
+	create := func(value interface{}) {
+		t.Helper()
+		if err := config.DB.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	perms := map[string]*models.Permission{}
+	for _, name := range []string{"docs.read", "docs.write", "docs.publish"} {
+		p := permission(name)
+		create(&p)
+		perms[name] = &p
+	}
+	roles := map[string]*models.Role{}
+	for _, name := range []string{"test-base", "test-editor", "test-lead", "test-auditor"} {
+		role := models.Role{Name: name}
+		create(&role)
+		roles[name] = &role
+	}
+	link := func(role, name, effect string) {
+		create(&models.RolePermission{RoleID: roles[role].ID, PermissionID: perms[name].ID, Effect: effect})
+	}
+	parent := func(role, parent string) {
+		create(&models.RoleParent{RoleID: roles[role].ID, ParentID: roles[parent].ID})
+	}
+	link("test-base", "docs.read", models.EffectAllow)
+	link("test-editor", "docs.write", models.EffectAllow)
+	link("test-lead", "docs.publish", models.EffectAllow)
+	link("test-auditor", "docs.write", models.EffectDeny)
+	parent("test-editor", "test-base")
+	parent("test-lead", "test-editor")
+	parent("test-auditor", "test-base")
+
+	lead, err := ForRoles([]uuid.UUID{roles["test-lead"].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test-base", "test-editor", "test-lead"} {
+		if !lead.HasRole(name) {
+			t.Errorf("lead does not hold %s", name)
+		}
+	}
+	if lead.HasRole("test-auditor") {
+		t.Error("lead holds a sibling role")
+	}
+	for _, action := range []string{"read", "write", "publish"} {
+		if !lead.Allows("docs", action) {
+			t.Errorf("lead cannot %s docs", action)
+		}
+	}
+	if decision := lead.Decide("docs", "read"); decision.Grant == nil || !decision.Grant.Inherited || decision.Grant.Role != "test-base" {
+		t.Errorf("docs.read should be inherited from test-base, got %+v", decision.Grant)
+	}
+	if decision := lead.Decide("docs", "publish"); decision.Grant == nil || decision.Grant.Inherited {
+		t.Errorf("docs.publish should be direct, got %+v", decision.Grant)
+	}
+
+	// A denial on one role overrides what another role allows
+	both, err := ForRoles([]uuid.UUID{roles["test-lead"].ID, roles["test-auditor"].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if both.Allows("docs", "write") {
+		t.Error("docs.write is allowed despite the auditor denial")
+	}
+	if !both.Allows("docs", "read") {
+		t.Error("docs.read is no longer allowed")
+	}
+
+	// Cycles are refused, directly or through ancestors
+	if err := ValidateParents(roles["test-base"].ID, []uuid.UUID{roles["test-lead"].ID}); !errors.Is(err, ErrRoleCycle) {
+		t.Errorf("base <- lead: got %v, want ErrRoleCycle", err)
+	}
+	if err := ValidateParents(roles["test-base"].ID, []uuid.UUID{roles["test-base"].ID}); !errors.Is(err, ErrRoleCycle) {
+		t.Errorf("base <- base: got %v, want ErrRoleCycle", err)
+	}
+	if err := ValidateParents(roles["test-auditor"].ID, []uuid.UUID{roles["test-editor"].ID}); err != nil {
+		t.Errorf("auditor <- editor: %v", err)
+	}
+
+	// Granting finds holders through parents, and leaves deny grants to the caller
+	granting := func(action string) map[string]bool {
+		t.Helper()
+		ids, err := Granting("docs", action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for name, role := range roles {
+			for _, id := range ids {
+				if id == role.ID {
+					names[name] = true
+				}
+			}
+		}
+		return names
+	}
+	if names := granting("read"); len(names) != 4 {
+		t.Errorf("roles granting docs.read = %v, want all four", names)
+	}
+	if names := granting("write"); len(names) != 2 || !names["test-editor"] || !names["test-lead"] {
+		t.Errorf("roles granting docs.write = %v, want test-editor and test-lead", names)
+	}
+
+	// Deleting a role breaks the chain through it
+	if err := config.DB.Delete(roles["test-editor"]).Error; err != nil {
+		t.Fatal(err)
+	}
+	lead, err = ForRoles([]uuid.UUID{roles["test-lead"].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lead.HasRole("test-base") || lead.Allows("docs", "read") {
+		t.Error("lead still inherits through a deleted role")
+	}
+}
@@ -0,0 +1,250 @@
+package requestlog
+
+import (
+	"backend/config"
+	"backend/models"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink stores a batch of request log entries. Writer calls it from a single
+// goroutine, and the batch is reused once Write returns.
+type Sink interface {
+	Write(entries []models.RequestLog) error
+}
+
+// Stats counts what happened to the entries given to a Writer
+type Stats struct {
+	Written int64 `json:"written"`
+	// Dropped entries found the buffer full, or the writer closed
+	Dropped int64 `json:"dropped"`
+	// Failed entries were in a batch the sink could not write, even after
+	// retrying
+	Failed int64 `json:"failed"`
+}
+
+// Writer buffers request log entries and writes them to its sink in batches,
+// once BatchSize entries are waiting or FlushInterval has passed
+type Writer struct {
+	sink     Sink
+	settings config.RequestLogConfig
+	entries  chan models.RequestLog
+	done     chan struct{}
+
+	// abandon is cancelled when Close gives up waiting, ending retries
+	abandon     context.Context
+	stopRetries context.CancelFunc
+
+	// mu guards closed, so that no entry is sent once entries is closed
+	mu     sync.RWMutex
+	closed bool
+
+	written         atomic.Int64
+	dropped         atomic.Int64
+	failed          atomic.Int64
+	reportedDropped int64 // only used by run
+}
+
+// Default is the writer used by the request logging middleware, configured
+// by Init
+var Default *Writer
+
+// Init configures Default from the environment. REQUEST_LOG_DRIVER selects
+// the sink: "database" (default) appends to the request_logs hash chain,
+// "stdout" and "file" write JSON lines, the latter to REQUEST_LOG_FILE.
+// Connect to the database before Init.
+func Init() error {
+	driver := strings.ToLower(os.Getenv("REQUEST_LOG_DRIVER"))
+	if driver == "" {
+		driver = "database"
+	}
+
+	var sink Sink
+	switch driver {
+	case "database":
+		sink = &DatabaseSink{DB: config.DB}
+	case "stdout":
+		sink = NewStreamSink(os.Stdout)
+	case "file":
+		fileSink, err := NewFileSink(getEnv("REQUEST_LOG_FILE", "tmp/requests.log"))
+		if err != nil {
+			return err
+		}
+		sink = fileSink
+	default:
+		return fmt.Errorf("unknown REQUEST_LOG_DRIVER %q", driver)
+	}
+
+	settings := config.RequestLog()
+	Default = NewWriter(sink, settings)
+	log.Printf("✅ Request log configured (driver: %s, overflow: %s)", driver, settings.Overflow)
+	return nil
+}
+
+// Log hands an entry to the default writer
+func Log(entry models.RequestLog) {
+	if Default != nil {
+		Default.Log(entry)
+	}
+}
+
+// NewWriter starts a writer that batches entries into sink
+func NewWriter(sink Sink, settings config.RequestLogConfig) *Writer {
+	if settings.BatchSize < 1 {
+		settings.BatchSize = 1
+	}
+	if settings.BufferSize < settings.BatchSize {
+		settings.BufferSize = settings.BatchSize
+	}
+	if settings.FlushInterval <= 0 {
+		settings.FlushInterval = time.Second
+	}
+	if settings.RetryBackoff <= 0 {
+		settings.RetryBackoff = 100 * time.Millisecond
+	}
+
+	w := &Writer{
+		sink:     sink,
+		settings: settings,
+		entries:  make(chan models.RequestLog, settings.BufferSize),
+		done:     make(chan struct{}),
+	}
+	w.abandon, w.stopRetries = context.WithCancel(context.Background())
+	go w.run()
+	return w
+}
+
+// Log queues an entry without waiting for it to be written. When the buffer
+// is full the entry is dropped, or with the block overflow policy the caller
+// waits up to BlockTimeout for room first.
+func (w *Writer) Log(entry models.RequestLog) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+
+	select {
+	case w.entries <- entry:
+		return
+	default:
+	}
+
+	if w.settings.Overflow == config.RequestLogBlock {
+		timer := time.NewTimer(w.settings.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case w.entries <- entry:
+			return
+		case <-timer.C:
+		}
+	}
+	w.dropped.Add(1)
+}
+
+// Close stops accepting entries and waits until the buffered ones are
+// written or ctx is done. Once ctx is done, failed batches are no longer
+// retried.
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.stopRetries()
+		return ctx.Err()
+	}
+}
+
+// Stats returns the writer's counters
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Written: w.written.Load(),
+		Dropped: w.dropped.Load(),
+		Failed:  w.failed.Load(),
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.settings.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.RequestLog, 0, w.settings.BatchSize)
+	for {
+		select {
+		case entry, ok := <-w.entries:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.settings.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes a batch and reports entries dropped since the last flush
+func (w *Writer) flush(batch []models.RequestLog) {
+	if dropped := w.dropped.Load(); dropped > w.reportedDropped {
+		log.Printf("Dropped %d request log entries (%d in total)", dropped-w.reportedDropped, dropped)
+		w.reportedDropped = dropped
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.write(batch); err != nil {
+		w.failed.Add(int64(len(batch)))
+		log.Printf("Failed to write %d request log entries: %v", len(batch), err)
+		return
+	}
+	w.written.Add(int64(len(batch)))
+}
+
+// write gives the sink up to RetryAttempts more tries at a batch, backing
+// off between them, until the writer is abandoned
+func (w *Writer) write(batch []models.RequestLog) error {
+	err := w.sink.Write(batch)
+	backoff := w.settings.RetryBackoff
+	for attempt := 0; err != nil && attempt < w.settings.RetryAttempts; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-w.abandon.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		err = w.sink.Write(batch)
+	}
+	return err
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,244 @@
+package requestlog
+
+import (
+	"backend/config"
+	"backend/models"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink records the batches it is given. Writes wait while the sink is
+// held, and the next failures writes fail; a negative count fails them all.
+type fakeSink struct {
+	mu       sync.Mutex
+	batches  [][]models.RequestLog
+	attempts int
+	failures int
+
+	gate    chan struct{}
+	writing chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	gate := make(chan struct{})
+	close(gate)
+	return &fakeSink{gate: gate, writing: make(chan struct{}, 100)}
+}
+
+// hold makes writes wait until the returned function is called
+func (s *fakeSink) hold() (release func()) {
+	gate := make(chan struct{})
+	s.mu.Lock()
+	s.gate = gate
+	s.mu.Unlock()
+	return func() { close(gate) }
+}
+
+func (s *fakeSink) Write(entries []models.RequestLog) error {
+	s.mu.Lock()
+	gate := s.gate
+	s.mu.Unlock()
+	s.writing <- struct{}{}
+	<-gate
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]models.RequestLog(nil), entries...))
+	return nil
+}
+
+func (s *fakeSink) tries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+func (s *fakeSink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizes := make([]int, len(s.batches))
+	for i, batch := range s.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+// waitFor polls until done reports true
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if done() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func closeWriter(t *testing.T, w *Writer) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestWriterFlushesFullBatches(t *testing.T) {
+	sink := newFakeSink()
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 10, BatchSize: 3, FlushInterval: time.Hour})
+
+	for i := 0; i < 7; i++ {
+		w.Log(models.RequestLog{Path: "/"})
+	}
+	waitFor(t, "two full batches", func() bool { return len(sink.sizes()) == 2 })
+	if sizes := sink.sizes(); sizes[0] != 3 || sizes[1] != 3 {
+		t.Fatalf("batch sizes = %v, want [3 3]", sizes)
+	}
+
+	// The remainder is only written on Close, long before the interval
+	closeWriter(t, w)
+	if sizes := sink.sizes(); len(sizes) != 3 || sizes[2] != 1 {
+		t.Fatalf("batch sizes after Close = %v, want [3 3 1]", sizes)
+	}
+	if stats := w.Stats(); stats != (Stats{Written: 7}) {
+		t.Fatalf("stats = %+v, want 7 written", stats)
+	}
+}
+
+func TestWriterFlushesOnInterval(t *testing.T) {
+	sink := newFakeSink()
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 100, BatchSize: 100, FlushInterval: 20 * time.Millisecond})
+	defer closeWriter(t, w)
+
+	w.Log(models.RequestLog{Path: "/a"})
+	w.Log(models.RequestLog{Path: "/b"})
+	waitFor(t, "the interval flush", func() bool { return len(sink.sizes()) > 0 })
+	if sizes := sink.sizes(); sizes[0] != 2 {
+		t.Fatalf("batch sizes = %v, want one batch of 2", sizes)
+	}
+}
+
+func TestWriterDropsWhenFull(t *testing.T) {
+	sink := newFakeSink()
+	release := sink.hold()
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 1, BatchSize: 1, FlushInterval: time.Hour, Overflow: config.RequestLogDrop})
+
+	// The first entry is taken by the writer, which waits on the sink, and
+	// the second fills the buffer
+	w.Log(models.RequestLog{Path: "/1"})
+	<-sink.writing
+	w.Log(models.RequestLog{Path: "/2"})
+	w.Log(models.RequestLog{Path: "/3"})
+	w.Log(models.RequestLog{Path: "/4"})
+	if dropped := w.Stats().Dropped; dropped != 2 {
+		t.Fatalf("dropped = %d, want 2", dropped)
+	}
+
+	release()
+	closeWriter(t, w)
+	if stats := w.Stats(); stats != (Stats{Written: 2, Dropped: 2}) {
+		t.Fatalf("stats = %+v, want 2 written and 2 dropped", stats)
+	}
+}
+
+func TestWriterBlockTimeout(t *testing.T) {
+	sink := newFakeSink()
+	release := sink.hold()
+	w := NewWriter(sink, config.RequestLogConfig{
+		BufferSize:    1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Overflow:      config.RequestLogBlock,
+		BlockTimeout:  200 * time.Millisecond,
+	})
+
+	w.Log(models.RequestLog{Path: "/1"})
+	<-sink.writing
+	w.Log(models.RequestLog{Path: "/2"})
+
+	// Without room, the caller waits out BlockTimeout and the entry is dropped
+	start := time.Now()
+	w.Log(models.RequestLog{Path: "/3"})
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Fatalf("Log returned after %v, want it to wait for BlockTimeout", waited)
+	}
+	if dropped := w.Stats().Dropped; dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+
+	// Room made while the caller waits takes the entry
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	w.Log(models.RequestLog{Path: "/4"})
+
+	closeWriter(t, w)
+	if stats := w.Stats(); stats != (Stats{Written: 3, Dropped: 1}) {
+		t.Fatalf("stats = %+v, want 3 written and 1 dropped", stats)
+	}
+}
+
+func TestWriterCloseDrainsBuffer(t *testing.T) {
+	sink := newFakeSink()
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 100, BatchSize: 100, FlushInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		w.Log(models.RequestLog{Path: "/"})
+	}
+	closeWriter(t, w)
+	if sizes := sink.sizes(); len(sizes) != 1 || sizes[0] != 5 {
+		t.Fatalf("batch sizes = %v, want one batch of 5", sizes)
+	}
+
+	// Entries logged after Close are counted, not written
+	w.Log(models.RequestLog{Path: "/late"})
+	closeWriter(t, w)
+	if stats := w.Stats(); stats != (Stats{Written: 5, Dropped: 1}) {
+		t.Fatalf("stats = %+v, want 5 written and 1 dropped", stats)
+	}
+}
+
+func TestWriterRetriesFailedBatches(t *testing.T) {
+	sink := newFakeSink()
+	sink.failures = 2
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour, RetryAttempts: 3, RetryBackoff: time.Millisecond})
+
+	w.Log(models.RequestLog{Path: "/"})
+	closeWriter(t, w)
+	if tries := sink.tries(); tries != 3 {
+		t.Fatalf("sink was tried %d times, want 3", tries)
+	}
+	if stats := w.Stats(); stats != (Stats{Written: 1}) {
+		t.Fatalf("stats = %+v, want the entry written", stats)
+	}
+}
+
+func TestWriterGivesUpWhenCloseTimesOut(t *testing.T) {
+	sink := newFakeSink()
+	sink.failures = -1 // every write fails
+	w := NewWriter(sink, config.RequestLogConfig{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour, RetryAttempts: 5, RetryBackoff: time.Hour})
+
+	w.Log(models.RequestLog{Path: "/"})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want the deadline to pass while retrying", err)
+	}
+
+	// Retries stop with Close, rather than waiting out the backoff
+	waitFor(t, "the batch to fail", func() bool { return w.Stats().Failed == 1 })
+	if tries := sink.tries(); tries != 1 {
+		t.Fatalf("sink was tried %d times, want 1", tries)
+	}
+}
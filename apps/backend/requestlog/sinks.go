@@ -0,0 +1,64 @@
+package requestlog
+
+import (
+	"backend/audit"
+	"backend/models"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DatabaseSink appends entries to the request_logs hash chain, one
+// transaction per batch
+type DatabaseSink struct {
+	DB *gorm.DB
+}
+
+// Write appends the batch
+func (s *DatabaseSink) Write(entries []models.RequestLog) error {
+	records := make([]models.Chained, len(entries))
+	for i := range entries {
+		records[i] = &entries[i]
+	}
+	return audit.Append(s.DB, records...)
+}
+
+// StreamSink writes entries as JSON lines. They are not hash chained.
+type StreamSink struct {
+	encoder *json.Encoder
+}
+
+// NewStreamSink writes entries to w
+func NewStreamSink(w io.Writer) *StreamSink {
+	return &StreamSink{encoder: json.NewEncoder(w)}
+}
+
+// NewFileSink appends entries to the file at path, creating it if needed.
+// The file stays open for the lifetime of the process.
+func NewFileSink(path string) (*StreamSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamSink(file), nil
+}
+
+// Write encodes each entry on its own line
+func (s *StreamSink) Write(entries []models.RequestLog) error {
+	for _, entry := range entries {
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.New()
+		}
+		if err := s.encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
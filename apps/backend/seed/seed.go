@@ -0,0 +1,734 @@
+// Package seed reconciles the default permissions, roles, grants, menus,
+// feature flags and policies defined in seed.yaml with the database. It is shared by the server, which applies
+// it on every start, and cmd/seed.
+package seed
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:embed seed.yaml
+var definitionYAML []byte
+
+// Definition is the parsed seed file
+type Definition struct {
+	Permissions []PermissionDef `yaml:"permissions"`
+	Roles       []RoleDef       `yaml:"roles"`
+	Menus       []MenuDef       `yaml:"menus"`
+	Features    []FeatureDef    `yaml:"features"`
+	Policies    []PolicyDef     `yaml:"policies"`
+	Users       []UserDef       `yaml:"users"`
+}
+
+type PermissionDef struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Resource    string `yaml:"resource"`
+	Action      string `yaml:"action"`
+	Scope       string `yaml:"scope"` // defaults to "any"
+}
+
+type RoleDef struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	RequireMFA  bool   `yaml:"require_mfa"`
+	// AllPermissions grants every permission in the definition
+	AllPermissions bool     `yaml:"all_permissions"`
+	Permissions    []string `yaml:"permissions"`
+	// Parents are roles whose permissions this role inherits
+	Parents []string `yaml:"parents"`
+}
+
+type MenuDef struct {
+	Name       string    `yaml:"name"`
+	Label      string    `yaml:"label"`
+	Icon       string    `yaml:"icon"`
+	Path       string    `yaml:"path"`
+	Permission string    `yaml:"permission"`
+	Feature    string    `yaml:"feature"`
+	Children   []MenuDef `yaml:"children"`
+}
+
+// FeatureDef is a feature flag; see models.FeatureFlag
+type FeatureDef struct {
+	Name         string          `yaml:"name"`
+	Description  string          `yaml:"description"`
+	DefaultOn    bool            `yaml:"default_on"`
+	Environments map[string]bool `yaml:"environments"`
+	Roles        []string        `yaml:"roles"`
+	Percentage   int             `yaml:"percentage"`
+}
+
+// PolicyDef is an attribute-based policy without conditions; see
+// models.Policy. Conditional policies are added through the API or
+// POLICY_DIR.
+type PolicyDef struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Resource    string `yaml:"resource"`
+	Action      string `yaml:"action"`
+	Effect      string `yaml:"effect"`
+	Priority    int    `yaml:"priority"`
+}
+
+type UserDef struct {
+	Username  string   `yaml:"username"`
+	Email     string   `yaml:"email"`
+	Password  string   `yaml:"password"`
+	FirstName string   `yaml:"first_name"`
+	LastName  string   `yaml:"last_name"`
+	Roles     []string `yaml:"roles"`
+}
+
+// Options controls how the definition is applied
+type Options struct {
+	// Force resets existing default permissions, roles, grants, menus, feature
+	// flags and policies to the definition instead of only adding what is
+	// missing
+	Force bool
+	// DryRun reports the changes without applying them
+	DryRun bool
+	// Users also creates the demo users
+	Users bool
+}
+
+// Change is a single difference between the definition and the database
+type Change struct {
+	Op     string `json:"op"`   // create, update, grant, revoke, link or unlink
+	Kind   string `json:"kind"` // permission, role, menu, feature, policy or user
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (c Change) String() string {
+	symbol := map[string]string{"create": "+", "grant": "+", "link": "+", "update": "~", "revoke": "-", "unlink": "-"}[c.Op]
+	s := fmt.Sprintf("%s %s %s %s", symbol, c.Op, c.Kind, c.Name)
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// Load parses and validates the embedded definition
+func Load() (*Definition, error) {
+	var def Definition
+	if err := yaml.Unmarshal(definitionYAML, &def); err != nil {
+		return nil, fmt.Errorf("invalid seed definition: %w", err)
+	}
+
+	permissions := make(map[string]bool)
+	for i := range def.Permissions {
+		if def.Permissions[i].Scope == "" {
+			def.Permissions[i].Scope = models.ScopeAny
+		}
+	}
+	for _, p := range def.Permissions {
+		if err := (models.Permission{Name: p.Name, Resource: p.Resource, Action: p.Action, Scope: p.Scope}).Validate(); err != nil {
+			return nil, fmt.Errorf("seed permission %q: %w", p.Name, err)
+		}
+		if permissions[p.Name] {
+			return nil, fmt.Errorf("seed permission %q is defined twice", p.Name)
+		}
+		permissions[p.Name] = true
+	}
+
+	roles := make(map[string]bool)
+	for _, r := range def.Roles {
+		if r.Name == "" || roles[r.Name] {
+			return nil, fmt.Errorf("seed role %q is empty or defined twice", r.Name)
+		}
+		roles[r.Name] = true
+		for _, name := range r.Permissions {
+			if !permissions[name] {
+				return nil, fmt.Errorf("seed role %q grants undefined permission %q", r.Name, name)
+			}
+		}
+	}
+
+	parents := make(map[string][]string)
+	for _, r := range def.Roles {
+		for _, name := range r.Parents {
+			if !roles[name] {
+				return nil, fmt.Errorf("seed role %q inherits from undefined role %q", r.Name, name)
+			}
+		}
+		parents[r.Name] = r.Parents
+	}
+	for _, r := range def.Roles {
+		if inheritsFrom(parents, r.Name, r.Name, map[string]bool{}) {
+			return nil, fmt.Errorf("seed role %q inherits from itself", r.Name)
+		}
+	}
+
+	menus := make(map[string]bool)
+	if err := validateMenus(def.Menus, permissions, menus); err != nil {
+		return nil, err
+	}
+
+	features := make(map[string]bool)
+	for _, f := range def.Features {
+		if f.Name == "" || features[f.Name] {
+			return nil, fmt.Errorf("seed feature %q is empty or defined twice", f.Name)
+		}
+		features[f.Name] = true
+		if f.Percentage < 0 || f.Percentage > 100 {
+			return nil, fmt.Errorf("seed feature %q has a percentage outside 0-100", f.Name)
+		}
+		for _, name := range f.Roles {
+			if !roles[name] {
+				return nil, fmt.Errorf("seed feature %q targets undefined role %q", f.Name, name)
+			}
+		}
+	}
+	for _, menu := range def.Menus {
+		if err := checkMenuFeatures(menu, features); err != nil {
+			return nil, err
+		}
+	}
+
+	policies := make(map[string]bool)
+	for _, p := range def.Policies {
+		if p.Name == "" || policies[p.Name] {
+			return nil, fmt.Errorf("seed policy %q is empty or defined twice", p.Name)
+		}
+		policies[p.Name] = true
+		if p.Resource == "" || p.Action == "" {
+			return nil, fmt.Errorf("seed policy %q needs a resource and action", p.Name)
+		}
+		if p.Effect != models.EffectAllow && p.Effect != models.EffectDeny {
+			return nil, fmt.Errorf("seed policy %q has an effect other than allow or deny", p.Name)
+		}
+	}
+
+	for _, u := range def.Users {
+		for _, name := range u.Roles {
+			if !roles[name] {
+				return nil, fmt.Errorf("seed user %q has undefined role %q", u.Username, name)
+			}
+		}
+	}
+
+	return &def, nil
+}
+
+// validateMenus checks that menu names are unique and that menus only
+// require permissions defined in the seed
+func validateMenus(defs []MenuDef, permissions, seen map[string]bool) error {
+	for _, m := range defs {
+		if m.Name == "" || seen[m.Name] {
+			return fmt.Errorf("seed menu %q is empty or defined twice", m.Name)
+		}
+		seen[m.Name] = true
+		if !permissions[m.Permission] {
+			return fmt.Errorf("seed menu %q requires undefined permission %q", m.Name, m.Permission)
+		}
+		if err := validateMenus(m.Children, permissions, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMenuFeatures checks that the menu and its children only require
+// features defined in the seed
+func checkMenuFeatures(menu MenuDef, features map[string]bool) error {
+	if menu.Feature != "" && !features[menu.Feature] {
+		return fmt.Errorf("seed menu %q requires undefined feature %q", menu.Name, menu.Feature)
+	}
+	for _, child := range menu.Children {
+		if err := checkMenuFeatures(child, features); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inheritsFrom reports whether role reaches target through its parents
+func inheritsFrom(parents map[string][]string, role, target string, seen map[string]bool) bool {
+	for _, parent := range parents[role] {
+		if parent == target {
+			return true
+		}
+		if !seen[parent] {
+			seen[parent] = true
+			if inheritsFrom(parents, parent, target, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply reconciles the definition with the database and returns the changes.
+// By default only missing permissions and roles are created, and grants are
+// added only for roles or permissions created in this run, so edits made by
+// administrators survive restarts. With Force, existing defaults are reset
+// to the definition; custom roles and permissions are never touched.
+func Apply(db *gorm.DB, opts Options) ([]Change, error) {
+	def, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	err = db.Transaction(func(tx *gorm.DB) error {
+		changes, err = reconcile(tx, def, opts)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return changes, err
+}
+
+var errDryRun = errors.New("dry run")
+
+// createOrFind inserts a row, loading the existing row matching query
+// instead when another process created it concurrently
+func createOrFind[T any](tx *gorm.DB, value *T, query string, args ...interface{}) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(value)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+
+	var existing T
+	if err := tx.Where(query, args...).First(&existing).Error; err != nil {
+		return err
+	}
+	*value = existing
+	return nil
+}
+
+func reconcile(tx *gorm.DB, def *Definition, opts Options) ([]Change, error) {
+	var changes []Change
+
+	// Permissions; soft-deleted defaults count as existing and stay deleted
+	permissions := make(map[string]*models.Permission)
+	createdPermissions := make(map[string]bool)
+	for _, p := range def.Permissions {
+		var permission models.Permission
+		err := tx.Unscoped().Where("name = ?", p.Name).First(&permission).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			permission = models.Permission{Name: p.Name, Description: p.Description, Resource: p.Resource, Action: p.Action, Scope: p.Scope}
+			if err := createOrFind(tx, &permission, "name = ?", p.Name); err != nil {
+				return nil, err
+			}
+			createdPermissions[p.Name] = true
+			changes = append(changes, Change{Op: "create", Kind: "permission", Name: p.Name})
+		case err != nil:
+			return nil, err
+		case permission.DeletedAt.Valid:
+			continue
+		case opts.Force && (permission.Description != p.Description || permission.Resource != p.Resource ||
+			permission.Action != p.Action || permission.Scope != p.Scope):
+			if err := tx.Model(&permission).Updates(map[string]interface{}{
+				"description": p.Description, "resource": p.Resource, "action": p.Action, "scope": p.Scope,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "update", Kind: "permission", Name: p.Name})
+		}
+		permissions[p.Name] = &permission
+	}
+
+	// Roles and their grants
+	roles := make(map[string]*models.Role)
+	createdRoles := make(map[string]bool)
+	for _, r := range def.Roles {
+		var role models.Role
+		created := false
+		err := tx.Unscoped().Where("name = ? AND organization_id IS NULL", r.Name).First(&role).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			role = models.Role{Name: r.Name, Description: r.Description, RequireMFA: r.RequireMFA}
+			if err := createOrFind(tx, &role, "name = ? AND organization_id IS NULL", r.Name); err != nil {
+				return nil, err
+			}
+			created = true
+			changes = append(changes, Change{Op: "create", Kind: "role", Name: r.Name})
+		case err != nil:
+			return nil, err
+		case role.DeletedAt.Valid:
+			continue
+		case opts.Force && (role.Description != r.Description || role.RequireMFA != r.RequireMFA):
+			if err := tx.Model(&role).Updates(map[string]interface{}{
+				"description": r.Description, "require_mfa": r.RequireMFA,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "update", Kind: "role", Name: r.Name})
+		}
+		roles[r.Name] = &role
+		createdRoles[r.Name] = created
+
+		grantChanges, err := reconcileGrants(tx, def, r, &role, created, permissions, createdPermissions, opts.Force)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, grantChanges...)
+	}
+
+	// Inheritance, once every role exists
+	for _, r := range def.Roles {
+		role, ok := roles[r.Name]
+		if !ok {
+			continue
+		}
+		linkChanges, err := reconcileParents(tx, def, r, role, createdRoles[r.Name], roles, opts.Force)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, linkChanges...)
+	}
+
+	menuChanges, err := reconcileMenus(tx, def.Menus, nil, opts.Force)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, menuChanges...)
+
+	featureChanges, err := reconcileFeatures(tx, def.Features, opts.Force)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, featureChanges...)
+
+	policyChanges, err := reconcilePolicies(tx, def.Policies, opts.Force)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, policyChanges...)
+
+	if opts.Users {
+		userChanges, err := createUsers(tx, def, roles)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, userChanges...)
+	}
+
+	return changes, nil
+}
+
+// reconcileMenus creates missing menus under parentID, ordered as listed.
+// With force, existing default menus are reset to the definition. Deleted
+// menus stay deleted, along with the defaults nested under them.
+func reconcileMenus(tx *gorm.DB, defs []MenuDef, parentID *uuid.UUID, force bool) ([]Change, error) {
+	var changes []Change
+	for i, m := range defs {
+		sortOrder := (i + 1) * 10
+		var menu models.Menu
+		err := tx.Unscoped().Where("name = ?", m.Name).First(&menu).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			menu = models.Menu{ParentID: parentID, Name: m.Name, Label: m.Label, Icon: m.Icon, Path: m.Path,
+				Permission: m.Permission, Feature: m.Feature, SortOrder: sortOrder}
+			if err := createOrFind(tx, &menu, "name = ?", m.Name); err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "create", Kind: "menu", Name: m.Name})
+		case err != nil:
+			return nil, err
+		case menu.DeletedAt.Valid:
+			continue
+		case force && (menu.Label != m.Label || menu.Icon != m.Icon || menu.Path != m.Path || menu.Permission != m.Permission ||
+			menu.Feature != m.Feature || menu.SortOrder != sortOrder || !sameParent(menu.ParentID, parentID)):
+			if err := tx.Model(&menu).Updates(map[string]interface{}{
+				"parent_id": parentID, "label": m.Label, "icon": m.Icon, "path": m.Path,
+				"permission": m.Permission, "feature": m.Feature, "sort_order": sortOrder,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "update", Kind: "menu", Name: m.Name})
+		}
+
+		childChanges, err := reconcileMenus(tx, m.Children, &menu.ID, force)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, childChanges...)
+	}
+	return changes, nil
+}
+
+// reconcileFeatures creates missing feature flags. With force, existing
+// default flags get the definition's defaults and role targeting back;
+// users and organizations targeted since are kept.
+func reconcileFeatures(tx *gorm.DB, defs []FeatureDef, force bool) ([]Change, error) {
+	var changes []Change
+	for _, f := range defs {
+		environments := models.JSONMap{}
+		for environment, on := range f.Environments {
+			environments[environment] = on
+		}
+		roles := models.JSONList(f.Roles)
+		if roles == nil {
+			roles = models.JSONList{}
+		}
+
+		var flag models.FeatureFlag
+		err := tx.Unscoped().Where("name = ?", f.Name).First(&flag).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			flag = models.FeatureFlag{Name: f.Name, Description: f.Description, DefaultOn: f.DefaultOn,
+				Environments: environments, Roles: roles, UserIDs: models.JSONList{}, OrganizationIDs: models.JSONList{},
+				Percentage: f.Percentage}
+			if err := createOrFind(tx, &flag, "name = ?", f.Name); err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "create", Kind: "feature", Name: f.Name})
+		case err != nil:
+			return nil, err
+		case flag.DeletedAt.Valid:
+			continue
+		case force && (flag.Description != f.Description || flag.DefaultOn != f.DefaultOn || flag.Percentage != f.Percentage ||
+			!reflect.DeepEqual(flag.Environments, environments) || !reflect.DeepEqual(flag.Roles, roles)):
+			if err := tx.Model(&flag).Updates(map[string]interface{}{
+				"description": f.Description, "default_on": f.DefaultOn, "environments": environments,
+				"roles": roles, "percentage": f.Percentage,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "update", Kind: "feature", Name: f.Name})
+		}
+	}
+	return changes, nil
+}
+
+// reconcilePolicies creates missing policies, enabled. With force, existing
+// default policies are reset to the definition and enabled again, and any
+// conditions added since are removed.
+func reconcilePolicies(tx *gorm.DB, defs []PolicyDef, force bool) ([]Change, error) {
+	var changes []Change
+	for _, p := range defs {
+		var row models.Policy
+		err := tx.Unscoped().Where("name = ?", p.Name).First(&row).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			row = models.Policy{Name: p.Name, Description: p.Description, Resource: p.Resource, Action: p.Action,
+				Effect: p.Effect, Priority: p.Priority, Conditions: "[]", Enabled: true}
+			if err := createOrFind(tx, &row, "name = ?", p.Name); err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "create", Kind: "policy", Name: p.Name})
+		case err != nil:
+			return nil, err
+		case row.DeletedAt.Valid:
+			continue
+		case force && (row.Description != p.Description || row.Resource != p.Resource || row.Action != p.Action ||
+			row.Effect != p.Effect || row.Priority != p.Priority || row.Conditions != "[]" || !row.Enabled):
+			if err := tx.Model(&row).Updates(map[string]interface{}{
+				"description": p.Description, "resource": p.Resource, "action": p.Action, "effect": p.Effect,
+				"priority": p.Priority, "conditions": "[]", "enabled": true,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "update", Kind: "policy", Name: p.Name})
+		}
+	}
+	return changes, nil
+}
+
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func reconcileGrants(tx *gorm.DB, def *Definition, r RoleDef, role *models.Role, roleCreated bool,
+	permissions map[string]*models.Permission, createdPermissions map[string]bool, force bool) ([]Change, error) {
+	desired := make(map[string]bool)
+	if r.AllPermissions {
+		for _, p := range def.Permissions {
+			desired[p.Name] = true
+		}
+	}
+	for _, name := range r.Permissions {
+		desired[name] = true
+	}
+
+	var current []struct{ Name, Effect string }
+	if !roleCreated {
+		if err := tx.Table("role_permissions").
+			Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+			Where("role_permissions.role_id = ?", role.ID).
+			Select("permissions.name, role_permissions.effect").
+			Scan(&current).Error; err != nil {
+			return nil, err
+		}
+	}
+	// The seed only defines allow grants; denials added by administrators
+	// are kept unless forced
+	granted := make(map[string]bool, len(current))
+	denied := make(map[string]bool)
+	for _, row := range current {
+		if row.Effect == models.EffectDeny {
+			denied[row.Name] = true
+		} else {
+			granted[row.Name] = true
+		}
+	}
+
+	var changes []Change
+	for _, p := range def.Permissions {
+		permission, ok := permissions[p.Name]
+		if !ok {
+			continue
+		}
+		grant := roleCreated || createdPermissions[p.Name] || force
+
+		switch {
+		case denied[p.Name] && force:
+			if err := tx.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).
+				Delete(&models.RolePermission{}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "revoke", Kind: "role", Name: r.Name, Detail: "deny " + p.Name})
+			if desired[p.Name] {
+				if err := tx.Create(&models.RolePermission{RoleID: role.ID, PermissionID: permission.ID}).Error; err != nil {
+					return nil, err
+				}
+				changes = append(changes, Change{Op: "grant", Kind: "role", Name: r.Name, Detail: p.Name})
+			}
+		case denied[p.Name]:
+			continue
+		case desired[p.Name] && !granted[p.Name] && grant:
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RolePermission{
+				RoleID:       role.ID,
+				PermissionID: permission.ID,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "grant", Kind: "role", Name: r.Name, Detail: p.Name})
+		case !desired[p.Name] && granted[p.Name] && force:
+			if err := tx.Where("role_id = ? AND permission_id = ?", role.ID, permission.ID).
+				Delete(&models.RolePermission{}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "revoke", Kind: "role", Name: r.Name, Detail: p.Name})
+		}
+	}
+	return changes, nil
+}
+
+// reconcileParents links a role to its default parents. Like grants, links
+// are only added to roles created in this run unless forced, and forcing
+// removes links to other default roles that the definition does not list.
+func reconcileParents(tx *gorm.DB, def *Definition, r RoleDef, role *models.Role, roleCreated bool,
+	roles map[string]*models.Role, force bool) ([]Change, error) {
+	if !roleCreated && !force {
+		return nil, nil
+	}
+
+	var current []uuid.UUID
+	if !roleCreated {
+		if err := tx.Model(&models.RoleParent{}).Where("role_id = ?", role.ID).
+			Pluck("parent_id", &current).Error; err != nil {
+			return nil, err
+		}
+	}
+	linked := make(map[uuid.UUID]bool, len(current))
+	for _, id := range current {
+		linked[id] = true
+	}
+	desired := make(map[string]bool, len(r.Parents))
+	for _, name := range r.Parents {
+		desired[name] = true
+	}
+
+	var changes []Change
+	for _, d := range def.Roles {
+		name := d.Name
+		parent, ok := roles[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case desired[name] && !linked[parent.ID]:
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RoleParent{
+				RoleID:   role.ID,
+				ParentID: parent.ID,
+			}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "link", Kind: "role", Name: r.Name, Detail: "inherits " + name})
+		case !desired[name] && linked[parent.ID]:
+			if err := tx.Where("role_id = ? AND parent_id = ?", role.ID, parent.ID).
+				Delete(&models.RoleParent{}).Error; err != nil {
+				return nil, err
+			}
+			changes = append(changes, Change{Op: "unlink", Kind: "role", Name: r.Name, Detail: "inherits " + name})
+		}
+	}
+	return changes, nil
+}
+
+// createUsers creates missing demo users; existing users are never changed
+func createUsers(tx *gorm.DB, def *Definition, roles map[string]*models.Role) ([]Change, error) {
+	var changes []Change
+	for _, u := range def.Users {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ? OR email = ?", u.Username, u.Email).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		user := models.User{
+			ID:              uuid.New(),
+			Username:        u.Username,
+			Email:           u.Email,
+			EmailVerifiedAt: &now,
+			Password:        string(hashedPassword),
+			FirstName:       u.FirstName,
+			LastName:        u.LastName,
+			IsActive:        true,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return nil, err
+		}
+
+		// Demo users belong to the default organization
+		if err := tx.Create(&models.OrganizationMember{OrganizationID: models.DefaultOrganizationID, UserID: user.ID}).Error; err != nil {
+			return nil, err
+		}
+		for _, name := range u.Roles {
+			role, ok := roles[name]
+			if !ok {
+				continue
+			}
+			if err := tx.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID, OrganizationID: models.DefaultOrganizationID}).Error; err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, Change{Op: "create", Kind: "user", Name: u.Username})
+	}
+	return changes, nil
+}
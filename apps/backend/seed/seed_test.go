@@ -0,0 +1,249 @@
+package seed
+
+import (
+	"backend/models"
+	"backend/testdb"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	def, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range def.Roles {
+		found = found || r.Name == models.DefaultRoleName
+	}
+	if !found {
+		t.Fatalf("seed does not define the default role %q", models.DefaultRoleName)
+	}
+	for _, p := range def.Permissions {
+		if p.Scope == "" {
+			t.Fatalf("permission %q has no scope after loading", p.Name)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidDefinitions(t *testing.T) {
+	base := `
+permissions:
+  - {name: docs.read, resource: docs, action: read}
+`
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"mismatched name", `
+permissions:
+  - {name: docs.view, resource: docs, action: read}
+`, `seed permission "docs.view"`},
+		{"duplicate permission", base + `
+  - {name: docs.read, resource: docs, action: read}
+`, "defined twice"},
+		{"undefined grant", base + `
+roles:
+  - {name: reader, permissions: [docs.write]}
+`, `grants undefined permission "docs.write"`},
+		{"duplicate role", base + `
+roles:
+  - {name: reader}
+  - {name: reader}
+`, `seed role "reader" is empty or defined twice`},
+		{"undefined parent", base + `
+roles:
+  - {name: reader, parents: [base]}
+`, `inherits from undefined role "base"`},
+		{"inheritance cycle", base + `
+roles:
+  - {name: a, parents: [c]}
+  - {name: b, parents: [a]}
+  - {name: c, parents: [b]}
+`, "inherits from itself"},
+		{"menu with undefined permission", base + `
+menus:
+  - {name: docs, permission: docs.write}
+`, `requires undefined permission "docs.write"`},
+		{"nested menu with undefined feature", base + `
+menus:
+  - name: docs
+    permission: docs.read
+    children:
+      - {name: drafts, permission: docs.read, feature: drafts}
+`, `requires undefined feature "drafts"`},
+		{"feature percentage", base + `
+features:
+  - {name: drafts, percentage: 101}
+`, "percentage outside 0-100"},
+		{"duplicate policy", base + `
+policies:
+  - {name: docs-read, resource: docs, action: read, effect: allow}
+  - {name: docs-read, resource: docs, action: read, effect: deny}
+`, `seed policy "docs-read" is empty or defined twice`},
+		{"policy effect", base + `
+policies:
+  - {name: docs-read, resource: docs, action: read, effect: permit}
+`, "effect other than allow or deny"},
+		{"user with undefined role", base + `
+users:
+  - {username: demo, roles: [reader]}
+`, `has undefined role "reader"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withDefinition(t, tt.yaml)
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func withDefinition(t *testing.T, yaml string) {
+	t.Helper()
+	previous := definitionYAML
+	definitionYAML = []byte(yaml)
+	t.Cleanup(func() { definitionYAML = previous })
+}
+
+func TestApplyReconcile(t *testing.T) {
+	db := testdb.Open(t)
+	def, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run reports the work without doing it
+	changes, err := Apply(db, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasChange(changes, "create", "role", models.DefaultRoleName, "") {
+		t.Fatalf("dry run did not report creating the default role: %v", changes)
+	}
+	if count(t, db, &models.Role{}) != 0 {
+		t.Fatal("dry run created roles")
+	}
+
+	changes, err = Apply(db, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, db, &models.Role{}); got != int64(len(def.Roles)) {
+		t.Fatalf("%d roles after the first run, want %d", got, len(def.Roles))
+	}
+	if got := count(t, db, &models.Permission{}); got != int64(len(def.Permissions)) {
+		t.Fatalf("%d permissions after the first run, want %d", got, len(def.Permissions))
+	}
+	if got := count(t, db, &models.Policy{}); got != int64(len(def.Policies)) {
+		t.Fatalf("%d policies after the first run, want %d", got, len(def.Policies))
+	}
+	if !hasChange(changes, "grant", "role", "viewer", "roles.read") || !hasChange(changes, "link", "role", "viewer", "inherits user") {
+		t.Fatalf("first run did not grant and link the viewer role: %v", changes)
+	}
+
+	// Nothing is left to do on the next start
+	if changes, err = Apply(db, Options{}); err != nil || len(changes) != 0 {
+		t.Fatalf("second run: %v, %v, want no changes", changes, err)
+	}
+
+	// Administrator edits survive a normal run
+	viewer := find[models.Role](t, db, "viewer")
+	rolesRead := find[models.Permission](t, db, "roles.read")
+	usersRead := find[models.Permission](t, db, "users.read")
+	if err := db.Where("role_id = ? AND permission_id = ?", viewer.ID, rolesRead.ID).Delete(&models.RolePermission{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.RolePermission{}).Where("role_id = ? AND permission_id = ?", viewer.ID, usersRead.ID).
+		Update("effect", models.EffectDeny).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&viewer).Update("description", "Edited").Error; err != nil {
+		t.Fatal(err)
+	}
+	support := find[models.Role](t, db, "support")
+	if err := db.Delete(&support).Error; err != nil {
+		t.Fatal(err)
+	}
+	usersWrite := find[models.Policy](t, db, "users-write")
+	if err := db.Model(&usersWrite).Update("enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	custom := models.Role{Name: "custom"}
+	if err := db.Create(&custom).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.RolePermission{RoleID: custom.ID, PermissionID: rolesRead.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if changes, err = Apply(db, Options{}); err != nil || len(changes) != 0 {
+		t.Fatalf("run after edits: %v, %v, want no changes", changes, err)
+	}
+
+	// Force resets the defaults, leaving deleted and custom roles alone
+	changes, err = Apply(db, Options{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Change{
+		{Op: "grant", Kind: "role", Name: "viewer", Detail: "roles.read"},
+		{Op: "revoke", Kind: "role", Name: "viewer", Detail: "deny users.read"},
+		{Op: "grant", Kind: "role", Name: "viewer", Detail: "users.read"},
+		{Op: "update", Kind: "role", Name: "viewer"},
+		{Op: "update", Kind: "policy", Name: "users-write"},
+	} {
+		if !hasChange(changes, want.Op, want.Kind, want.Name, want.Detail) {
+			t.Errorf("forced run did not %s", want)
+		}
+	}
+	for _, change := range changes {
+		if change.Name == "support" || change.Name == "custom" {
+			t.Errorf("forced run changed %s", change)
+		}
+	}
+	if err := db.Unscoped().First(&support, "id = ?", support.ID).Error; err != nil || !support.DeletedAt.Valid {
+		t.Fatalf("deleted default role was restored: %v", err)
+	}
+
+	var effect string
+	if err := db.Model(&models.RolePermission{}).Where("role_id = ? AND permission_id = ?", viewer.ID, usersRead.ID).
+		Pluck("effect", &effect).Error; err != nil || effect != models.EffectAllow {
+		t.Fatalf("users.read effect on viewer = %q (%v), want allow", effect, err)
+	}
+	if changes, err = Apply(db, Options{Force: true}); err != nil || len(changes) != 0 {
+		t.Fatalf("second forced run: %v, %v, want no changes", changes, err)
+	}
+}
+
+func hasChange(changes []Change, op, kind, name, detail string) bool {
+	for _, c := range changes {
+		if c.Op == op && c.Kind == kind && c.Name == name && c.Detail == detail {
+			return true
+		}
+	}
+	return false
+}
+
+func count(t *testing.T, db *gorm.DB, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func find[T any](t *testing.T, db *gorm.DB, name string) T {
+	t.Helper()
+	var value T
+	if err := db.Where("name = ?", name).First(&value).Error; err != nil {
+		t.Fatalf("find %q: %v", name, err)
+	}
+	return value
+}
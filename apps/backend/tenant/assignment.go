@@ -0,0 +1,185 @@
+package tenant
+
+import (
+	"backend/config"
+	"backend/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// activeAssignment matches the user_roles rows in effect at a point in time;
+// it takes that time twice
+const activeAssignment = "(user_roles.starts_at IS NULL OR user_roles.starts_at <= ?) AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)"
+
+// ErrAssignmentConflict is returned when a role is granted for a period
+// apart from the user's current assignment of it, as a user holds each role
+// once per organization
+var ErrAssignmentConflict = errors.New("role is already assigned for a separate period")
+
+// ErrInvalidWindow is returned for assignments that would never be in effect
+var ErrInvalidWindow = errors.New("assignment must expire in the future and after it starts")
+
+// Assignment holds the terms roles are granted on: who granted them and why,
+// and optionally when they start and expire
+type Assignment struct {
+	AssignedBy uuid.UUID
+	StartsAt   *time.Time
+	ExpiresAt  *time.Time
+	Reason     string
+}
+
+// Validate checks that the assignment's window is not already over
+func (a Assignment) Validate(now time.Time) error {
+	if a.ExpiresAt == nil {
+		return nil
+	}
+	if !a.ExpiresAt.After(now) || (a.StartsAt != nil && !a.ExpiresAt.After(*a.StartsAt)) {
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+// AssignRoles makes the roles the user's only roles in the organization
+func AssignRoles(tx *gorm.DB, orgID, userID uuid.UUID, roles []models.Role, assignment Assignment) error {
+	if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&models.UserRole{}).Error; err != nil {
+		return err
+	}
+	return AddRoles(tx, orgID, userID, roles, assignment)
+}
+
+// AddRoles gives the user the roles in the organization in addition to the
+// ones already held. A role the user already holds keeps one assignment,
+// widened to cover both windows; it keeps its terms when it already did. An
+// assignment that has run out is replaced, and one whose window neither
+// overlaps nor adjoins the new one fails with ErrAssignmentConflict.
+func AddRoles(tx *gorm.DB, orgID, userID uuid.UUID, roles []models.Role, assignment Assignment) error {
+	now := time.Now()
+	for _, role := range roles {
+		var existing models.UserRole
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ? AND user_id = ? AND role_id = ?", orgID, userID, role.ID).
+			Take(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && existing.ExpiresAt != nil && !existing.ExpiresAt.After(now)):
+			// Another transaction may have created it since; the newer grant wins
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "role_id"}, {Name: "organization_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"assigned_by", "starts_at", "expires_at", "reason"}),
+			}).Create(&models.UserRole{
+				UserID:         userID,
+				RoleID:         role.ID,
+				OrganizationID: orgID,
+				AssignedBy:     assignment.AssignedBy,
+				StartsAt:       assignment.StartsAt,
+				ExpiresAt:      assignment.ExpiresAt,
+				Reason:         assignment.Reason,
+			}).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			startsAt, expiresAt, ok := widen(existing, assignment)
+			if !ok {
+				return ErrAssignmentConflict
+			}
+			if sameTime(startsAt, existing.StartsAt) && sameTime(expiresAt, existing.ExpiresAt) {
+				continue
+			}
+			if err := tx.Model(&models.UserRole{}).
+				Where("organization_id = ? AND user_id = ? AND role_id = ?", orgID, userID, role.ID).
+				Updates(map[string]interface{}{
+					"assigned_by": assignment.AssignedBy, "starts_at": startsAt, "expires_at": expiresAt, "reason": assignment.Reason,
+				}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// widen returns the window covering both the existing assignment and the
+// new one, where a nil start or expiry is unbounded. It fails when there
+// would be a gap between them.
+func widen(existing models.UserRole, assignment Assignment) (startsAt, expiresAt *time.Time, ok bool) {
+	if (existing.ExpiresAt != nil && assignment.StartsAt != nil && assignment.StartsAt.After(*existing.ExpiresAt)) ||
+		(assignment.ExpiresAt != nil && existing.StartsAt != nil && existing.StartsAt.After(*assignment.ExpiresAt)) {
+		return nil, nil, false
+	}
+	if existing.StartsAt != nil && assignment.StartsAt != nil {
+		startsAt = existing.StartsAt
+		if assignment.StartsAt.Before(*startsAt) {
+			startsAt = assignment.StartsAt
+		}
+	}
+	if existing.ExpiresAt != nil && assignment.ExpiresAt != nil {
+		expiresAt = existing.ExpiresAt
+		if assignment.ExpiresAt.After(*expiresAt) {
+			expiresAt = assignment.ExpiresAt
+		}
+	}
+	return startsAt, expiresAt, true
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// RemoveRole takes the role away from the user in the organization. It
+// reports whether the user held it.
+func RemoveRole(tx *gorm.DB, orgID, userID, roleID uuid.UUID) (bool, error) {
+	result := tx.Where("organization_id = ? AND user_id = ? AND role_id = ?", orgID, userID, roleID).Delete(&models.UserRole{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Assignments returns the user's role assignments in the organization,
+// including those not in effect yet, with their roles
+func Assignments(orgID, userID uuid.UUID) ([]models.UserRole, error) {
+	var assignments []models.UserRole
+	err := config.DB.Preload("Role").
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Order("created_at").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+// ExpiryRecorder is called with the assignments a sweep removed, within the
+// transaction that removes them
+type ExpiryRecorder func(tx *gorm.DB, expired []models.ExpiredRoleAssignment) error
+
+// SweepExpiredAssignments moves the role assignments that expired by now to
+// expired_role_assignments, passes them to record and returns how many were
+// removed. Running it from several instances at once removes each assignment
+// once.
+func SweepExpiredAssignments(ctx context.Context, now time.Time, record ExpiryRecorder) (int64, error) {
+	var expired []models.ExpiredRoleAssignment
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+			WITH expired AS (
+				DELETE FROM user_roles WHERE expires_at <= ?
+				RETURNING user_id, role_id, organization_id, assigned_by, created_at, starts_at, expires_at, reason
+			)
+			INSERT INTO expired_role_assignments
+				(user_id, role_id, organization_id, assigned_by, assigned_at, starts_at, expires_at, reason, removed_at)
+			SELECT user_id, role_id, organization_id, NULLIF(assigned_by, '00000000-0000-0000-0000-000000000000'::uuid),
+				created_at, starts_at, expires_at, reason, ?
+			FROM expired
+			RETURNING *`, now, now).Scan(&expired).Error
+		if err != nil {
+			return err
+		}
+		return record(tx, expired)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(expired)), nil
+}
@@ -0,0 +1,43 @@
+package tenant
+
+import (
+	"backend/models"
+	"testing"
+	"time"
+)
+
+func TestWiden(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		t := base.AddDate(0, 0, days)
+		return &t
+	}
+	tests := []struct {
+		name             string
+		existing         models.UserRole
+		assignment       Assignment
+		startsAt, expiry *time.Time
+		ok               bool
+	}{
+		{"permanent stays permanent", models.UserRole{}, Assignment{ExpiresAt: at(5)}, nil, nil, true},
+		{"permanent grant wins", models.UserRole{ExpiresAt: at(5)}, Assignment{}, nil, nil, true},
+		{"later expiry", models.UserRole{ExpiresAt: at(5)}, Assignment{ExpiresAt: at(9)}, nil, at(9), true},
+		{"earlier expiry keeps the existing one", models.UserRole{ExpiresAt: at(9)}, Assignment{ExpiresAt: at(5)}, nil, at(9), true},
+		{"earlier start", models.UserRole{StartsAt: at(3), ExpiresAt: at(9)}, Assignment{StartsAt: at(1), ExpiresAt: at(5)}, at(1), at(9), true},
+		{"unbounded start wins", models.UserRole{StartsAt: at(3)}, Assignment{ExpiresAt: at(5)}, nil, nil, true},
+		{"adjoining windows", models.UserRole{ExpiresAt: at(5)}, Assignment{StartsAt: at(5), ExpiresAt: at(9)}, nil, at(9), true},
+		{"gap after", models.UserRole{ExpiresAt: at(5)}, Assignment{StartsAt: at(6), ExpiresAt: at(9)}, nil, nil, false},
+		{"gap before", models.UserRole{StartsAt: at(6)}, Assignment{StartsAt: at(1), ExpiresAt: at(5)}, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startsAt, expiresAt, ok := widen(tt.existing, tt.assignment)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (!sameTime(startsAt, tt.startsAt) || !sameTime(expiresAt, tt.expiry)) {
+				t.Fatalf("window = %v-%v, want %v-%v", startsAt, expiresAt, tt.startsAt, tt.expiry)
+			}
+		})
+	}
+}
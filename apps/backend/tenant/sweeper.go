@@ -0,0 +1,34 @@
+package tenant
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartAssignmentSweeper removes expired role assignments every interval
+// until ctx is done, passing each batch to record
+func StartAssignmentSweeper(ctx context.Context, interval time.Duration, record ExpiryRecorder) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			removed, err := SweepExpiredAssignments(ctx, time.Now(), record)
+			switch {
+			case err != nil && ctx.Err() != nil:
+				return // cancelled by shutdown
+			case err != nil:
+				log.Printf("Failed to sweep expired role assignments: %v", err)
+			case removed > 0:
+				log.Printf("Removed %d expired role assignments", removed)
+			}
+		}
+	}()
+}
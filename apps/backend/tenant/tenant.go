@@ -0,0 +1,170 @@
+// Package tenant scopes users and their role assignments to organizations.
+// A user can be a member of several organizations and holds a separate set
+// of roles in each; requests act in one organization at a time, the one
+// carried by the access token.
+package tenant
+
+import (
+	"backend/config"
+	"backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoOrganization is returned for users who are not a member of any organization
+var ErrNoOrganization = errors.New("user is not a member of any organization")
+
+// IsMember reports whether the user belongs to the organization
+func IsMember(orgID, userID uuid.UUID) bool {
+	var count int64
+	config.DB.Model(&models.OrganizationMember{}).
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_members.organization_id = ? AND organization_members.user_id = ?", orgID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// ActiveOrganization picks the organization a session acts in: the
+// requested one when the user is a member, else the one the user last
+// worked in, else the first they joined
+func ActiveOrganization(user *models.User, requested uuid.UUID) (uuid.UUID, error) {
+	if requested != uuid.Nil && IsMember(requested, user.ID) {
+		return requested, nil
+	}
+	if user.ActiveOrganizationID != nil && IsMember(*user.ActiveOrganizationID, user.ID) {
+		return *user.ActiveOrganizationID, nil
+	}
+
+	var member models.OrganizationMember
+	err := config.DB.
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id AND organizations.deleted_at IS NULL").
+		Where("organization_members.user_id = ?", user.ID).
+		Order("organization_members.created_at").
+		First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, ErrNoOrganization
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return member.OrganizationID, nil
+}
+
+// Organizations returns the organizations the user belongs to
+func Organizations(userID uuid.UUID) ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := config.DB.
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userID).
+		Order("organizations.name").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// LoadRoles sets user.Roles to the roles the user currently holds in the
+// organization, with their permissions. Assignments that have not started
+// yet or have expired are left out.
+func LoadRoles(user *models.User, orgID uuid.UUID) error {
+	now := time.Now()
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND user_roles.organization_id = ?", user.ID, orgID).
+		Where(activeAssignment, now, now).
+		Find(&roles).Error; err != nil {
+		return err
+	}
+	user.Roles = roles
+	return nil
+}
+
+// LoadRolesForUsers applies LoadRoles to every user with one query per table
+func LoadRolesForUsers(users []models.User, orgID uuid.UUID) error {
+	if len(users) == 0 {
+		return nil
+	}
+	userIDs := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	now := time.Now()
+	var links []models.UserRole
+	if err := config.DB.Where("organization_id = ? AND user_id IN ?", orgID, userIDs).
+		Where(activeAssignment, now, now).
+		Find(&links).Error; err != nil {
+		return err
+	}
+	roleIDs := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		roleIDs = append(roleIDs, link.RoleID)
+	}
+
+	var roles []models.Role
+	if len(roleIDs) > 0 {
+		if err := config.DB.Preload("Permissions").Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+			return err
+		}
+	}
+	byID := make(map[uuid.UUID]models.Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	byUser := make(map[uuid.UUID][]models.Role, len(users))
+	for _, link := range links {
+		if role, ok := byID[link.RoleID]; ok {
+			byUser[link.UserID] = append(byUser[link.UserID], role)
+		}
+	}
+	for i := range users {
+		users[i].Roles = byUser[users[i].ID]
+	}
+	return nil
+}
+
+// Roles returns a query over the roles usable in the organization: those
+// shared by all organizations and those it defined itself
+func Roles(orgID uuid.UUID) *gorm.DB {
+	return config.DB.Model(&models.Role{}).Where("roles.organization_id IS NULL OR roles.organization_id = ?", orgID)
+}
+
+// Members returns a query over the users who belong to the organization
+func Members(orgID uuid.UUID) *gorm.DB {
+	return config.DB.Model(&models.User{}).
+		Joins("JOIN organization_members ON organization_members.user_id = users.id").
+		Where("organization_members.organization_id = ?", orgID)
+}
+
+// Holders returns a query over the members currently holding any of the
+// roles in the organization
+func Holders(orgID uuid.UUID, roleIDs []uuid.UUID) *gorm.DB {
+	now := time.Now()
+	holders := config.DB.Model(&models.UserRole{}).
+		Select("user_roles.user_id").
+		Where("user_roles.organization_id = ? AND user_roles.role_id IN ?", orgID, roleIDs).
+		Where(activeAssignment, now, now)
+	return Members(orgID).Where("users.id IN (?)", holders)
+}
+
+// AddMember makes the user a member of the organization. Existing members
+// are left as they are.
+func AddMember(tx *gorm.DB, orgID, userID uuid.UUID, invitedBy *uuid.UUID) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.OrganizationMember{
+		OrganizationID: orgID,
+		UserID:         userID,
+		InvitedBy:      invitedBy,
+	}).Error
+}
+
+// RemoveMember removes the user and the user's roles from the organization
+func RemoveMember(tx *gorm.DB, orgID, userID uuid.UUID) error {
+	if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&models.UserRole{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&models.OrganizationMember{}).Error
+}
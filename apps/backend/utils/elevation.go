@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"backend/rbac"
+	"backend/tenant"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrElevationNotPending is returned when deciding or cancelling a
+	// request that was already decided or cancelled
+	ErrElevationNotPending = errors.New("elevation request is no longer pending")
+	// ErrRoleAlreadyHeld is returned when the requester already has an
+	// assignment of the requested role that has not run out. An elevation
+	// must neither shorten nor take over its terms.
+	ErrRoleAlreadyHeld = errors.New("role is already assigned")
+)
+
+// RequestElevation stores a request by the user for the role in the
+// organization and notifies the members who can approve it
+func RequestElevation(user *models.User, orgID uuid.UUID, role *models.Role, duration time.Duration, justification string) (*models.ElevationRequest, error) {
+	request := models.ElevationRequest{
+		OrganizationID:  orgID,
+		UserID:          user.ID,
+		RoleID:          role.ID,
+		DurationSeconds: int64(duration / time.Second),
+		Justification:   justification,
+		Status:          models.ElevationPending,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return err
+		}
+		return recordElevationEvent(tx, request.ID, user.ID, "requested", justification)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Elevation %s: %s requested role %s for %s", request.ID, user.Username, role.Name, duration)
+
+	link := config.FrontendURL() + "/elevations/" + request.ID.String()
+	for _, approver := range ElevationApprovers(orgID) {
+		if approver.ID == user.ID {
+			continue
+		}
+		mailer.SendAsync(mailer.ElevationRequestedMessage(approver.Email, user.Username, role.Name, duration.String(), justification, link))
+	}
+	return &request, nil
+}
+
+// DecideElevation approves or rejects a pending request. Approving grants
+// the requested role until the requested duration has passed from now.
+// record is called with the decided request inside the same transaction.
+func DecideElevation(requestID uuid.UUID, approver *models.User, approve bool, note string, record func(tx *gorm.DB, request *models.ElevationRequest) error) (*models.ElevationRequest, error) {
+	var request models.ElevationRequest
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", requestID).First(&request).Error; err != nil {
+			return err
+		}
+		if request.Status != models.ElevationPending {
+			return ErrElevationNotPending
+		}
+
+		now := time.Now()
+		request.DecidedBy = &approver.ID
+		request.DecidedAt = &now
+		request.DecisionNote = note
+		request.Status = models.ElevationRejected
+		if approve {
+			// Any current or upcoming assignment is left as it is
+			var existing []models.UserRole
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ? AND role_id = ? AND organization_id = ?", request.UserID, request.RoleID, request.OrganizationID).
+				Where("expires_at IS NULL OR expires_at > ?", now).
+				Find(&existing).Error; err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				return ErrRoleAlreadyHeld
+			}
+
+			expiresAt := now.Add(time.Duration(request.DurationSeconds) * time.Second)
+			err := tenant.AddRoles(tx, request.OrganizationID, request.UserID, []models.Role{{ID: request.RoleID}}, tenant.Assignment{
+				AssignedBy: approver.ID,
+				ExpiresAt:  &expiresAt,
+				Reason:     fmt.Sprintf("Elevation %s: %s", request.ID, request.Justification),
+			})
+			if err != nil {
+				return err
+			}
+			request.Status = models.ElevationApproved
+			request.ExpiresAt = &expiresAt
+		}
+
+		if err := tx.Save(&request).Error; err != nil {
+			return err
+		}
+		if err := recordElevationEvent(tx, request.ID, approver.ID, request.Status, note); err != nil {
+			return err
+		}
+		return record(tx, &request)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Elevation %s: %s by %s", request.ID, request.Status, approver.Username)
+
+	var requester models.User
+	var role models.Role
+	if config.DB.Where("id = ?", request.UserID).First(&requester).Error == nil &&
+		config.DB.Where("id = ?", request.RoleID).First(&role).Error == nil {
+		mailer.SendAsync(mailer.ElevationDecidedMessage(requester.Email, requester.Username, role.Name, request.Status, note))
+	}
+	return &request, nil
+}
+
+// CancelElevation withdraws a pending request on behalf of the user who made it
+func CancelElevation(requestID uuid.UUID, user *models.User) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ElevationRequest{}).
+			Where("id = ? AND user_id = ? AND status = ?", requestID, user.ID, models.ElevationPending).
+			Update("status", models.ElevationCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrElevationNotPending
+		}
+		return recordElevationEvent(tx, requestID, user.ID, models.ElevationCancelled, "")
+	})
+}
+
+// ElevationApprovers returns the active members of the organization who
+// hold the permission needed to approve elevation requests. Only holders of
+// a role that grants it are loaded; their deny grants are checked after.
+func ElevationApprovers(orgID uuid.UUID) []models.User {
+	resource, action := config.Elevation().Approver()
+	roleIDs, err := rbac.Granting(resource, action)
+	if err != nil || len(roleIDs) == 0 {
+		return nil
+	}
+
+	var candidates []models.User
+	if err := tenant.Holders(orgID, roleIDs).Where("users.is_active = ?", true).Find(&candidates).Error; err != nil {
+		return nil
+	}
+	if err := tenant.LoadRolesForUsers(candidates, orgID); err != nil {
+		return nil
+	}
+
+	var approvers []models.User
+	for i := range candidates {
+		permissions, err := rbac.ForUser(&candidates[i])
+		if err == nil && permissions.Allows(resource, action) {
+			approvers = append(approvers, candidates[i])
+		}
+	}
+	return approvers
+}
+
+func recordElevationEvent(tx *gorm.DB, requestID, actorID uuid.UUID, action, note string) error {
+	return tx.Create(&models.ElevationEvent{RequestID: requestID, ActorID: actorID, Action: action, Note: note}).Error
+}
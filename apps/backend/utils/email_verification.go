@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"errors"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	emailVerificationLifetime = 48 * time.Hour
+	// verificationResendInterval is the minimum time between two verification emails
+	verificationResendInterval = time.Minute
+	// verificationHourlyLimit caps verification emails per user per hour
+	verificationHourlyLimit = 5
+)
+
+var (
+	// ErrInvalidVerificationToken is returned for unknown, used, expired or outdated tokens
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	// ErrEmailNotVerified is returned when the block policy refuses an
+	// unverified account a session
+	ErrEmailNotVerified = errors.New("email address not verified")
+)
+
+// EmailVerificationBlocks reports whether the block policy refuses the user
+// a session
+func EmailVerificationBlocks(user *models.User) bool {
+	return user.EmailVerifiedAt == nil && config.EmailVerificationPolicy() == config.EmailVerificationBlock
+}
+
+// EmailVerificationRestricts reports whether the restrict policy limits the
+// user to the default role
+func EmailVerificationRestricts(user *models.User) bool {
+	return user.EmailVerifiedAt == nil && config.EmailVerificationPolicy() == config.EmailVerificationRestrict
+}
+
+// SendVerificationEmail issues a verification token for the user's current
+// email address and mails it. Earlier tokens stay valid until they expire.
+func SendVerificationEmail(user *models.User) error {
+	tokenString, selector, verifierHash, err := newSplitToken()
+	if err != nil {
+		return err
+	}
+
+	if err := config.DB.Create(&models.EmailVerificationToken{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Selector:     selector,
+		VerifierHash: verifierHash,
+		ExpiresAt:    time.Now().Add(emailVerificationLifetime),
+	}).Error; err != nil {
+		return err
+	}
+
+	link := config.FrontendURL() + "/verify-email?token=" + url.QueryEscape(tokenString)
+	mailer.SendAsync(mailer.EmailVerificationMessage(user.Email, user.Username, link))
+	return nil
+}
+
+// VerificationResendWait returns how long the user has to wait before another
+// verification email may be sent, or zero when one may be sent now
+func VerificationResendWait(user *models.User) time.Duration {
+	var recent []models.EmailVerificationToken
+	config.DB.Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Order("created_at ASC").
+		Find(&recent)
+
+	if len(recent) == 0 {
+		return 0
+	}
+
+	if len(recent) >= verificationHourlyLimit {
+		return time.Until(recent[0].CreatedAt.Add(time.Hour))
+	}
+
+	if wait := time.Until(recent[len(recent)-1].CreatedAt.Add(verificationResendInterval)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// ConsumeEmailVerificationToken validates a verification token, marks it used
+// and marks the user's email as verified within tx
+func ConsumeEmailVerificationToken(tx *gorm.DB, tokenString string) (*models.EmailVerificationToken, error) {
+	selector, verifier, ok := parseSplitToken(tokenString)
+	if !ok {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var token models.EmailVerificationToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("selector = ?", selector).
+		First(&token).Error; err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if !verifierMatches(verifier, token.VerifierHash) ||
+		token.UsedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// The address may have changed since the email was sent
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND email = ?", token.UserID, token.Email).
+		Update("email_verified_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
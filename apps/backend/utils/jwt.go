@@ -3,20 +3,36 @@ package utils
 import (
 	"backend/config"
 	"backend/models"
-	"crypto/rand"
-	"encoding/hex"
+	"backend/tenant"
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, revoked or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already-rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+const (
+	refreshTokenLifetime = 7 * 24 * time.Hour
+	accessTokenAudience  = "access"
 )
 
 type Claims struct {
 	UserID   uuid.UUID `json:"user_id"`
 	Username string    `json:"username"`
 	Email    string    `json:"email"`
+	// OrganizationID is the organization the token acts in. Tokens issued
+	// before organizations existed have none.
+	OrganizationID uuid.UUID `json:"org_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -26,8 +42,9 @@ type TokenPair struct {
 	ExpiresAt    int64  `json:"expires_at"`
 }
 
-// GenerateTokenPair creates both access and refresh tokens
-func GenerateTokenPair(user *models.User) (*TokenPair, error) {
+// GenerateTokenPair creates both access and refresh tokens acting in the
+// user's active organization, storing the refresh token within tx
+func GenerateTokenPair(tx *gorm.DB, user *models.User) (*TokenPair, error) {
 	// Generate access token (short-lived: 15 minutes)
 	accessToken, accessExpiresAt, err := GenerateAccessToken(user)
 	if err != nil {
@@ -35,7 +52,7 @@ func GenerateTokenPair(user *models.User) (*TokenPair, error) {
 	}
 
 	// Generate refresh token (long-lived: 7 days)
-	refreshToken, err := GenerateRefreshToken(user.ID)
+	refreshToken, _, err := createRefreshToken(tx, user.ID, user.ActiveOrganizationID, uuid.Nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -47,23 +64,30 @@ func GenerateTokenPair(user *models.User) (*TokenPair, error) {
 	}, nil
 }
 
-// GenerateAccessToken creates a short-lived JWT access token
+// GenerateAccessToken creates a short-lived JWT access token acting in the
+// user's active organization
 func GenerateAccessToken(user *models.User) (string, time.Time, error) {
 	expirationTime := time.Now().Add(15 * time.Minute) // 15 minutes
 
+	var orgID uuid.UUID
+	if user.ActiveOrganizationID != nil {
+		orgID = *user.ActiveOrganizationID
+	}
+
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		UserID:         user.ID,
+		Username:       user.Username,
+		Email:          user.Email,
+		OrganizationID: orgID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   fmt.Sprintf("%d", user.ID),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{accessTokenAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(getJWTSecret()))
+	tokenString, err := signToken(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -71,40 +95,47 @@ func GenerateAccessToken(user *models.User) (string, time.Time, error) {
 	return tokenString, expirationTime, nil
 }
 
-// GenerateRefreshToken creates a long-lived refresh token and stores it in database
+// GenerateRefreshToken creates a long-lived refresh token and stores it in database.
+// The token starts a new token family.
 func GenerateRefreshToken(userID uuid.UUID) (string, error) {
-	// Generate random token
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+	tokenString, _, err := createRefreshToken(config.DB, userID, nil, uuid.Nil, nil)
+	return tokenString, err
+}
+
+// createRefreshToken stores a new refresh token in the given family. A nil
+// familyID starts a new family rooted at the created token. Access tokens
+// issued from it act in orgID.
+func createRefreshToken(tx *gorm.DB, userID uuid.UUID, orgID *uuid.UUID, familyID uuid.UUID, parentID *uuid.UUID) (string, *models.RefreshToken, error) {
+	// Generate random token; only its selector and verifier hash are persisted
+	tokenString, selector, verifierHash, err := newSplitToken()
+	if err != nil {
+		return "", nil, err
 	}
-	tokenString := hex.EncodeToString(bytes)
 
 	// Store in database
 	refreshToken := models.RefreshToken{
-		Token:     tokenString,
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour), // 7 days
-		IsActive:  true,
+		Selector:       selector,
+		VerifierHash:   verifierHash,
+		UserID:         userID,
+		OrganizationID: orgID,
+		FamilyID:       familyID,
+		ParentID:       parentID,
+		ExpiresAt:      time.Now().Add(refreshTokenLifetime),
+		IsActive:       true,
 	}
 
-	if err := config.DB.Create(&refreshToken).Error; err != nil {
-		return "", err
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return "", nil, err
 	}
 
-	return tokenString, nil
+	return tokenString, &refreshToken, nil
 }
 
 // ValidateAccessToken validates and parses an access token
 func ValidateAccessToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(getJWTSecret()), nil
-	})
+	token, err := parseToken(tokenString, claims, accessTokenAudience)
 
 	if err != nil {
 		return nil, err
@@ -119,65 +150,192 @@ func ValidateAccessToken(tokenString string) (*Claims, error) {
 
 // ValidateRefreshToken validates a refresh token from database
 func ValidateRefreshToken(tokenString string) (*models.RefreshToken, error) {
-	var refreshToken models.RefreshToken
+	refreshToken, err := findRefreshToken(config.DB.Preload("User"), tokenString)
+	if err != nil {
+		return nil, err
+	}
 
-	err := config.DB.Where("token = ? AND is_active = ? AND expires_at > ?",
-		tokenString, true, time.Now()).
-		Preload("User").
-		First(&refreshToken).Error
+	if !refreshToken.IsActive || !refreshToken.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("invalid or expired refresh token")
+	return refreshToken, nil
+}
+
+// findRefreshToken looks up a refresh token by its selector and checks the
+// verifier against the stored hash. It does not check whether the token is
+// still active.
+func findRefreshToken(tx *gorm.DB, tokenString string) (*models.RefreshToken, error) {
+	selector, verifier, ok := parseSplitToken(tokenString)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var refreshToken models.RefreshToken
+	if err := tx.Where("selector = ?", selector).First(&refreshToken).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if !verifierMatches(verifier, refreshToken.VerifierHash) {
+		return nil, ErrInvalidRefreshToken
 	}
 
 	return &refreshToken, nil
 }
 
-// RefreshAccessToken creates a new access token using a valid refresh token
-func RefreshAccessToken(refreshTokenString string) (*TokenPair, error) {
-	// Validate refresh token
-	refreshToken, err := ValidateRefreshToken(refreshTokenString)
-	if err != nil {
-		return nil, err
-	}
+// RefreshAccessToken exchanges a valid refresh token for a new token pair.
+// The presented refresh token is rotated: it is deactivated and replaced by a
+// new token in the same family. Presenting a token that has already been
+// rotated revokes the whole family and records the reuse.
+func RefreshAccessToken(refreshTokenString, ip, userAgent string) (*TokenPair, error) {
+	var (
+		current   models.RefreshToken
+		newToken  string
+		accessJWT string
+		expiresAt time.Time
+	)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so concurrent refreshes with the same token cannot both rotate it
+		found, err := findRefreshToken(tx.Clauses(clause.Locking{Strength: "UPDATE"}), refreshTokenString)
+		if err != nil {
+			return err
+		}
+		current = *found
+
+		if current.ReplacedByID != nil {
+			return ErrRefreshTokenReused
+		}
+
+		if !current.IsActive || !current.ExpiresAt.After(time.Now()) {
+			return ErrInvalidRefreshToken
+		}
 
-	// Generate new access token
-	accessToken, accessExpiresAt, err := GenerateAccessToken(&refreshToken.User)
+		var user models.User
+		if err := tx.Where("id = ? AND is_active = ?", current.UserID, true).First(&user).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+		if EmailVerificationBlocks(&user) {
+			return ErrEmailNotVerified
+		}
+
+		// Stay in the session's organization unless the user has left it
+		var requested uuid.UUID
+		if current.OrganizationID != nil {
+			requested = *current.OrganizationID
+		}
+		orgID, err := tenant.ActiveOrganization(&user, requested)
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+		user.ActiveOrganizationID = &orgID
+
+		tokenString, next, err := createRefreshToken(tx, current.UserID, &orgID, tokenFamily(&current), &current.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&current).Updates(map[string]interface{}{
+			"is_active":      false,
+			"replaced_by_id": next.ID,
+			"revoked_at":     time.Now(),
+			"revoked_reason": "rotated",
+		}).Error; err != nil {
+			return err
+		}
+
+		accessJWT, expiresAt, err = GenerateAccessToken(&user)
+		if err != nil {
+			return err
+		}
+		newToken = tokenString
+
+		return nil
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := revokeRefreshTokenFamily(&current, ip, userAgent); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, ErrRefreshTokenReused
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshTokenString, // Keep the same refresh token
-		ExpiresAt:    accessExpiresAt.Unix(),
+		AccessToken:  accessJWT,
+		RefreshToken: newToken,
+		ExpiresAt:    expiresAt.Unix(),
 	}, nil
 }
 
+// revokeRefreshTokenFamily deactivates every token in the family of a reused
+// token and records the reuse for administrators
+func revokeRefreshTokenFamily(reused *models.RefreshToken, ip, userAgent string) error {
+	familyID := tokenFamily(reused)
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("(family_id = ? OR id = ?) AND is_active = ?", familyID, familyID, true).
+			Updates(map[string]interface{}{
+				"is_active":      false,
+				"revoked_at":     time.Now(),
+				"revoked_reason": "reuse_detected",
+			}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RefreshTokenReuse{
+			UserID:    reused.UserID,
+			FamilyID:  familyID,
+			TokenID:   reused.ID,
+			IP:        ip,
+			UserAgent: userAgent,
+		}).Error
+	})
+}
+
+// tokenFamily returns the family of a refresh token. Tokens issued before
+// rotation was introduced have no family and form a family of their own.
+func tokenFamily(token *models.RefreshToken) uuid.UUID {
+	if token.FamilyID == uuid.Nil {
+		return token.ID
+	}
+	return token.FamilyID
+}
+
 // RevokeRefreshToken marks a refresh token as inactive
-func RevokeRefreshToken(tokenString string) error {
-	return config.DB.Model(&models.RefreshToken{}).
-		Where("token = ?", tokenString).
-		Update("is_active", false).Error
+func RevokeRefreshToken(tx *gorm.DB, tokenString string) error {
+	refreshToken, err := findRefreshToken(tx, tokenString)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND is_active = ?", refreshToken.ID, true).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     time.Now(),
+			"revoked_reason": "logout",
+		}).Error
 }
 
 // RevokeAllUserRefreshTokens marks all user's refresh tokens as inactive
-func RevokeAllUserRefreshTokens(userID uuid.UUID) error {
-	return config.DB.Model(&models.RefreshToken{}).
-		Where("user_id = ?", userID).
-		Update("is_active", false).Error
+func RevokeAllUserRefreshTokens(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     time.Now(),
+			"revoked_reason": "logout_all",
+		}).Error
 }
 
-// CleanupExpiredTokens removes expired refresh tokens from database
+// CleanupExpiredTokens removes expired refresh tokens from database.
+// Revoked tokens are kept until they expire so that reuse of a rotated
+// token can still be detected.
 func CleanupExpiredTokens() error {
-	return config.DB.Where("expires_at < ? OR is_active = ?", time.Now(), false).
+	return config.DB.Where("expires_at < ?", time.Now()).
 		Delete(&models.RefreshToken{}).Error
 }
-
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "your-fallback-secret-key"
-	}
-	return secret
-}
@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"backend/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a key used to sign or verify JWTs, identified by its kid
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer // nil for verification-only keys
+	PublicKey  crypto.PublicKey
+}
+
+// JWK is the JSON Web Key representation of a public verification key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+var (
+	activeSigningKey *SigningKey
+	verificationKeys = map[string]*SigningKey{}
+	tokenHashKey     []byte
+)
+
+// InitKeys loads the JWT signing keys and the token hash key. Keys are read
+// from JWT_KEYS_DIR, one PEM file per key named "<kid>.pem". Private keys
+// (RSA or Ed25519) can sign and verify; public keys only verify, which lets
+// a retired key keep validating tokens until they expire. JWT_ACTIVE_KEY_ID
+// selects the signing key when the directory holds more than one private key.
+// Outside development a missing key is an error; in development an ephemeral
+// key is generated instead.
+func InitKeys() error {
+	keys, err := loadKeysFromDir(os.Getenv("JWT_KEYS_DIR"))
+	if err != nil {
+		return err
+	}
+
+	active, err := selectActiveKey(keys, os.Getenv("JWT_ACTIVE_KEY_ID"))
+	if err != nil {
+		return err
+	}
+
+	if active == nil {
+		if !config.IsDevelopment() {
+			return errors.New("no JWT signing key configured: set JWT_KEYS_DIR")
+		}
+		active, err = generateEphemeralKey()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, active)
+		log.Println("⚠️  No JWT signing key configured, using an ephemeral development key")
+	}
+
+	hashKey := os.Getenv("TOKEN_HASH_KEY")
+	if hashKey == "" {
+		if !config.IsDevelopment() {
+			return errors.New("no token hash key configured: set TOKEN_HASH_KEY")
+		}
+		hashKey = "development-token-hash-key"
+		log.Println("⚠️  TOKEN_HASH_KEY not set, using a fixed development key")
+	}
+
+	verificationKeys = map[string]*SigningKey{}
+	for _, key := range keys {
+		verificationKeys[key.ID] = key
+	}
+	activeSigningKey = active
+	tokenHashKey = []byte(hashKey)
+
+	log.Printf("✅ JWT keys loaded (active kid: %s, %d verification keys)", active.ID, len(verificationKeys))
+	return nil
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set
+func JWKS() map[string][]JWK {
+	ids := make([]string, 0, len(verificationKeys))
+	for id := range verificationKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]JWK, 0, len(ids))
+	for _, id := range ids {
+		key := verificationKeys[id]
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		keys = append(keys, jwk)
+	}
+
+	return map[string][]JWK{"keys": keys}
+}
+
+// signToken signs claims with the active key and sets the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	if activeSigningKey == nil {
+		return "", errors.New("JWT keys not initialized")
+	}
+
+	token := jwt.NewWithClaims(activeSigningKey.Method, claims)
+	token.Header["kid"] = activeSigningKey.ID
+	return token.SignedString(activeSigningKey.PrivateKey)
+}
+
+// parseToken verifies a token against the key named by its kid header
+func parseToken(tokenString string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}), jwt.WithAudience(audience))
+}
+
+// SignCheckpoint signs an audit chain checkpoint with the active key. It
+// returns the kid and the base64url signature.
+func SignCheckpoint(message []byte) (string, string, error) {
+	if activeSigningKey == nil {
+		return "", "", errors.New("JWT keys not initialized")
+	}
+
+	signature, err := activeSigningKey.Method.Sign(string(message), activeSigningKey.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	return activeSigningKey.ID, base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyCheckpoint checks a checkpoint signature against the key named kid,
+// which may be a retired verification-only key
+func VerifyCheckpoint(kid string, message []byte, signature string) error {
+	key, ok := verificationKeys[kid]
+	if !ok {
+		return fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	return key.Method.Verify(string(message), decoded, key.PublicKey)
+}
+
+func loadKeysFromDir(dir string) ([]*SigningKey, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func parseKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, PrivateKey: key, PublicKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: key, PublicKey: key.Public()}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, PublicKey: key}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PublicKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+func selectActiveKey(keys []*SigningKey, activeID string) (*SigningKey, error) {
+	var signers []*SigningKey
+	for _, key := range keys {
+		if key.PrivateKey != nil {
+			signers = append(signers, key)
+		}
+	}
+
+	if activeID != "" {
+		for _, key := range signers {
+			if key.ID == activeID {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("JWT_ACTIVE_KEY_ID %q does not match any private key", activeID)
+	}
+
+	switch len(signers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return signers[0], nil
+	default:
+		return nil, errors.New("several private JWT keys found: set JWT_ACTIVE_KEY_ID")
+	}
+}
+
+func generateEphemeralKey() (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: "dev-" + kid, Method: jwt.SigningMethodEdDSA, PrivateKey: private, PublicKey: public}, nil
+}
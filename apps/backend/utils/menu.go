@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"backend/config"
 	"backend/models"
+	"backend/rbac"
+	"log"
+
+	"github.com/google/uuid"
 )
 
 // MenuAccess represents menu access configuration
@@ -11,111 +16,53 @@ type MenuAccess struct {
 	Icon       string       `json:"icon"`
 	Path       string       `json:"path"`
 	Permission string       `json:"permission"`
+	Feature    string       `json:"-"`
 	Children   []MenuAccess `json:"children,omitempty"`
 	Accessible bool         `json:"accessible"`
 }
 
-// GetUserMenuAccess returns accessible menu items based on user permissions
-func GetUserMenuAccess(user *models.User) []MenuAccess {
-	// Define all menu items with their required permissions
-	allMenus := []MenuAccess{
-		{
-			Name:       "dashboard",
-			Label:      "Dashboard",
-			Icon:       "dashboard",
-			Path:       "/dashboard",
-			Permission: "menu.dashboard",
-		},
-		{
-			Name:       "admin-panel",
-			Label:      "Admin Panel",
-			Icon:       "admin_panel_settings",
-			Path:       "/admin",
-			Permission: "menu.admin-panel",
-		},
-		{
-			Name:       "analytics",
-			Label:      "Analytics",
-			Icon:       "analytics",
-			Path:       "/analytics",
-			Permission: "menu.analytics",
-		},
-		{
-			Name:       "reports",
-			Label:      "Reports",
-			Icon:       "report",
-			Path:       "/reports",
-			Permission: "menu.reports",
-		},
-		{
-			Name:       "admin",
-			Label:      "Administration",
-			Icon:       "admin_panel_settings",
-			Path:       "/admin",
-			Permission: "menu.admin",
-			Children: []MenuAccess{
-				{
-					Name:       "users",
-					Label:      "User Management",
-					Icon:       "people",
-					Path:       "/admin/users",
-					Permission: "menu.users",
-				},
-				{
-					Name:       "roles",
-					Label:      "Role Management",
-					Icon:       "security",
-					Path:       "/admin/roles",
-					Permission: "menu.roles",
-				},
-				{
-					Name:       "audit",
-					Label:      "Audit Logs",
-					Icon:       "history",
-					Path:       "/admin/audit",
-					Permission: "menu.audit",
-				},
-			},
-		},
-		{
-			Name:       "billing",
-			Label:      "Billing",
-			Icon:       "receipt",
-			Path:       "/billing",
-			Permission: "menu.billing",
-		},
-		{
-			Name:       "support",
-			Label:      "Support",
-			Icon:       "support_agent",
-			Path:       "/support",
-			Permission: "menu.support",
-		},
-		{
-			Name:       "settings",
-			Label:      "Settings",
-			Icon:       "settings",
-			Path:       "/settings",
-			Permission: "menu.settings",
-		},
+// GetUserMenuAccess returns the menus the user may access, nested and in
+// order. features holds the feature flags that are on for the user.
+func GetUserMenuAccess(user *models.User, features map[string]bool) ([]MenuAccess, error) {
+	var menus []models.Menu
+	if err := config.DB.Order("sort_order, name").Find(&menus).Error; err != nil {
+		return nil, err
 	}
+	return filterMenusByPermissions(menuTree(menus, nil), effectivePermissions(user), features), nil
+}
 
-	// Filter menus based on user permissions
-	return filterMenusByPermissions(allMenus, user)
+// menuTree builds the entries nested under parentID
+func menuTree(menus []models.Menu, parentID *uuid.UUID) []MenuAccess {
+	var entries []MenuAccess
+	for _, menu := range menus {
+		if (parentID == nil) != (menu.ParentID == nil) || (parentID != nil && *parentID != *menu.ParentID) {
+			continue
+		}
+		entries = append(entries, MenuAccess{
+			Name:       menu.Name,
+			Label:      menu.Label,
+			Icon:       menu.Icon,
+			Path:       menu.Path,
+			Permission: menu.Permission,
+			Feature:    menu.Feature,
+			Children:   menuTree(menus, &menu.ID),
+		})
+	}
+	return entries
 }
 
 // filterMenusByPermissions recursively filters menu items based on user permissions
-func filterMenusByPermissions(menus []MenuAccess, user *models.User) []MenuAccess {
+func filterMenusByPermissions(menus []MenuAccess, permissions *rbac.PermissionSet, features map[string]bool) []MenuAccess {
 	var accessibleMenus []MenuAccess
 
 	for _, menu := range menus {
-		// Check if user has permission for this menu
-		if hasMenuPermission(user, menu.Permission) {
+		// Check if user has permission for this menu and its feature
+		if permissions.AllowsName(menu.Permission) && (menu.Feature == "" || features[menu.Feature]) {
 			menu.Accessible = true
 
 			// Filter children if they exist
 			if len(menu.Children) > 0 {
-				menu.Children = filterMenusByPermissions(menu.Children, user)
+				menu.Children = filterMenusByPermissions(menu.Children, permissions, features)
 			}
 
 			accessibleMenus = append(accessibleMenus, menu)
@@ -125,52 +72,13 @@ func filterMenusByPermissions(menus []MenuAccess, user *models.User) []MenuAcces
 	return accessibleMenus
 }
 
-// hasMenuPermission checks if user has specific menu permission
-func hasMenuPermission(user *models.User, permission string) bool {
-	for _, role := range user.Roles {
-		for _, perm := range role.Permissions {
-			if perm.Name == permission {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-// GetUserFeatureAccess returns accessible features based on user permissions
-func GetUserFeatureAccess(user *models.User) map[string]bool {
-	features := map[string]bool{
-		"export":      hasMenuPermission(user, "feature.export"),
-		"import":      hasMenuPermission(user, "feature.import"),
-		"backup":      hasMenuPermission(user, "feature.backup"),
-		"maintenance": hasMenuPermission(user, "feature.maintenance"),
-	}
-
-	return features
-}
-
-// RoleMenuMap returns predefined menu access for each role (for documentation)
-func RoleMenuMap() map[string][]string {
-	return map[string][]string{
-		"admin": {
-			"menu.dashboard", "menu.analytics", "menu.reports", "menu.admin",
-			"menu.users", "menu.roles", "menu.audit", "menu.billing",
-			"menu.support", "menu.settings",
-		},
-		"manager": {
-			"menu.dashboard", "menu.analytics", "menu.reports", "menu.billing",
-		},
-		"editor": {
-			"menu.dashboard", "menu.users", "menu.support",
-		},
-		"viewer": {
-			"menu.dashboard", "menu.analytics", "menu.reports",
-		},
-		"support": {
-			"menu.dashboard", "menu.support", "menu.users",
-		},
-		"user": {
-			"menu.dashboard",
-		},
+// effectivePermissions resolves the user's permissions including inherited
+// ones. On failure nothing is accessible.
+func effectivePermissions(user *models.User) *rbac.PermissionSet {
+	permissions, err := rbac.ForUser(user)
+	if err != nil {
+		log.Printf("Failed to resolve permissions for user %s: %v", user.ID, err)
+		return &rbac.PermissionSet{}
 	}
+	return permissions
 }
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/rbac"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MFAPurposeVerify is the purpose of challenges issued to users with MFA enabled
+	MFAPurposeVerify = "verify"
+
+	mfaChallengeAudience = "mfa-challenge"
+	mfaChallengeLifetime = 5 * time.Minute
+	recoveryCodeCount    = 10
+)
+
+// MFAChallengeClaims are carried by the short-lived token returned by a
+// successful password check when a second factor is still required
+type MFAChallengeClaims struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Purpose string    `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateMFAChallengeToken creates a short-lived token proving the password step succeeded
+func GenerateMFAChallengeToken(user *models.User, purpose string) (string, time.Time, error) {
+	expirationTime := time.Now().Add(mfaChallengeLifetime)
+
+	claims := &MFAChallengeClaims{
+		UserID:  user.ID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{mfaChallengeAudience},
+		},
+	}
+
+	tokenString, err := signToken(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expirationTime, nil
+}
+
+// ValidateMFAChallengeToken validates a challenge token issued for the given purpose
+func ValidateMFAChallengeToken(tokenString, purpose string) (*MFAChallengeClaims, error) {
+	claims := &MFAChallengeClaims{}
+
+	token, err := parseToken(tokenString, claims, mfaChallengeAudience)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// UserRequiresMFA reports whether any of the user's roles, including
+// inherited ones, requires MFA. The user's roles must be loaded.
+func UserRequiresMFA(user *models.User) bool {
+	if set, err := rbac.ForUser(user); err == nil {
+		return set.RequiresMFA()
+	}
+
+	// Fall back to the directly assigned roles
+	for _, role := range user.Roles {
+		if role.RequireMFA {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptMFASecret encrypts a TOTP secret for storage
+func EncryptMFASecret(secret string) (string, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptMFASecret reverses EncryptMFASecret
+func DecryptMFASecret(encrypted string) (string, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted secret")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func mfaCipher() (cipher.AEAD, error) {
+	key := os.Getenv("MFA_ENCRYPTION_KEY")
+	if key == "" {
+		key = string(getTokenHashKey())
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes with a fresh set.
+// The plaintext codes are returned once and only their hashes are stored.
+func GenerateRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codeHash, err := hashVerifier(normalizeRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tx.Create(&models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: codeHash,
+		}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code and reports whether it was valid
+func UseRecoveryCode(userID uuid.UUID, code string) bool {
+	codeHash, err := hashVerifier(normalizeRecoveryCode(code))
+	if err != nil {
+		return false
+	}
+	result := config.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(strings.ReplaceAll(code, "-", ""), " ", "")
+}
+
+// MFAIssuer returns the issuer name shown in authenticator apps
+func MFAIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Monorepo"
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"backend/config"
+	"backend/mailer"
+	"backend/models"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const organizationInvitationLifetime = 7 * 24 * time.Hour
+
+// ErrInvalidInvitation is returned for unknown, accepted or expired
+// invitations and for invitations addressed to someone else
+var ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+// SendOrganizationInvitation stores an invitation to the organization and
+// emails it. Earlier invitations to the same address stay valid until they expire.
+func SendOrganizationInvitation(org *models.Organization, email string, role *models.Role, inviter *models.User) (*models.OrganizationInvitation, error) {
+	tokenString, selector, verifierHash, err := newSplitToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := models.OrganizationInvitation{
+		OrganizationID: org.ID,
+		Email:          strings.ToLower(email),
+		RoleID:         role.ID,
+		Selector:       selector,
+		VerifierHash:   verifierHash,
+		InvitedBy:      inviter.ID,
+		ExpiresAt:      time.Now().Add(organizationInvitationLifetime),
+	}
+	if err := config.DB.Create(&invitation).Error; err != nil {
+		return nil, err
+	}
+
+	link := config.FrontendURL() + "/accept-invitation?token=" + url.QueryEscape(tokenString)
+	mailer.SendAsync(mailer.OrganizationInvitationMessage(email, org.Name, inviter.Username, link))
+	return &invitation, nil
+}
+
+// ConsumeOrganizationInvitation validates an invitation for the given email
+// address and marks it accepted within tx
+func ConsumeOrganizationInvitation(tx *gorm.DB, tokenString, email string) (*models.OrganizationInvitation, error) {
+	selector, verifier, ok := parseSplitToken(tokenString)
+	if !ok {
+		return nil, ErrInvalidInvitation
+	}
+
+	var invitation models.OrganizationInvitation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("selector = ?", selector).
+		First(&invitation).Error; err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	if !verifierMatches(verifier, invitation.VerifierHash) ||
+		invitation.AcceptedAt != nil || !invitation.ExpiresAt.After(time.Now()) ||
+		!strings.EqualFold(invitation.Email, email) {
+		return nil, ErrInvalidInvitation
+	}
+
+	if err := tx.Model(&invitation).Update("accepted_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
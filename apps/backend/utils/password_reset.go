@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"backend/config"
+	"backend/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const passwordResetLifetime = time.Hour
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// CreatePasswordResetToken issues a new reset token for the user. Any
+// outstanding tokens for the user are invalidated so only the latest email works.
+func CreatePasswordResetToken(userID uuid.UUID, ip string) (string, error) {
+	tokenString, selector, verifierHash, err := newSplitToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:       userID,
+			Selector:     selector,
+			VerifierHash: verifierHash,
+			ExpiresAt:    time.Now().Add(passwordResetLifetime),
+			RequestedIP:  ip,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// ConsumePasswordResetToken validates a reset token and marks it used within tx
+func ConsumePasswordResetToken(tx *gorm.DB, tokenString string) (*models.PasswordResetToken, error) {
+	selector, verifier, ok := parseSplitToken(tokenString)
+	if !ok {
+		return nil, ErrInvalidResetToken
+	}
+
+	var resetToken models.PasswordResetToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("selector = ?", selector).
+		First(&resetToken).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	if !verifierMatches(verifier, resetToken.VerifierHash) ||
+		resetToken.UsedAt != nil || !resetToken.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidResetToken
+	}
+
+	if err := tx.Model(&resetToken).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return &resetToken, nil
+}
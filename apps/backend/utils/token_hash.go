@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	selectorBytes = 12
+	verifierBytes = 32
+)
+
+// errNoTokenHashKey is returned when tokens are hashed before InitKeys
+var errNoTokenHashKey = errors.New("token hash key is not loaded")
+
+// newSplitToken generates an opaque token of the form "<selector>.<verifier>".
+// Only the selector and a keyed hash of the verifier are meant to be stored:
+// the selector locates the row, the verifier proves possession of the token.
+func newSplitToken() (token, selector, verifierHash string, err error) {
+	selector, err = randomHex(selectorBytes)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	verifier, err := randomHex(verifierBytes)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	verifierHash, err = hashVerifier(verifier)
+	if err != nil {
+		return "", "", "", err
+	}
+	return selector + "." + verifier, selector, verifierHash, nil
+}
+
+// parseSplitToken splits a token produced by newSplitToken
+func parseSplitToken(token string) (selector, verifier string, ok bool) {
+	selector, verifier, found := strings.Cut(token, ".")
+	if !found || len(selector) != selectorBytes*2 || len(verifier) != verifierBytes*2 {
+		return "", "", false
+	}
+	return selector, verifier, true
+}
+
+// hashVerifier returns the keyed hash stored for a token verifier. It fails
+// without a key rather than hashing with an empty one.
+func hashVerifier(verifier string) (string, error) {
+	key := getTokenHashKey()
+	if len(key) == 0 {
+		return "", errNoTokenHashKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(verifier))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifierMatches compares a presented verifier with a stored hash in constant
+// time. Nothing matches until a key is loaded.
+func verifierMatches(verifier, storedHash string) bool {
+	key := getTokenHashKey()
+	if len(key) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(storedHash)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(verifier))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// getTokenHashKey returns the HMAC key loaded by InitKeys
+func getTokenHashKey() []byte {
+	return tokenHashKey
+}
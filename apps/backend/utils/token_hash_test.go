@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// withTokenHashKey sets the token hash key for the length of a test
+func withTokenHashKey(t *testing.T, key []byte) {
+	t.Helper()
+	previous := tokenHashKey
+	tokenHashKey = key
+	t.Cleanup(func() { tokenHashKey = previous })
+}
+
+func TestSplitTokenRoundTrip(t *testing.T) {
+	withTokenHashKey(t, []byte("test-key"))
+
+	token, selector, verifierHash, err := newSplitToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(verifierHash, strings.SplitN(token, ".", 2)[1]) {
+		t.Fatal("the stored hash contains the verifier")
+	}
+
+	gotSelector, verifier, ok := parseSplitToken(token)
+	if !ok {
+		t.Fatalf("parseSplitToken(%q) failed", token)
+	}
+	if gotSelector != selector {
+		t.Fatalf("selector = %q, want %q", gotSelector, selector)
+	}
+	if !verifierMatches(verifier, verifierHash) {
+		t.Fatal("verifier does not match its own hash")
+	}
+
+	other, _, _, err := newSplitToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Fatal("two tokens are equal")
+	}
+}
+
+func TestSplitTokenTampering(t *testing.T) {
+	withTokenHashKey(t, []byte("test-key"))
+
+	token, _, verifierHash, err := newSplitToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, verifier, _ := parseSplitToken(token)
+
+	// Change one character of the verifier
+	flipped := []byte(verifier)
+	if flipped[0] == 'a' {
+		flipped[0] = 'b'
+	} else {
+		flipped[0] = 'a'
+	}
+	if verifierMatches(string(flipped), verifierHash) {
+		t.Fatal("a changed verifier matches")
+	}
+
+	// A hash made with another key does not match
+	withTokenHashKey(t, []byte("other-key"))
+	if verifierMatches(verifier, verifierHash) {
+		t.Fatal("verifier matches under another key")
+	}
+
+	if verifierMatches(verifier, "not hex") {
+		t.Fatal("verifier matches a malformed hash")
+	}
+}
+
+func TestParseSplitTokenRejectsMalformed(t *testing.T) {
+	withTokenHashKey(t, []byte("test-key"))
+	token, _, _, err := newSplitToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, verifier, _ := parseSplitToken(token)
+
+	for _, malformed := range []string{
+		"",
+		selector + verifier,
+		selector + ".",
+		"." + verifier,
+		selector[1:] + "." + verifier,
+		selector + "." + verifier + "00",
+	} {
+		if _, _, ok := parseSplitToken(malformed); ok {
+			t.Errorf("parseSplitToken(%q) succeeded", malformed)
+		}
+	}
+}
+
+func TestSplitTokenWithoutKeyFailsClosed(t *testing.T) {
+	withTokenHashKey(t, []byte("test-key"))
+	token, _, verifierHash, err := newSplitToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, verifier, _ := parseSplitToken(token)
+
+	withTokenHashKey(t, nil)
+	if _, _, _, err := newSplitToken(); err == nil {
+		t.Fatal("token issued without a key")
+	}
+	if _, err := hashVerifier(verifier); err == nil {
+		t.Fatal("verifier hashed without a key")
+	}
+	if verifierMatches(verifier, verifierHash) {
+		t.Fatal("verifier matches without a key")
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPCodeRFC6238(t *testing.T) {
+	// The RFC lists eight digit codes; six digit codes are their last six
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		step, ok := ValidateTOTPCode(rfc6238Secret, v.code, 0, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("code %s at %d was rejected", v.code, v.unix)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("code %s at %d matched step %d, want %d", v.code, v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPCodeSkewAndReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		step     int64
+		lastUsed int64
+		want     bool
+	}{
+		{"current step", current, 0, true},
+		{"one step behind", current - 1, 0, true},
+		{"one step ahead", current + 1, 0, true},
+		{"two steps behind", current - 2, 0, false},
+		{"two steps ahead", current + 2, 0, false},
+		{"replayed step", current, current, false},
+		{"step before the last used", current - 1, current, false},
+		{"step after the last used", current + 1, current, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := totpCode(key, uint64(tt.step))
+			step, ok := ValidateTOTPCode(rfc6238Secret, code, tt.lastUsed, now)
+			if ok != tt.want {
+				t.Fatalf("ValidateTOTPCode = %v, want %v", ok, tt.want)
+			}
+			if ok && step != tt.step {
+				t.Fatalf("matched step %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPCodeInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"surrounding spaces", rfc6238Secret, " 287082 ", true},
+		{"lower case secret", strings.ToLower(rfc6238Secret), "287082", true},
+		{"wrong code", rfc6238Secret, "287083", false},
+		{"too short", rfc6238Secret, "28708", false},
+		{"eight digits", rfc6238Secret, "94287082", false},
+		{"invalid secret", "not base32!", "287082", false},
+		{"empty code", rfc6238Secret, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTPCode(tt.secret, tt.code, 0, now); ok != tt.want {
+				t.Fatalf("ValidateTOTPCode = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	first, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("two secrets are equal")
+	}
+	key, err := totpEncoding.DecodeString(first)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret decodes to %d bytes (%v), want 20", len(key), err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Acme Corp", "jane@example.com", rfc6238Secret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Fatalf("URI %s is not an otpauth://totp URI", uri)
+	}
+	if u.Path != "/Acme Corp:jane@example.com" {
+		t.Fatalf("label = %q", u.Path)
+	}
+	query := u.Query()
+	want := map[string]string{"secret": rfc6238Secret, "issuer": "Acme Corp", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
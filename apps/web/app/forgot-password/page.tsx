@@ -0,0 +1,68 @@
+'use client'
+
+import { useState } from 'react'
+import { authService } from '../../lib/auth'
+
+export default function ForgotPasswordPage() {
+  const [email, setEmail] = useState('')
+  const [loading, setLoading] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+  const [message, setMessage] = useState<string | null>(null)
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setLoading(true)
+    setError(null)
+
+    try {
+      setMessage(await authService.forgotPassword(email))
+    } catch (err: any) {
+      setError(err.message || 'Failed to request a password reset.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8">
+        <h2 className="text-center text-3xl font-extrabold text-gray-900">
+          Forgot your password?
+        </h2>
+
+        {message && (
+          <div className="rounded-md bg-green-50 p-4 text-sm text-green-700">{message}</div>
+        )}
+
+        {error && (
+          <div className="rounded-md bg-red-50 p-4 text-sm text-red-700">{error}</div>
+        )}
+
+        <form className="space-y-6" onSubmit={handleSubmit}>
+          <input
+            type="email"
+            required
+            value={email}
+            onChange={(e) => setEmail(e.target.value)}
+            className="appearance-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-md focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+            placeholder="Email address"
+          />
+
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {loading ? 'Sending...' : 'Send reset link'}
+          </button>
+
+          <p className="text-center text-sm text-gray-600">
+            <a href="/login" className="font-medium text-blue-600 hover:text-blue-500">
+              Back to sign in
+            </a>
+          </p>
+        </form>
+      </div>
+    </div>
+  )
+}
@@ -13,23 +13,29 @@ export default function LoginPage() {
   const [error, setError] = useState<string | null>(null)
   const [showPassword, setShowPassword] = useState(false)
   const [message, setMessage] = useState<string | null>(null)
+  const [mfaToken, setMfaToken] = useState<string | null>(null)
+  const [mfaCode, setMfaCode] = useState('')
   
   const router = useRouter()
   const searchParams = useSearchParams()
   const redirectTo = searchParams?.get('redirect') || '/dashboard'
   const logoutMessage = searchParams?.get('logout')
+  const registeredMessage = searchParams?.get('registered')
 
   useEffect(() => {
     // Show logout message if present
     if (logoutMessage === 'true') {
       setMessage('You have been successfully logged out.')
     }
+    if (registeredMessage === 'true') {
+      setMessage('Account created. Check your email for a verification link before signing in.')
+    }
     
     // Check if user is already authenticated
     if (authService.isAuthenticated()) {
       router.push(redirectTo)
     }
-  }, [router, redirectTo, logoutMessage])
+  }, [router, redirectTo, logoutMessage, registeredMessage])
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
@@ -41,6 +47,11 @@ export default function LoginPage() {
         username: formData.username,
         password: formData.password
       })
+
+      if ('mfa_required' in response) {
+        setMfaToken(response.mfa_token)
+        return
+      }
       
       if (response.user) {
         // Redirect to intended page or dashboard
@@ -56,6 +67,22 @@ export default function LoginPage() {
     }
   }
 
+  const handleMfaSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    if (!mfaToken) return
+    setLoading(true)
+    setError(null)
+
+    try {
+      await authService.verifyMFA(mfaToken, mfaCode)
+      router.push(redirectTo)
+    } catch (err: any) {
+      setError(err.message || 'Invalid verification code.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
   const handleInputChange = (e: React.ChangeEvent<HTMLInputElement>) => {
     const { name, value } = e.target
     setFormData(prev => ({
@@ -123,6 +150,34 @@ export default function LoginPage() {
           </div>
         )}
 
+        {mfaToken ? (
+        <form className="mt-8 space-y-6" onSubmit={handleMfaSubmit}>
+          <div>
+            <label htmlFor="mfa-code" className="block text-sm font-medium text-gray-700 mb-1">
+              Authentication code or recovery code
+            </label>
+            <input
+              id="mfa-code"
+              name="mfa-code"
+              type="text"
+              autoComplete="one-time-code"
+              required
+              value={mfaCode}
+              onChange={(e) => setMfaCode(e.target.value)}
+              className="appearance-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-md focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+              placeholder="123456"
+            />
+          </div>
+
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {loading ? 'Verifying...' : 'Verify'}
+          </button>
+        </form>
+        ) : (
         <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
           <div className="rounded-md shadow-sm -space-y-px">
             <div>
@@ -189,7 +244,7 @@ export default function LoginPage() {
             </div>
 
             <div className="text-sm">
-              <a href="#" className="font-medium text-blue-600 hover:text-blue-500">
+              <a href="/forgot-password" className="font-medium text-blue-600 hover:text-blue-500">
                 Forgot your password?
               </a>
             </div>
@@ -232,6 +287,7 @@ export default function LoginPage() {
             </div>
           </div>
         </form>
+        )}
       </div>
     </div>
   )
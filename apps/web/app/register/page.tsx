@@ -54,7 +54,10 @@ export default function RegisterPage() {
         last_name: formData.last_name
       })
       
-      if (response.user) {
+      if (response.user && !response.access_token) {
+        // Email verification is required before the first login
+        router.push('/login?registered=true')
+      } else if (response.user) {
         // Redirect to dashboard
         router.push('/dashboard')
       } else {
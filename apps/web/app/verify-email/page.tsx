@@ -0,0 +1,88 @@
+'use client'
+
+import { useEffect, useState } from 'react'
+import { useSearchParams } from 'next/navigation'
+import { authService } from '../../lib/auth'
+
+export default function VerifyEmailPage() {
+  const [status, setStatus] = useState<'verifying' | 'verified' | 'failed'>('verifying')
+  const [error, setError] = useState<string | null>(null)
+  const [email, setEmail] = useState('')
+  const [message, setMessage] = useState<string | null>(null)
+
+  const searchParams = useSearchParams()
+  const token = searchParams?.get('token') || ''
+
+  useEffect(() => {
+    if (!token) {
+      setStatus('failed')
+      setError('Verification link is missing its token.')
+      return
+    }
+
+    authService.verifyEmail(token)
+      .then(() => setStatus('verified'))
+      .catch((err: any) => {
+        setStatus('failed')
+        setError(err.message || 'Failed to verify email.')
+      })
+  }, [token])
+
+  const handleResend = async (e: React.FormEvent) => {
+    e.preventDefault()
+    try {
+      setMessage(await authService.resendVerification(email))
+    } catch (err: any) {
+      setError(err.message || 'Failed to resend verification email.')
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8">
+        <h2 className="text-center text-3xl font-extrabold text-gray-900">
+          Email verification
+        </h2>
+
+        {status === 'verifying' && (
+          <p className="text-center text-sm text-gray-600">Verifying your email address...</p>
+        )}
+
+        {status === 'verified' && (
+          <div className="rounded-md bg-green-50 p-4 text-sm text-green-700">
+            Your email address has been verified. <a href="/login" className="font-medium underline">Sign in</a>
+          </div>
+        )}
+
+        {status === 'failed' && (
+          <>
+            {error && (
+              <div className="rounded-md bg-red-50 p-4 text-sm text-red-700">{error}</div>
+            )}
+            {message && (
+              <div className="rounded-md bg-green-50 p-4 text-sm text-green-700">{message}</div>
+            )}
+
+            <form className="space-y-4" onSubmit={handleResend}>
+              <input
+                type="email"
+                required
+                autoComplete="email"
+                value={email}
+                onChange={(e) => setEmail(e.target.value)}
+                className="appearance-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-md focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+                placeholder="Email address"
+              />
+              <button
+                type="submit"
+                className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+              >
+                Send a new link
+              </button>
+            </form>
+          </>
+        )}
+      </div>
+    </div>
+  )
+}
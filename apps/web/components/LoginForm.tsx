@@ -22,7 +22,11 @@ export default function LoginForm({ onSuccess, onSwitchToRegister }: LoginFormPr
     setError('')
 
     try {
-      await authService.login(formData)
+      const response = await authService.login(formData)
+      if ('mfa_required' in response) {
+        setError('Two-factor authentication is required. Please sign in from the login page.')
+        return
+      }
       onSuccess?.()
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Login failed')
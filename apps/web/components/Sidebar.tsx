@@ -45,6 +45,8 @@ export default function Sidebar({ isOpen, onToggle }: SidebarProps) {
   }
 
   const isActive = (path: string) => {
+    // Groups without a page of their own have no path
+    if (!path) return false
     return pathname === path || pathname.startsWith(path + '/')
   }
 
@@ -9,6 +9,9 @@ interface User {
   first_name: string
   last_name: string
   is_active: boolean
+  email_verified_at?: string | null
+  attributes?: Record<string, unknown>
+  active_organization_id?: string | null
   roles: Role[]
   created_at: string
   updated_at: string
@@ -18,7 +21,10 @@ interface Role {
   id: string
   name: string
   description: string
+  organization_id?: string | null
   permissions: Permission[]
+  denied_permissions?: Permission[]
+  parents?: Role[]
   users?: User[]
 }
 
@@ -28,6 +34,132 @@ interface Permission {
   description: string
   resource: string
   action: string
+  scope?: 'any' | 'own'
+}
+
+interface RoleAssignment {
+  user_id: string
+  role_id: string
+  organization_id: string
+  assigned_by: string
+  starts_at?: string | null
+  expires_at?: string | null
+  reason: string
+  created_at: string
+  role?: Role
+}
+
+interface RoleGrant {
+  starts_at?: string
+  expires_at?: string
+  reason?: string
+}
+
+interface ElevationRequest {
+  id: string
+  organization_id: string
+  user_id: string
+  user?: User
+  role_id: string
+  role?: Role
+  duration_seconds: number
+  justification: string
+  status: 'pending' | 'approved' | 'rejected' | 'cancelled'
+  decided_by?: string | null
+  decided_at?: string | null
+  decision_note: string
+  expires_at?: string | null
+  created_at: string
+}
+
+interface PermissionCheck {
+  resource: string
+  action: string
+  resource_id?: string
+}
+
+interface PermissionCheckResult extends PermissionCheck {
+  allowed: boolean
+  scope?: 'any' | 'own'
+  error?: string
+  explanation?: {
+    allowed: boolean
+    reason: string
+    grant?: { permission: Permission; role: string; effect: 'allow' | 'deny'; inherited: boolean }
+  }
+}
+
+interface Menu {
+  id: string
+  parent_id?: string | null
+  name: string
+  label: string
+  icon: string
+  path: string
+  permission: string
+  feature: string
+  sort_order: number
+}
+
+interface FeatureFlag {
+  id: string
+  name: string
+  description: string
+  default_on: boolean
+  environments: Record<string, boolean>
+  roles: string[]
+  user_ids: string[]
+  organization_ids: string[]
+  percentage: number
+}
+
+interface RequestLog {
+  id: string
+  user_id?: string
+  ip: string
+  method: string
+  path: string
+  user_agent: string
+  status: number
+  duration: number
+  created_at: string
+  chain_seq?: number
+  prev_hash?: string
+  hash?: string
+}
+
+interface FailedLogin {
+  id: string
+  ip: string
+  username: string
+  user_id?: string
+  user_agent: string
+  reason: string
+  created_at: string
+  chain_seq?: number
+  prev_hash?: string
+  hash?: string
+}
+
+// Filters for the security logs; times are RFC 3339
+interface SecurityLogFilters {
+  user_id?: string
+  ip?: string
+  method?: string
+  path?: string
+  status?: string
+  username?: string
+  reason?: string
+  from?: string
+  to?: string
+  q?: string
+}
+
+interface Organization {
+  id: string
+  name: string
+  slug: string
+  created_at: string
 }
 
 interface AuthResponse {
@@ -35,11 +167,19 @@ interface AuthResponse {
   refresh_token: string
   expires_at: number
   user: User
+  mfa_enrollment_required?: boolean
+}
+
+interface MFAChallengeResponse {
+  mfa_required: true
+  mfa_token: string
+  expires_at: number
 }
 
 interface LoginRequest {
   username: string
   password: string
+  organization_id?: string
 }
 
 interface RegisterRequest {
@@ -62,7 +202,7 @@ class AuthService {
     }
   }
 
-  async login(credentials: LoginRequest): Promise<AuthResponse> {
+  async login(credentials: LoginRequest): Promise<AuthResponse | MFAChallengeResponse> {
     const response = await fetch(`${API_BASE_URL}/api/v1/auth/login`, {
       method: 'POST',
       headers: {
@@ -76,6 +216,28 @@ class AuthService {
       throw new Error(error.error || 'Login failed')
     }
 
+    const data: AuthResponse | MFAChallengeResponse = await response.json()
+    if ('mfa_required' in data) {
+      return data
+    }
+    this.setTokens(data.access_token, data.refresh_token)
+    return data
+  }
+
+  async verifyMFA(mfaToken: string, code: string): Promise<AuthResponse> {
+    const response = await fetch(`${API_BASE_URL}/api/v1/auth/mfa/verify`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ mfa_token: mfaToken, code }),
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Verification failed')
+    }
+
     const data: AuthResponse = await response.json()
     this.setTokens(data.access_token, data.refresh_token)
     return data
@@ -96,10 +258,75 @@ class AuthService {
     }
 
     const data: AuthResponse = await response.json()
-    this.setTokens(data.access_token, data.refresh_token)
+    // No tokens are issued when the email address must be verified first
+    if (data.access_token) {
+      this.setTokens(data.access_token, data.refresh_token)
+    }
     return data
   }
 
+  async verifyEmail(token: string): Promise<void> {
+    const response = await fetch(`${API_BASE_URL}/api/v1/auth/verify-email`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token }),
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Failed to verify email')
+    }
+  }
+
+  async resendVerification(email: string): Promise<string> {
+    const response = await fetch(`${API_BASE_URL}/api/v1/auth/resend-verification`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email }),
+    })
+
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to resend verification email')
+    }
+    return data.message
+  }
+
+  async forgotPassword(email: string): Promise<string> {
+    const response = await fetch(`${API_BASE_URL}/api/v1/auth/forgot-password`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email }),
+    })
+
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to request password reset')
+    }
+    return data.message
+  }
+
+  async resetPassword(token: string, password: string): Promise<void> {
+    const response = await fetch(`${API_BASE_URL}/api/v1/auth/reset-password`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token, password }),
+    })
+
+    if (!response.ok) {
+      const error = await response.json()
+      throw new Error(error.error || 'Failed to reset password')
+    }
+  }
+
   async getCurrentUser(): Promise<User> {
     const response = await this.authenticatedRequest('/api/v1/auth/me')
     const data = await response.json()
@@ -112,6 +339,24 @@ class AuthService {
     return data
   }
 
+  async can(checks: PermissionCheck[], explain = false): Promise<PermissionCheckResult[]> {
+    const response = await this.authenticatedRequest('/api/v1/auth/can', {
+      method: 'POST',
+      body: JSON.stringify({ checks, explain }),
+    })
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to check permissions')
+    }
+    return data.results
+  }
+
+  async getFeatures(): Promise<Record<string, boolean>> {
+    const response = await this.authenticatedRequest('/api/v1/auth/features')
+    const data = await response.json()
+    return data.features
+  }
+
   async logout(): Promise<void> {
     try {
       // Send refresh token to logout endpoint
@@ -184,6 +429,152 @@ class AuthService {
     return response.json()
   }
 
+  // Organization methods
+  async getOrganizations(): Promise<{ organizations: Organization[]; current: string }> {
+    const response = await this.authenticatedRequest('/api/v1/orgs')
+    return response.json()
+  }
+
+  async createOrganization(name: string, slug?: string): Promise<Organization> {
+    const response = await this.authenticatedRequest('/api/v1/orgs', {
+      method: 'POST',
+      body: JSON.stringify({ name, slug }),
+    })
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to create organization')
+    }
+    return data.organization
+  }
+
+  // Switching issues tokens acting in the other organization
+  async switchOrganization(organizationId: string): Promise<AuthResponse> {
+    const response = await this.authenticatedRequest(`/api/v1/orgs/${organizationId}/switch`, {
+      method: 'POST',
+    })
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to switch organization')
+    }
+    this.setTokens(data.access_token, data.refresh_token)
+    return data
+  }
+
+  async inviteMember(email: string, roleId: string) {
+    const response = await this.authenticatedRequest('/api/v1/orgs/current/invitations', {
+      method: 'POST',
+      body: JSON.stringify({ email, role_id: roleId }),
+    })
+    return response.json()
+  }
+
+  async acceptInvitation(token: string): Promise<Organization> {
+    const response = await this.authenticatedRequest('/api/v1/orgs/invitations/accept', {
+      method: 'POST',
+      body: JSON.stringify({ token }),
+    })
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to accept invitation')
+    }
+    return data.organization
+  }
+
+  // Navigation menu methods
+  async getMenus(): Promise<Menu[]> {
+    const response = await this.authenticatedRequest('/api/v1/menus')
+    const data = await response.json()
+    return data.menus
+  }
+
+  async saveMenu(menu: Omit<Menu, 'id'> & { id?: string }) {
+    const { id, ...body } = menu
+    const response = await this.authenticatedRequest(id ? `/api/v1/menus/${id}` : '/api/v1/menus', {
+      method: id ? 'PUT' : 'POST',
+      body: JSON.stringify(body),
+    })
+    return response.json()
+  }
+
+  async deleteMenu(id: string) {
+    const response = await this.authenticatedRequest(`/api/v1/menus/${id}`, {
+      method: 'DELETE',
+    })
+    return response.json()
+  }
+
+  // Feature flag methods
+  async getFeatureFlags(): Promise<FeatureFlag[]> {
+    const response = await this.authenticatedRequest('/api/v1/features')
+    const data = await response.json()
+    return data.flags
+  }
+
+  async saveFeatureFlag(flag: Omit<FeatureFlag, 'id'> & { id?: string }) {
+    const { id, ...body } = flag
+    const response = await this.authenticatedRequest(id ? `/api/v1/features/${id}` : '/api/v1/features', {
+      method: id ? 'PUT' : 'POST',
+      body: JSON.stringify(body),
+    })
+    return response.json()
+  }
+
+  async deleteFeatureFlag(id: string) {
+    const response = await this.authenticatedRequest(`/api/v1/features/${id}`, {
+      method: 'DELETE',
+    })
+    return response.json()
+  }
+
+  // Security log methods
+  async getRequestLogs(filters: SecurityLogFilters = {}, cursor?: string, limit?: number): Promise<{ requests: RequestLog[]; next_cursor: string | null }> {
+    const response = await this.authenticatedRequest(`/api/v1/security/requests?${securityLogParams(filters, { cursor, limit })}`)
+    return response.json()
+  }
+
+  // Counters of the request log writer in the process that serves the call
+  async getRequestLogStats(): Promise<{ written: number; dropped: number; failed: number }> {
+    const response = await this.authenticatedRequest('/api/v1/security/requests/stats')
+    return response.json()
+  }
+
+  async getFailedLogins(filters: SecurityLogFilters = {}, cursor?: string, limit?: number): Promise<{ failed_logins: FailedLogin[]; next_cursor: string | null }> {
+    const response = await this.authenticatedRequest(`/api/v1/security/failed-logins?${securityLogParams(filters, { cursor, limit })}`)
+    return response.json()
+  }
+
+  // Downloads every matching row of a log as CSV or JSON Lines
+  async exportSecurityLog(log: 'requests' | 'failed-logins', format: 'csv' | 'jsonl', filters: SecurityLogFilters = {}): Promise<Blob> {
+    const response = await this.authenticatedRequest(`/api/v1/security/${log}?${securityLogParams(filters, { format })}`)
+    if (!response.ok) {
+      throw new Error('Failed to export security log')
+    }
+    return response.blob()
+  }
+
+  // Just-in-time elevation methods
+  async getElevations(status?: ElevationRequest['status']) {
+    const query = status ? `?status=${status}` : ''
+    const response = await this.authenticatedRequest(`/api/v1/elevations${query}`)
+    return response.json()
+  }
+
+  async requestElevation(roleId: string, duration: string, justification: string) {
+    const response = await this.authenticatedRequest('/api/v1/elevations', {
+      method: 'POST',
+      body: JSON.stringify({ role_id: roleId, duration, justification }),
+    })
+    return response.json()
+  }
+
+  async decideElevation(id: string, decision: 'approve' | 'reject' | 'cancel', note?: string) {
+    const response = await this.authenticatedRequest(`/api/v1/elevations/${id}/${decision}`, {
+      method: 'POST',
+      body: JSON.stringify({ note }),
+    })
+    return response.json()
+  }
+
   async getRoles() {
     const response = await this.authenticatedRequest('/api/v1/roles')
     return response.json()
@@ -213,13 +604,31 @@ class AuthService {
     return response.json()
   }
 
-  async assignRoles(userId: string, roleIds: string[]) {
+  async assignRoles(userId: string, roleIds: string[], grant: RoleGrant = {}) {
     const response = await this.authenticatedRequest(`/api/v1/users/${userId}/roles`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
       },
-      body: JSON.stringify({ role_ids: roleIds }),
+      body: JSON.stringify({ role_ids: roleIds, ...grant }),
+    })
+    return response.json()
+  }
+
+  async grantRole(userId: string, roleId: string, grant: RoleGrant = {}) {
+    const response = await this.authenticatedRequest(`/api/v1/users/${userId}/roles/${roleId}`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(grant),
+    })
+    return response.json()
+  }
+
+  async revokeRole(userId: string, roleId: string) {
+    const response = await this.authenticatedRequest(`/api/v1/users/${userId}/roles/${roleId}`, {
+      method: 'DELETE',
     })
     return response.json()
   }
@@ -356,15 +765,25 @@ class AuthService {
 
   hasPermission(resource: string, action: string, user?: User): boolean {
     if (!user) return false
-    
+
+    // "*" matches any resource or action, and a denial wins over any grant,
+    // mirroring the backend. Inherited and own-scoped permissions are only
+    // checked there.
+    const matches = (permission: Permission) =>
+      permission.scope !== 'own' &&
+      (permission.resource === '*' || permission.resource === resource) &&
+      (permission.action === '*' || permission.action === action)
+
+    let allowed = false
     for (const role of user.roles) {
-      for (const permission of role.permissions) {
-        if (permission.resource === resource && permission.action === action) {
-          return true
-        }
+      if (role.denied_permissions?.some(matches)) {
+        return false
+      }
+      if (role.permissions.some(matches)) {
+        allowed = true
       }
     }
-    return false
+    return allowed
   }
 
   hasRole(roleName: string, user?: User): boolean {
@@ -373,5 +792,15 @@ class AuthService {
   }
 }
 
+function securityLogParams(filters: SecurityLogFilters, extra: Record<string, string | number | undefined>): URLSearchParams {
+  const params = new URLSearchParams()
+  for (const [key, value] of Object.entries({ ...filters, ...extra })) {
+    if (value !== undefined && value !== '') {
+      params.append(key, String(value))
+    }
+  }
+  return params
+}
+
 export const authService = new AuthService()
-export type { User, Role, Permission, AuthResponse, LoginRequest, RegisterRequest }
+export type { User, Role, RoleAssignment, RoleGrant, ElevationRequest, PermissionCheck, PermissionCheckResult, Permission, Menu, FeatureFlag, RequestLog, FailedLogin, SecurityLogFilters, Organization, AuthResponse, MFAChallengeResponse, LoginRequest, RegisterRequest }
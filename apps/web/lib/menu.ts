@@ -8,12 +8,8 @@ export interface MenuAccess {
   accessible?: boolean
 }
 
-export interface FeatureAccess {
-  export: boolean
-  import: boolean
-  backup: boolean
-  maintenance: boolean
-}
+// Feature flags by name, evaluated for the current user
+export type FeatureAccess = Record<string, boolean>
 
 export interface MenuAccessResponse {
   menus: MenuAccess[]
@@ -54,7 +50,7 @@ export const menuConfig: Omit<MenuAccess, 'accessible'>[] = [
     name: 'admin',
     label: 'Administration',
     icon: 'Settings',
-    path: '/admin',
+    path: '',
     permission: 'menu.admin',
     children: [
       {